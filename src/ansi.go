@@ -3,18 +3,33 @@ package main
 import (
 	"strconv"
 	"strings"
-	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
 )
 
+// ansiState is the SGR state of a run of text plus the OSC 8 hyperlink it
+// is part of. Concealed text (SGR 8) and overline (SGR 53) have no tcell
+// attribute: concealed text is drawn as blanks and overline is tracked so
+// it can be reset, but not drawn.
 type ansiState struct {
-	style     tcell.Style
-	bold      bool
-	underline bool
-	reverse   bool
+	style    tcell.Style
+	hidden   bool
+	overline bool
+	link     string
 }
 
+// drawStyle is the style text in this state is drawn with.
+func (s ansiState) drawStyle() tcell.Style {
+	if s.link == "" {
+		return s.style
+	}
+	return s.style.Url(s.link)
+}
+
+// drawAnsiText draws text with its SGR colours and attributes in a field
+// width cells wide, segmenting it into grapheme clusters so wide characters
+// take two cells and combining marks stay with their base. Escape
+// sequences other than SGR and OSC 8 hyperlinks are consumed and dropped.
 func drawAnsiText(screen tcell.Screen, x, y, width int, text string, baseStyle tcell.Style) {
 	if width <= 0 {
 		return
@@ -22,39 +37,41 @@ func drawAnsiText(screen tcell.Screen, x, y, width int, text string, baseStyle t
 	state := ansiState{style: baseStyle}
 	col := 0
 	for i := 0; i < len(text) && col < width; {
-		if text[i] == 0x1b && i+1 < len(text) && text[i+1] == '[' {
-			end := i + 2
-			for end < len(text) && text[end] != 'm' {
-				end++
+		tok, n, ok := nextToken(text[i:])
+		if !ok {
+			// The line ends inside an escape sequence.
+			break
+		}
+		i += n
+		switch tok.kind {
+		case escCSI:
+			if tok.isSGR() {
+				state = applySGR(state, baseStyle, parseSGRParams(tok.params))
 			}
-			if end < len(text) {
-				params := parseSGRParams(text[i+2 : end])
-				state = applySGR(state, baseStyle, params)
-				i = end + 1
-				continue
+		case escOSC:
+			if uri, ok := oscHyperlink(tok.params); ok {
+				state.link = uri
 			}
-		}
-		r, size := utf8.DecodeRuneInString(text[i:])
-		if r == utf8.RuneError && size == 1 {
-			i++
-			continue
-		}
-		if r == '\r' {
-			i += size
-			continue
-		}
-		if r == '\t' {
-			spaces := 4 - (col % 4)
-			for s := 0; s < spaces && col < width; s++ {
-				screen.SetContent(x+col, y, ' ', nil, state.style)
-				col++
+		case escControl:
+			if tok.final == '\t' {
+				spaces := 4 - (col % 4)
+				for s := 0; s < spaces && col < width; s++ {
+					screen.SetContent(x+col, y, ' ', nil, state.style)
+					col++
+				}
+			}
+		case escText:
+			segment := tok.text
+			if state.hidden {
+				// Concealed text keeps its width but shows nothing.
+				segment = strings.Repeat(" ", textWidth(segment))
+			}
+			var rest string
+			col, rest = drawGraphemes(screen, x, y, col, width, segment, state.drawStyle())
+			if rest != "" {
+				i = len(text)
 			}
-			i += size
-			continue
 		}
-		screen.SetContent(x+col, y, r, nil, state.style)
-		col++
-		i += size
 	}
 	for col < width {
 		screen.SetContent(x+col, y, ' ', nil, baseStyle)
@@ -62,57 +79,120 @@ func drawAnsiText(screen tcell.Screen, x, y, width int, text string, baseStyle t
 	}
 }
 
-func parseSGRParams(s string) []int {
+// ansiVisibleWidth is the display width of the text in s, leaving out
+// escape sequences and control bytes.
+func ansiVisibleWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		tok, n, ok := nextToken(s[i:])
+		if !ok {
+			break
+		}
+		if tok.kind == escText {
+			width += textWidth(tok.text)
+		}
+		i += n
+	}
+	return width
+}
+
+// sgrParam is one semicolon-separated SGR parameter followed by its colon
+// subparameters, e.g. "4:3" is {4, 3} and "38:2::1:2:3" is {38, 2, 0, 1, 2, 3}.
+// Empty fields read as 0.
+type sgrParam []int
+
+func parseSGRParams(s string) []sgrParam {
 	if s == "" {
-		return []int{0}
+		return []sgrParam{{0}}
 	}
 	parts := strings.Split(s, ";")
-	params := make([]int, 0, len(parts))
+	params := make([]sgrParam, 0, len(parts))
 	for _, part := range parts {
-		if part == "" {
-			params = append(params, 0)
-			continue
+		fields := strings.Split(part, ":")
+		param := make(sgrParam, 0, len(fields))
+		valid := true
+		for i, field := range fields {
+			if field == "" {
+				param = append(param, 0)
+				continue
+			}
+			val, err := strconv.Atoi(field)
+			if err != nil {
+				if i == 0 {
+					valid = false
+					break
+				}
+				val = 0
+			}
+			param = append(param, val)
 		}
-		val, err := strconv.Atoi(part)
-		if err != nil {
-			continue
+		if valid {
+			params = append(params, param)
 		}
-		params = append(params, val)
 	}
 	if len(params) == 0 {
-		return []int{0}
+		return []sgrParam{{0}}
 	}
 	return params
 }
 
-func applySGR(state ansiState, base tcell.Style, params []int) ansiState {
+// sgrUnderlineStyles maps the 4:n subparameter to tcell's underline styles.
+var sgrUnderlineStyles = []tcell.UnderlineStyle{
+	tcell.UnderlineStyleNone,
+	tcell.UnderlineStyleSolid,
+	tcell.UnderlineStyleDouble,
+	tcell.UnderlineStyleCurly,
+	tcell.UnderlineStyleDotted,
+	tcell.UnderlineStyleDashed,
+}
+
+func applySGR(state ansiState, base tcell.Style, params []sgrParam) ansiState {
 	if len(params) == 0 {
-		params = []int{0}
+		params = []sgrParam{{0}}
 	}
 	fgBase, bgBase, _ := base.Decompose()
 	for i := 0; i < len(params); i++ {
-		p := params[i]
+		p := params[i][0]
 		switch {
 		case p == 0:
-			state = ansiState{style: base}
+			// A reset does not end a hyperlink.
+			state = ansiState{style: base, link: state.link}
 		case p == 1:
-			state.bold = true
 			state.style = state.style.Bold(true)
-		case p == 22:
-			state.bold = false
-			state.style = state.style.Bold(false)
+		case p == 2:
+			state.style = state.style.Dim(true)
+		case p == 3:
+			state.style = state.style.Italic(true)
 		case p == 4:
-			state.underline = true
-			state.style = state.style.Underline(true)
-		case p == 24:
-			state.underline = false
-			state.style = state.style.Underline(false)
+			ul := tcell.UnderlineStyleSolid
+			if sub := params[i][1:]; len(sub) > 0 && sub[0] >= 0 && sub[0] < len(sgrUnderlineStyles) {
+				ul = sgrUnderlineStyles[sub[0]]
+			}
+			state.style = state.style.Underline(ul)
+		case p == 5 || p == 6:
+			state.style = state.style.Blink(true)
 		case p == 7:
-			state.reverse = true
 			state.style = state.style.Reverse(true)
+		case p == 8:
+			state.hidden = true
+		case p == 9:
+			state.style = state.style.StrikeThrough(true)
+		case p == 21:
+			state.style = state.style.Underline(tcell.UnderlineStyleDouble)
+		case p == 22:
+			state.style = state.style.Bold(false).Dim(false)
+		case p == 23:
+			state.style = state.style.Italic(false)
+		case p == 24:
+			state.style = state.style.Underline(false)
+		case p == 25:
+			state.style = state.style.Blink(false)
 		case p == 27:
-			state.reverse = false
 			state.style = state.style.Reverse(false)
+		case p == 28:
+			state.hidden = false
+		case p == 29:
+			state.style = state.style.StrikeThrough(false)
 		case p >= 30 && p <= 37:
 			state.style = state.style.Foreground(ansiBasicColor(p-30, false))
 		case p >= 90 && p <= 97:
@@ -125,43 +205,62 @@ func applySGR(state ansiState, base tcell.Style, params []int) ansiState {
 			state.style = state.style.Background(ansiBasicColor(p-100, true))
 		case p == 49:
 			state.style = state.style.Background(bgBase)
-		case p == 38 || p == 48:
-			if i+1 >= len(params) {
+		case p == 53:
+			state.overline = true
+		case p == 55:
+			state.overline = false
+		case p == 38 || p == 48 || p == 58:
+			color, used, ok := sgrColor(params, i)
+			i += used
+			if !ok {
 				continue
 			}
-			mode := params[i+1]
-			if mode == 5 && i+2 < len(params) {
-				colorIdx := params[i+2]
-				if colorIdx < 0 {
-					colorIdx = 0
-				}
-				if colorIdx > 255 {
-					colorIdx = 255
-				}
-				color := tcell.PaletteColor(colorIdx)
-				if p == 38 {
-					state.style = state.style.Foreground(color)
-				} else {
-					state.style = state.style.Background(color)
-				}
-				i += 2
-			} else if mode == 2 && i+4 < len(params) {
-				r := clamp8(params[i+2])
-				g := clamp8(params[i+3])
-				b := clamp8(params[i+4])
-				color := tcell.NewRGBColor(int32(r), int32(g), int32(b))
-				if p == 38 {
-					state.style = state.style.Foreground(color)
-				} else {
-					state.style = state.style.Background(color)
-				}
-				i += 4
+			switch p {
+			case 38:
+				state.style = state.style.Foreground(color)
+			case 48:
+				state.style = state.style.Background(color)
+			default:
+				state.style = state.style.Underline(color)
 			}
+		case p == 59:
+			state.style = state.style.Underline(tcell.ColorDefault)
 		}
 	}
 	return state
 }
 
+// sgrColor reads the extended colour that starts at params[i], in either
+// the colon form (38:5:n, 38:2::r:g:b, 38:2:r:g:b) or the semicolon form
+// (38;5;n, 38;2;r;g;b). It returns the colour and how many following
+// parameters the semicolon form used up.
+func sgrColor(params []sgrParam, i int) (tcell.Color, int, bool) {
+	if sub := params[i][1:]; len(sub) > 0 {
+		switch {
+		case sub[0] == 5 && len(sub) >= 2:
+			return tcell.PaletteColor(clamp8(sub[1])), 0, true
+		case sub[0] == 2 && len(sub) >= 5:
+			// The colour space id comes before r:g:b and may be empty.
+			rgb := sub[len(sub)-3:]
+			return tcell.NewRGBColor(int32(clamp8(rgb[0])), int32(clamp8(rgb[1])), int32(clamp8(rgb[2]))), 0, true
+		case sub[0] == 2 && len(sub) == 4:
+			return tcell.NewRGBColor(int32(clamp8(sub[1])), int32(clamp8(sub[2])), int32(clamp8(sub[3]))), 0, true
+		}
+		return 0, 0, false
+	}
+	if i+1 >= len(params) {
+		return 0, 0, false
+	}
+	switch mode := params[i+1][0]; {
+	case mode == 5 && i+2 < len(params):
+		return tcell.PaletteColor(clamp8(params[i+2][0])), 2, true
+	case mode == 2 && i+4 < len(params):
+		r, g, b := clamp8(params[i+2][0]), clamp8(params[i+3][0]), clamp8(params[i+4][0])
+		return tcell.NewRGBColor(int32(r), int32(g), int32(b)), 4, true
+	}
+	return 0, 0, false
+}
+
 func ansiBasicColor(index int, bright bool) tcell.Color {
 	switch index {
 	case 0:
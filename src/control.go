@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const controlRetryDelay = 10 * time.Second
+
+var startControlStreamFn = startControlStream
+
+// controlManager keeps one read-only tmux control-mode client per session,
+// since a client only reports %output for the session it is attached to.
+// Panes of a session whose client is live are fed from those notifications;
+// panes of a session whose client failed or has not attached yet keep using
+// capture-pane polling.
+type controlManager struct {
+	mu      sync.Mutex
+	clients map[string]*controlClient
+	retryAt map[string]time.Time
+}
+
+type controlClient struct {
+	target  socketTarget
+	stream  io.ReadCloser
+	mu      sync.Mutex
+	session string
+	panes   map[string]*controlPane
+	exited  bool
+	inBlock bool
+	closing sync.Once
+	done    chan struct{}
+}
+
+// controlTarget is one session a client attaches to.
+type controlTarget struct {
+	socket  socketTarget
+	session string
+}
+
+func (t controlTarget) key() string {
+	return t.socket.key + "\x00" + t.session
+}
+
+type controlPane struct {
+	term  *vterm
+	limit int
+	gen   uint64
+	stale bool
+}
+
+func newControlManager() *controlManager {
+	return &controlManager{
+		clients: map[string]*controlClient{},
+		retryAt: map[string]time.Time{},
+	}
+}
+
+// sync starts clients for newly seen sessions, drops clients for sessions
+// that disappeared and schedules a retry for clients that exited or were
+// moved to another session, as tmux does when their session is destroyed.
+func (m *controlManager) sync(targets []controlTarget) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	wanted := make(map[string]controlTarget, len(targets))
+	for _, target := range targets {
+		wanted[target.key()] = target
+	}
+	for key, client := range m.clients {
+		if _, ok := wanted[key]; !ok {
+			client.close()
+			delete(m.clients, key)
+			continue
+		}
+		if client.isExited() || client.movedFrom(wanted[key].session) {
+			client.close()
+			delete(m.clients, key)
+			m.retryAt[key] = now.Add(controlRetryDelay)
+		}
+	}
+	for key, target := range wanted {
+		if _, ok := m.clients[key]; ok {
+			continue
+		}
+		if until, ok := m.retryAt[key]; ok && now.Before(until) {
+			continue
+		}
+		stream, err := startControlStreamFn(target.socket.path, target.session)
+		if err != nil {
+			m.retryAt[key] = now.Add(controlRetryDelay)
+			continue
+		}
+		delete(m.retryAt, key)
+		client := newControlClient(target.socket, stream)
+		m.clients[key] = client
+		go client.run()
+	}
+}
+
+func (m *controlManager) client(target socketTarget, session string) *controlClient {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client := m.clients[controlTarget{socket: target, session: session}.key()]
+	if client == nil || client.isExited() {
+		return nil
+	}
+	return client
+}
+
+// paneLines returns the streamed lines and screen grid for a pane. ok is
+// false when the pane is not covered by a live client or its terminal needs a
+// fresh capture; gen must then be handed back to seedPane together with that
+// capture.
+func (m *controlManager) paneLines(target socketTarget, session, paneID string, limit int) ([]string, *vtGrid, uint64, bool) {
+	client := m.client(target, session)
+	if client == nil {
+		return nil, nil, 0, false
+	}
+	return client.paneLines(session, paneID, limit)
+}
+
+// covers reports whether a live client streams the given session.
+func (m *controlManager) covers(target socketTarget, session string) bool {
+	client := m.client(target, session)
+	if client == nil {
+		return false
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.session != "" && client.session == session
+}
+
+func (m *controlManager) seedPane(target socketTarget, session string, pane paneInfo, lines []string, screenRows, limit int, gen uint64) {
+	client := m.client(target, session)
+	if client == nil {
+		return
+	}
+	client.seedPane(session, pane, lines, screenRows, limit, gen)
+}
+
+func (m *controlManager) liveCount() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, client := range m.clients {
+		if !client.isExited() {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *controlManager) close() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, client := range m.clients {
+		client.close()
+		delete(m.clients, key)
+	}
+}
+
+func newControlClient(target socketTarget, stream io.ReadCloser) *controlClient {
+	return &controlClient{
+		target: target,
+		stream: stream,
+		panes:  map[string]*controlPane{},
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *controlClient) run() {
+	defer close(c.done)
+	reader := bufio.NewReaderSize(c.stream, 64*1024)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			c.handleLine(strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			c.mu.Lock()
+			c.exited = true
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (c *controlClient) close() {
+	c.closing.Do(func() {
+		_ = c.stream.Close()
+	})
+}
+
+// movedFrom reports whether the client has attached to a session other
+// than session.
+func (c *controlClient) movedFrom(session string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session != "" && c.session != session
+}
+
+func (c *controlClient) isExited() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exited
+}
+
+func (c *controlClient) handleLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.inBlock {
+		if strings.HasPrefix(line, "%end ") || strings.HasPrefix(line, "%error ") {
+			c.inBlock = false
+		}
+		return
+	}
+
+	name, rest, _ := strings.Cut(line, " ")
+	switch name {
+	case "%begin":
+		c.inBlock = true
+	case "%output":
+		paneID, data, ok := strings.Cut(rest, " ")
+		if ok {
+			c.appendOutput(paneID, decodeControlOutput(data))
+		}
+	case "%extended-output":
+		paneID, _, _ := strings.Cut(rest, " ")
+		if idx := strings.Index(rest, " : "); idx >= 0 {
+			c.appendOutput(paneID, decodeControlOutput(rest[idx+3:]))
+		}
+	case "%session-changed":
+		_, sessionName, ok := strings.Cut(rest, " ")
+		if ok && sessionName != c.session {
+			c.session = sessionName
+			c.panes = map[string]*controlPane{}
+		}
+	case "%layout-change", "%window-add", "%window-close", "%unlinked-window-close", "%window-pane-changed", "%sessions-changed":
+		for _, pane := range c.panes {
+			pane.stale = true
+		}
+	case "%exit":
+		c.exited = true
+	}
+}
+
+func (c *controlClient) appendOutput(paneID, data string) {
+	pane, ok := c.panes[paneID]
+	if !ok {
+		pane = &controlPane{stale: true}
+		c.panes[paneID] = pane
+	}
+	pane.gen++
+	if pane.stale {
+		return
+	}
+	pane.term.write(data)
+}
+
+func (c *controlClient) paneLines(session, paneID string, limit int) ([]string, *vtGrid, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exited || c.session == "" || c.session != session {
+		return nil, nil, 0, false
+	}
+	pane, ok := c.panes[paneID]
+	if !ok {
+		return nil, nil, 0, false
+	}
+	if pane.stale || pane.limit != limit {
+		return nil, nil, pane.gen, false
+	}
+	grid := pane.term.snapshot()
+	return pane.term.lines(grid, limit), grid, pane.gen, true
+}
+
+func (c *controlClient) seedPane(session string, info paneInfo, lines []string, screenRows, limit int, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exited || c.session == "" || c.session != session {
+		return
+	}
+	pane, ok := c.panes[info.paneID]
+	if !ok {
+		pane = &controlPane{}
+		c.panes[info.paneID] = pane
+	}
+	pane.limit = limit
+	pane.seed(lines, screenRows, info)
+	// Output that arrived while the capture was running is not part of it.
+	pane.stale = pane.gen != gen
+}
+
+// seed rebuilds the pane's terminal from a capture: the last screenRows
+// lines are loaded onto the screen at the pane's size with the cursor where
+// tmux reports it, everything above becomes history.
+func (p *controlPane) seed(lines []string, screenRows int, info paneInfo) {
+	height := info.height
+	if height <= 0 {
+		height = maxInt(screenRows, 1)
+	}
+	if screenRows <= 0 || screenRows > len(lines) {
+		screenRows = minInt(height, len(lines))
+	}
+	screen := lines[len(lines)-screenRows:]
+	width := info.width
+	if width <= 0 {
+		width = 80
+		for _, line := range screen {
+			width = maxInt(width, ansiVisibleWidth(line))
+		}
+	}
+	p.term = newVTerm(width, height, p.limit)
+	p.term.history = append([]string(nil), lines[:len(lines)-screenRows]...)
+	p.term.altActive = info.alternate
+	p.term.cursorHidden = !info.cursor.visible
+	p.term.loadScreen(screen, info.cursor.x, info.cursor.y)
+}
+
+// decodeControlOutput undoes the octal escaping tmux applies to %output data.
+func decodeControlOutput(data string) string {
+	if !strings.Contains(data, "\\") {
+		return data
+	}
+	var b strings.Builder
+	b.Grow(len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\\' && i+3 < len(data) && isOctal(data[i+1]) && isOctal(data[i+2]) && isOctal(data[i+3]) {
+			b.WriteByte((data[i+1]-'0')<<6 | (data[i+2]-'0')<<3 | (data[i+3] - '0'))
+			i += 3
+			continue
+		}
+		if data[i] == '\\' && i+1 < len(data) && data[i+1] == '\\' {
+			b.WriteByte('\\')
+			i++
+			continue
+		}
+		b.WriteByte(data[i])
+	}
+	return b.String()
+}
+
+func isOctal(b byte) bool {
+	return b >= '0' && b <= '7'
+}
+
+type controlProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func startControlStream(socket, session string) (io.ReadCloser, error) {
+	cmd := exec.Command("tmux", tmuxArgs(socket, "-C", "attach-session", "-r", "-t", session)...)
+	cmd.Env = envWithoutTMUX(os.Environ())
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &controlProcess{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (p *controlProcess) Read(b []byte) (int, error) {
+	return p.stdout.Read(b)
+}
+
+// Close detaches the client: tmux leaves control mode once stdin closes.
+func (p *controlProcess) Close() error {
+	_ = p.stdin.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		_ = p.cmd.Process.Kill()
+		return <-done
+	}
+}
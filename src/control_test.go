@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeControlStream struct {
+	*io.PipeReader
+	w *io.PipeWriter
+}
+
+func newFakeControlStream() *fakeControlStream {
+	r, w := io.Pipe()
+	return &fakeControlStream{PipeReader: r, w: w}
+}
+
+func (f *fakeControlStream) send(t *testing.T, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := io.WriteString(f.w, line+"\n"); err != nil {
+			t.Fatalf("write control line: %v", err)
+		}
+	}
+}
+
+func (f *fakeControlStream) Close() error {
+	_ = f.w.Close()
+	return f.PipeReader.Close()
+}
+
+func stubControlStream(t *testing.T, fn func(socket, session string) (io.ReadCloser, error)) {
+	t.Helper()
+	orig := startControlStreamFn
+	t.Cleanup(func() {
+		startControlStreamFn = orig
+	})
+	startControlStreamFn = fn
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestDecodeControlOutput(t *testing.T) {
+	got := decodeControlOutput(`hi\015\012\033[1mbold\134end`)
+	want := "hi\r\n\x1b[1mbold\\end"
+	if got != want {
+		t.Fatalf("decode = %q, want %q", got, want)
+	}
+}
+
+func TestControlPaneSeedLoadsScreenAtCursor(t *testing.T) {
+	pane := &controlPane{limit: 10}
+	info := paneInfo{paneID: "%1", cursor: paneCursor{x: 2, y: 1, valid: true}, width: 20, height: 3}
+	pane.seed([]string{"history", "top", "$"}, 2, info)
+	pane.term.write("ls\r\nfile\r\n$ ")
+
+	grid := pane.term.snapshot()
+	got := pane.term.lines(grid, 10)
+	want := []string{"history", "top", "$ ls", "file", "$ "}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	if grid.cursorX != 2 || grid.cursorY != 2 {
+		t.Fatalf("cursor = %d,%d", grid.cursorX, grid.cursorY)
+	}
+}
+
+func TestControlPaneSeedTrimsToLimit(t *testing.T) {
+	pane := &controlPane{limit: 3}
+	pane.seed([]string{"a", "b", "c", "d", "e"}, 1, paneInfo{width: 5, height: 1})
+	pane.term.write("\r\nf")
+	grid := pane.term.snapshot()
+	if got := pane.term.lines(grid, 3); !reflect.DeepEqual(got, []string{"d", "e", "f"}) {
+		t.Fatalf("lines = %q", got)
+	}
+}
+
+func TestControlClientStreamsAttachedSession(t *testing.T) {
+	stream := newFakeControlStream()
+	client := newControlClient(makeSocketTarget("/tmp/a.sock"), stream)
+	go client.run()
+	defer client.close()
+
+	stream.send(t,
+		"%begin 1 1 0",
+		"%output %1 ignored",
+		"%end 1 1 0",
+		"%session-changed $0 alpha",
+	)
+	waitFor(t, "session", func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.session == "alpha"
+	})
+
+	if _, _, _, ok := client.paneLines("alpha", "%1", 50); ok {
+		t.Fatalf("unseeded pane should need a capture")
+	}
+	info := paneInfo{paneID: "%1", cursor: paneCursor{x: 2, y: 0, valid: true}, width: 20, height: 3}
+	client.seedPane("alpha", info, []string{"$"}, 1, 50, 0)
+	stream.send(t, `%output %1 ls\015\012file\015\012$ `)
+	waitFor(t, "output", func() bool {
+		lines, _, _, ok := client.paneLines("alpha", "%1", 50)
+		return ok && len(lines) == 3
+	})
+	lines, _, _, _ := client.paneLines("alpha", "%1", 50)
+	if !reflect.DeepEqual(lines, []string{"$ ls", "file", "$ "}) {
+		t.Fatalf("lines = %q", lines)
+	}
+	if _, _, _, ok := client.paneLines("beta", "%1", 50); ok {
+		t.Fatalf("other sessions must not be served from the stream")
+	}
+
+	// Full-screen redraws are applied to the grid instead of forcing a
+	// capture.
+	stream.send(t, `%output %1 \033[?1049h\033[2J\033[2;3Hvim`)
+	waitFor(t, "alternate screen", func() bool {
+		_, grid, _, ok := client.paneLines("alpha", "%1", 50)
+		return ok && grid.alternate
+	})
+	lines, grid, _, _ := client.paneLines("alpha", "%1", 50)
+	if !reflect.DeepEqual(lines, []string{"", "  vim", ""}) || grid.cursorX != 5 || grid.cursorY != 1 {
+		t.Fatalf("alternate lines = %q cursor = %d,%d", lines, grid.cursorX, grid.cursorY)
+	}
+
+	stream.send(t, "%layout-change @0 b25d,80x24,0,0,1 b25d,80x24,0,0,1 *")
+	waitFor(t, "layout stale", func() bool {
+		_, _, _, ok := client.paneLines("alpha", "%1", 50)
+		return !ok
+	})
+
+	stream.send(t, "%exit")
+	waitFor(t, "exit", client.isExited)
+}
+
+func TestUpdateStateUsesControlStreamAndFallsBack(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	socketPath := "/tmp/control.sock"
+	stream := newFakeControlStream()
+	starts := 0
+	stubControlStream(t, func(socket, session string) (io.ReadCloser, error) {
+		if socket != socketPath || session != "alpha" {
+			return nil, errors.New("unexpected target")
+		}
+		starts++
+		return stream, nil
+	})
+
+	captures := 0
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, _ string, args ...string) (string, error) {
+		switch args[0] {
+		case "list-panes":
+			return formatPaneRow(paneInfo{sessionName: "alpha", paneID: "%1", paneActive: true, cursor: paneCursor{x: 2}, width: 20, height: 1}), nil
+		case "capture-pane":
+			captures++
+			return "$\n", nil
+		}
+		return "", errors.New("unexpected command")
+	}
+
+	state := appState{
+		sessions: map[string]sessionView{},
+		scroll:   map[string]int{},
+		follow:   map[string]bool{},
+		control:  newControlManager(),
+	}
+	defer state.control.close()
+	cfg := config{
+		lines:              50,
+		maxWorkers:         1,
+		includeLisaSockets: false,
+		explicitSockets:    []string{socketPath},
+	}
+	key := sessionQualifiedKey(socketPath, "alpha")
+
+	updateState(context.Background(), &state, cfg)
+	if starts != 1 || captures != 1 {
+		t.Fatalf("starts/captures = %d/%d", starts, captures)
+	}
+
+	stream.send(t, "%session-changed $0 alpha")
+	waitFor(t, "session", func() bool {
+		client := state.control.client(makeSocketTarget(socketPath), "alpha")
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.session == "alpha"
+	})
+	updateState(context.Background(), &state, cfg)
+	if captures != 2 {
+		t.Fatalf("seeding capture count = %d", captures)
+	}
+
+	stream.send(t, `%output %1 echo hi\015\012hi\015\012$ `)
+	waitFor(t, "streamed output", func() bool {
+		_, _, _, ok := state.control.paneLines(makeSocketTarget(socketPath), "alpha", "%1", 50)
+		return ok
+	})
+	updateState(context.Background(), &state, cfg)
+	if captures != 2 {
+		t.Fatalf("streamed pane was captured again: %d", captures)
+	}
+	if got := state.sessions[key].lines; !reflect.DeepEqual(got, []string{"$ echo hi", "hi", "$ "}) {
+		t.Fatalf("lines = %q", got)
+	}
+
+	stream.send(t, "%exit")
+	waitFor(t, "exit", func() bool {
+		return state.control.liveCount() == 0
+	})
+	updateState(context.Background(), &state, cfg)
+	if captures != 3 {
+		t.Fatalf("expected polling fallback after exit, captures = %d", captures)
+	}
+	if starts != 1 {
+		t.Fatalf("client restarted before retry delay: %d", starts)
+	}
+	if !strings.Contains(state.sessions[key].lines[0], "$") {
+		t.Fatalf("fallback lines = %q", state.sessions[key].lines)
+	}
+}
+
+func TestControlModeStreamsEverySessionOnASocket(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	socketPath := "/tmp/control.sock"
+	streams := map[string]*fakeControlStream{"alpha": newFakeControlStream(), "beta": newFakeControlStream()}
+	stubControlStream(t, func(socket, session string) (io.ReadCloser, error) {
+		stream, ok := streams[session]
+		if socket != socketPath || !ok {
+			return nil, errors.New("unexpected target")
+		}
+		return stream, nil
+	})
+
+	captured := map[string]int{}
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, _ string, args ...string) (string, error) {
+		switch args[0] {
+		case "list-panes":
+			return paneListOutput(
+				formatPaneRow(paneInfo{sessionName: "alpha", paneID: "%1", paneActive: true, windowActive: true, width: 20, height: 1}),
+				formatPaneRow(paneInfo{sessionName: "beta", paneID: "%2", paneActive: true, windowActive: true, width: 20, height: 1}),
+			), nil
+		case "capture-pane":
+			for i, arg := range args {
+				if arg == "-t" {
+					captured[args[i+1]]++
+				}
+			}
+			return "$\n", nil
+		}
+		return "", errors.New("unexpected command")
+	}
+
+	state := appState{
+		sessions: map[string]sessionView{},
+		scroll:   map[string]int{},
+		follow:   map[string]bool{},
+		control:  newControlManager(),
+	}
+	defer state.control.close()
+	cfg := config{lines: 50, maxWorkers: 1, explicitSockets: []string{socketPath}}
+	target := makeSocketTarget(socketPath)
+
+	updateState(context.Background(), &state, cfg)
+	if state.control.liveCount() != 2 {
+		t.Fatalf("clients = %d, want one per session", state.control.liveCount())
+	}
+
+	// Only alpha's client has attached: its pane is seeded for streaming,
+	// beta's keeps polling.
+	streams["alpha"].send(t, "%session-changed $0 alpha")
+	waitFor(t, "alpha attached", func() bool { return state.control.covers(target, "alpha") })
+	updateState(context.Background(), &state, cfg)
+	streams["alpha"].send(t, `%output %1 one\015\012$ `)
+	waitFor(t, "alpha output", func() bool {
+		_, _, _, ok := state.control.paneLines(target, "alpha", "%1", 50)
+		return ok
+	})
+	before := map[string]int{"%1": captured["%1"], "%2": captured["%2"]}
+	updateState(context.Background(), &state, cfg)
+	if captured["%1"] != before["%1"] || captured["%2"] != before["%2"]+1 {
+		t.Fatalf("captures %v -> %v: alpha should stream, beta poll", before, captured)
+	}
+
+	// Once beta's client attaches, both panes stream.
+	streams["beta"].send(t, "%session-changed $1 beta")
+	waitFor(t, "beta attached", func() bool { return state.control.covers(target, "beta") })
+	updateState(context.Background(), &state, cfg)
+	streams["beta"].send(t, `%output %2 two\015\012$ `)
+	waitFor(t, "beta output", func() bool {
+		_, _, _, ok := state.control.paneLines(target, "beta", "%2", 50)
+		return ok
+	})
+	before = map[string]int{"%1": captured["%1"], "%2": captured["%2"]}
+	updateState(context.Background(), &state, cfg)
+	if captured["%1"] != before["%1"] || captured["%2"] != before["%2"] {
+		t.Fatalf("captures %v -> %v: both sessions should stream", before, captured)
+	}
+	for key, want := range map[string]string{"alpha": "one", "beta": "two"} {
+		if got := state.sessions[sessionQualifiedKey(socketPath, key)].lines; len(got) == 0 || got[0] != want {
+			t.Fatalf("%s lines = %q", key, got)
+		}
+	}
+}
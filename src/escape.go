@@ -0,0 +1,204 @@
+package main
+
+import "strings"
+
+// escKind classifies a token of terminal output.
+type escKind int
+
+const (
+	// escText is a run of printable text.
+	escText escKind = iota
+	// escControl is a single C0 control byte other than ESC.
+	escControl
+	// escCSI is ESC [ parameters intermediates final.
+	escCSI
+	// escOSC is ESC ] payload, ended by BEL or ST.
+	escOSC
+	// escString is a DCS, SOS, PM or APC string; its payload is dropped.
+	escString
+	// escEsc is any other escape: ESC intermediates final.
+	escEsc
+	// escIgnored is a malformed or cancelled sequence, consumed whole.
+	escIgnored
+)
+
+// escToken is one token of terminal output. params holds the CSI parameter
+// bytes or the OSC payload, inter the intermediate bytes.
+type escToken struct {
+	kind   escKind
+	text   string
+	params string
+	inter  string
+	final  byte
+}
+
+const (
+	escCAN = 0x18
+	escSUB = 0x1a
+)
+
+// nextToken scans the token at the start of s and returns it with its
+// length in bytes. It returns false when s ends inside an escape sequence.
+func nextToken(s string) (escToken, int, bool) {
+	if s == "" {
+		return escToken{}, 0, false
+	}
+	switch b := s[0]; {
+	case b == 0x1b:
+		return scanEscape(s)
+	case b < 0x20 || b == 0x7f:
+		return escToken{kind: escControl, final: b}, 1, true
+	}
+	end := 1
+	for end < len(s) && s[end] >= 0x20 && s[end] != 0x7f {
+		end++
+	}
+	return escToken{kind: escText, text: s[:end]}, end, true
+}
+
+// scanEscape runs the escape-sequence state machine over s, which starts
+// with ESC, following the VT500 parser: CAN and SUB cancel a sequence, an
+// ESC inside one starts the next, C0 controls inside a CSI are skipped and
+// parameters after intermediates make the CSI malformed.
+func scanEscape(s string) (escToken, int, bool) {
+	if len(s) < 2 {
+		return escToken{}, 0, false
+	}
+	switch c := s[1]; {
+	case c == '[':
+		return scanCSI(s)
+	case c == ']':
+		return scanString(s, escOSC)
+	case c == 'P' || c == 'X' || c == '^' || c == '_':
+		return scanString(s, escString)
+	case c == escCAN || c == escSUB:
+		return escToken{kind: escIgnored}, 2, true
+	case c == 0x1b:
+		// A lone ESC; the second one starts the next sequence.
+		return escToken{kind: escIgnored}, 1, true
+	case c >= 0x20 && c <= 0x2f:
+		for i := 1; i < len(s); i++ {
+			switch b := s[i]; {
+			case b >= 0x20 && b <= 0x2f:
+				continue
+			case b >= 0x30 && b <= 0x7e:
+				return escToken{kind: escEsc, inter: s[1:i], final: b}, i + 1, true
+			case b == 0x1b:
+				return escToken{kind: escIgnored}, i, true
+			default:
+				return escToken{kind: escIgnored}, i + 1, true
+			}
+		}
+		return escToken{}, 0, false
+	case c >= 0x30 && c <= 0x7e:
+		return escToken{kind: escEsc, final: c}, 2, true
+	}
+	// ESC followed by a control byte or DEL: drop the ESC.
+	return escToken{kind: escIgnored}, 1, true
+}
+
+func scanCSI(s string) (escToken, int, bool) {
+	var params, inter strings.Builder
+	malformed := false
+	for i := 2; i < len(s); i++ {
+		switch b := s[i]; {
+		case b >= 0x30 && b <= 0x3f:
+			if inter.Len() > 0 {
+				malformed = true
+			}
+			params.WriteByte(b)
+		case b >= 0x20 && b <= 0x2f:
+			inter.WriteByte(b)
+		case b >= 0x40 && b <= 0x7e:
+			if malformed {
+				return escToken{kind: escIgnored}, i + 1, true
+			}
+			return escToken{kind: escCSI, params: params.String(), inter: inter.String(), final: b}, i + 1, true
+		case b == escCAN || b == escSUB:
+			return escToken{kind: escIgnored}, i + 1, true
+		case b == 0x1b:
+			return escToken{kind: escIgnored}, i, true
+		case b >= 0x80:
+			malformed = true
+		}
+		// Other C0 controls and DEL are skipped.
+	}
+	return escToken{}, 0, false
+}
+
+// scanString consumes an OSC (ended by BEL or ST) or a DCS, SOS, PM or APC
+// string (ended by ST).
+func scanString(s string, kind escKind) (escToken, int, bool) {
+	for i := 2; i < len(s); i++ {
+		switch s[i] {
+		case '\a':
+			if kind == escOSC {
+				return escToken{kind: kind, params: s[2:i]}, i + 1, true
+			}
+		case escCAN, escSUB:
+			return escToken{kind: escIgnored}, i + 1, true
+		case 0x1b:
+			if i+1 >= len(s) {
+				return escToken{}, 0, false
+			}
+			if s[i+1] == '\\' {
+				return escToken{kind: kind, params: s[2:i]}, i + 2, true
+			}
+			// An ESC that is not ST aborts the string.
+			return escToken{kind: escIgnored}, i, true
+		}
+	}
+	return escToken{}, 0, false
+}
+
+// skipEscape finds the end of a sequence of kind whose start was dropped
+// for being too long, with the same terminators scanCSI and scanString use.
+// It returns how many bytes of s still belong to the sequence and whether
+// it ended there; a trailing ESC, which may start ST, is not counted.
+func skipEscape(s string, kind escKind) (int, bool) {
+	for i := 0; i < len(s); i++ {
+		switch b := s[i]; {
+		case b == escCAN || b == escSUB:
+			return i + 1, true
+		case b == 0x1b:
+			if kind == escCSI {
+				return i, true
+			}
+			if i+1 >= len(s) {
+				return i, false
+			}
+			if s[i+1] == '\\' {
+				return i + 2, true
+			}
+			return i, true
+		case b == '\a' && kind == escOSC:
+			return i + 1, true
+		case kind == escCSI && b >= 0x40 && b <= 0x7e:
+			return i + 1, true
+		}
+	}
+	return len(s), false
+}
+
+// isSGR reports whether t is a Select Graphic Rendition sequence, ESC [ ... m,
+// as opposed to a private-mode sequence with the same final byte.
+func (t escToken) isSGR() bool {
+	if t.kind != escCSI || t.final != 'm' || t.inter != "" {
+		return false
+	}
+	return t.params == "" || !strings.ContainsRune("<=>?", rune(t.params[0]))
+}
+
+// oscHyperlink parses an OSC 8 payload, "8;params;uri". It reports false
+// for other OSC commands; an empty uri ends the current link.
+func oscHyperlink(payload string) (string, bool) {
+	rest, ok := strings.CutPrefix(payload, "8;")
+	if !ok {
+		return "", false
+	}
+	_, uri, ok := strings.Cut(rest, ";")
+	if !ok {
+		return "", false
+	}
+	return uri, true
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestNextTokenConsumesEverySequenceType(t *testing.T) {
+	cases := []struct {
+		in   string
+		want escToken
+		n    int
+	}{
+		{"abc\x1b[m", escToken{kind: escText, text: "abc"}, 3},
+		{"\tx", escToken{kind: escControl, final: '\t'}, 1},
+		{"\x1b[1;31mx", escToken{kind: escCSI, params: "1;31", final: 'm'}, 7},
+		{"\x1b[?25lx", escToken{kind: escCSI, params: "?25", final: 'l'}, 6},
+		{"\x1b[2 qx", escToken{kind: escCSI, params: "2", inter: " ", final: 'q'}, 5},
+		{"\x1b[1\nmx", escToken{kind: escCSI, params: "1", final: 'm'}, 5},
+		{"\x1b[1 2mx", escToken{kind: escIgnored}, 6},
+		{"\x1b[12\x18x", escToken{kind: escIgnored}, 5},
+		{"\x1b[12\x1b[mx", escToken{kind: escIgnored}, 4},
+		{"\x1b]0;title\ax", escToken{kind: escOSC, params: "0;title"}, 10},
+		{"\x1b]8;;http://a\x1b\\x", escToken{kind: escOSC, params: "8;;http://a"}, 15},
+		{"\x1b]0;t\x1bcx", escToken{kind: escIgnored}, 5},
+		{"\x1bPq#0;1\x1b\\x", escToken{kind: escString, params: "q#0;1"}, 9},
+		{"\x1b_apc\ax\x1b\\", escToken{kind: escString, params: "apc\ax"}, 9},
+		{"\x1b(Bx", escToken{kind: escEsc, inter: "(", final: 'B'}, 3},
+		{"\x1b#8x", escToken{kind: escEsc, inter: "#", final: '8'}, 3},
+		{"\x1b7x", escToken{kind: escEsc, final: '7'}, 2},
+		{"\x1b\x1b[m", escToken{kind: escIgnored}, 1},
+	}
+	for _, c := range cases {
+		tok, n, ok := nextToken(c.in)
+		if !ok || n != c.n || !reflect.DeepEqual(tok, c.want) {
+			t.Fatalf("nextToken(%q) = %+v, %d, %t; want %+v, %d", c.in, tok, n, ok, c.want, c.n)
+		}
+	}
+	for _, partial := range []string{"\x1b", "\x1b[1;3", "\x1b]8;;http", "\x1bP1", "\x1b]0;t\x1b", "\x1b("} {
+		if _, _, ok := nextToken(partial); ok {
+			t.Fatalf("nextToken(%q) completed", partial)
+		}
+	}
+	if ansiVisibleWidth("\x1b]8;;http://a\x1b\\link\x1b]8;;\x1b\\ \x1b[?2004h") != 5 {
+		t.Fatalf("ansiVisibleWidth counted escape sequences")
+	}
+}
+
+func TestDrawAnsiTextDropsNonSGRSequencesAndKeepsLinks(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 1)
+
+	text := "\x1b[?25l\x1b(Ba\x1b]0;title\a\x1bPq#0\x1b\\b\x1b[>4;2mc \x1b]8;id=1;https://example.com\x1b\\ex\x1b[1mam\x1b[0mple\x1b]8;;\x1b\\!"
+	drawAnsiText(screen, 0, 0, 20, text, tcell.StyleDefault)
+	if row := readScreenRow(screen, 0, 20); row != "abc example!        " {
+		t.Fatalf("row = %q", row)
+	}
+	if _, style, _ := screen.Get(2, 0); style != tcell.StyleDefault {
+		t.Fatalf("private CSI > m changed the style: %+v", style)
+	}
+	link := tcell.StyleDefault.Url("https://example.com")
+	for x, want := range map[int]tcell.Style{4: link, 6: link.Bold(true), 8: link, 11: tcell.StyleDefault} {
+		if _, style, _ := screen.Get(x, 0); style != want {
+			t.Fatalf("style at %d = %+v, want %+v", x, style, want)
+		}
+	}
+}
+
+func TestVTermKeepsHyperlinks(t *testing.T) {
+	term := newVTerm(12, 2, 0)
+	term.write("a\x1b]8;;http://x\x07link\x1b]8;;\x07b")
+	row := term.snapshot().rows[0]
+	if row[1].link != "http://x" || row[4].link != "http://x" || row[5].link != "" {
+		t.Fatalf("links = %q %q %q", row[1].link, row[4].link, row[5].link)
+	}
+	if got := vtRowString(row); got != "a\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\b" {
+		t.Fatalf("row string = %q", got)
+	}
+
+	// Sequences split across writes are completed from the pending bytes.
+	term.write("\x1b]8;;http://y\x1b")
+	term.write("\\z")
+	if cell := term.snapshot().rows[0][6]; cell.ch != 'z' || cell.link != "http://y" {
+		t.Fatalf("split OSC 8 = %+v", cell)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	healthBaseBackoff = 2 * time.Second
+	healthMaxBackoff  = time.Minute
+	// healthBreakerThreshold consecutive failures open the circuit: the
+	// socket is skipped for healthOpenPeriod, then half-open, when a single
+	// probe is let through. A successful probe closes the circuit, a failed
+	// one opens it again.
+	healthBreakerThreshold = 3
+	healthOpenPeriod       = healthMaxBackoff
+)
+
+// socketHealth is the record kept for one socket target.
+type socketHealth struct {
+	target      socketTarget
+	lastSuccess time.Time
+	lastAttempt time.Time
+	failures    int
+	lastErr     string
+	nextRetry   time.Time
+	unavailable bool
+	panes       int
+	// probing is set while the half-open probe is outstanding.
+	probing bool
+}
+
+// healthTracker records discovery outcomes per socket and decides when a
+// failing socket may be queried again. Timeouts and other errors back off
+// exponentially; sockets without a running server fail fast and are retried
+// every tick so a restarted server shows up promptly.
+type healthTracker struct {
+	mu      sync.Mutex
+	sockets map[string]*socketHealth
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{sockets: map[string]*socketHealth{}}
+}
+
+// allow reports whether target may be queried at now. Once an open
+// circuit's period is over, only the first caller gets through as the
+// probe; should its result never be recorded, another probe is allowed
+// after healthBaseBackoff.
+func (h *healthTracker) allow(target socketTarget, now time.Time) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec, ok := h.sockets[target.key]
+	if !ok || now.Before(rec.nextRetry) {
+		return !ok
+	}
+	if rec.open() {
+		rec.probing = true
+		rec.nextRetry = now.Add(healthBaseBackoff)
+	}
+	return true
+}
+
+func (h *healthTracker) record(target socketTarget) *socketHealth {
+	rec, ok := h.sockets[target.key]
+	if !ok {
+		rec = &socketHealth{}
+		h.sockets[target.key] = rec
+	}
+	rec.target = target
+	return rec
+}
+
+func (h *healthTracker) success(target socketTarget, panes int, now time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec := h.record(target)
+	rec.lastSuccess = now
+	rec.lastAttempt = now
+	rec.failures = 0
+	rec.lastErr = ""
+	rec.nextRetry = time.Time{}
+	rec.unavailable = false
+	rec.panes = panes
+	rec.probing = false
+}
+
+func (h *healthTracker) failure(target socketTarget, err error, now time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec := h.record(target)
+	rec.lastAttempt = now
+	rec.failures++
+	rec.lastErr = err.Error()
+	rec.panes = 0
+	rec.probing = false
+	rec.unavailable = isSocketUnavailableError(err)
+	switch {
+	case rec.unavailable:
+		rec.nextRetry = time.Time{}
+	case rec.open():
+		rec.nextRetry = now.Add(healthOpenPeriod)
+	default:
+		rec.nextRetry = now.Add(healthBackoff(rec.failures))
+	}
+}
+
+// open reports whether the socket's circuit is open (or half-open).
+func (rec socketHealth) open() bool {
+	return !rec.unavailable && rec.failures >= healthBreakerThreshold
+}
+
+func healthBackoff(failures int) time.Duration {
+	backoff := healthBaseBackoff
+	for i := 1; i < failures && backoff < healthMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > healthMaxBackoff {
+		backoff = healthMaxBackoff
+	}
+	return backoff
+}
+
+// prune forgets sockets that are no longer discovered.
+func (h *healthTracker) prune(targets []socketTarget) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keep := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		keep[target.key] = struct{}{}
+	}
+	for key := range h.sockets {
+		if _, ok := keep[key]; !ok {
+			delete(h.sockets, key)
+		}
+	}
+}
+
+// snapshot returns a copy of every record, ordered by socket hint.
+func (h *healthTracker) snapshot() []socketHealth {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]socketHealth, 0, len(h.sockets))
+	for _, rec := range h.sockets {
+		out = append(out, *rec)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].target.hint == out[j].target.hint {
+			return out[i].target.key < out[j].target.key
+		}
+		return out[i].target.hint < out[j].target.hint
+	})
+	return out
+}
+
+// unhealthy counts sockets whose last query failed for a reason other than
+// a missing server.
+func (h *healthTracker) unhealthy() int {
+	count := 0
+	for _, rec := range h.snapshot() {
+		if rec.failures > 0 && !rec.unavailable {
+			count++
+		}
+	}
+	return count
+}
+
+func (rec socketHealth) status() string {
+	switch {
+	case rec.failures == 0:
+		return "ok"
+	case rec.unavailable:
+		return "down"
+	case rec.open() && rec.probing:
+		return "half-open"
+	case rec.open():
+		return "open"
+	default:
+		return "backoff"
+	}
+}
+
+// summary is the one-line description shown in the socket overview.
+func (rec socketHealth) summary(now time.Time) string {
+	name := rec.target.hint
+	if rec.target.path != "" {
+		name += " " + rec.target.path
+	}
+	line := fmt.Sprintf("%-9s %s  panes:%d", rec.status(), name, rec.panes)
+	if !rec.lastSuccess.IsZero() {
+		line += fmt.Sprintf("  ok %s ago", now.Sub(rec.lastSuccess).Truncate(time.Second))
+	}
+	if rec.failures > 0 {
+		line += fmt.Sprintf("  failures:%d", rec.failures)
+	}
+	if rec.nextRetry.After(now) {
+		line += fmt.Sprintf("  retry in %s", rec.nextRetry.Sub(now).Truncate(100*time.Millisecond))
+	}
+	if rec.lastErr != "" {
+		line += "  " + rec.lastErr
+	}
+	return line
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestHealthTrackerBacksOffAndOpensCircuit(t *testing.T) {
+	health := newHealthTracker()
+	target := makeSocketTarget("/tmp/wedged.sock")
+	now := time.Unix(1000, 0)
+	fail := func(at time.Time) socketHealth {
+		health.failure(target, errors.New("context deadline exceeded"), at)
+		return health.snapshot()[0]
+	}
+
+	if !health.allow(target, now) {
+		t.Fatalf("unknown socket must be allowed")
+	}
+	for i := 1; i < healthBreakerThreshold; i++ {
+		rec := fail(now)
+		if rec.status() != "backoff" || rec.nextRetry.Sub(now) != healthBackoff(i) || health.allow(target, now) {
+			t.Fatalf("failure %d: status %q, retry in %s", i, rec.status(), rec.nextRetry.Sub(now))
+		}
+	}
+	if healthBackoff(2) != 2*healthBaseBackoff || healthBackoff(100) != healthMaxBackoff {
+		t.Fatalf("backoff = %s / %s", healthBackoff(2), healthBackoff(100))
+	}
+
+	// The circuit opens: skipped for the whole open period.
+	rec := fail(now)
+	if rec.status() != "open" || rec.nextRetry.Sub(now) != healthOpenPeriod || health.allow(target, now.Add(healthOpenPeriod-time.Second)) {
+		t.Fatalf("open: status %q, retry in %s", rec.status(), rec.nextRetry.Sub(now))
+	}
+	if health.unhealthy() != 1 {
+		t.Fatalf("unhealthy = %d", health.unhealthy())
+	}
+
+	// Half-open: one probe goes through, the next caller is held back.
+	now = now.Add(healthOpenPeriod)
+	if !health.allow(target, now) || health.snapshot()[0].status() != "half-open" {
+		t.Fatalf("half-open probe not allowed")
+	}
+	if health.allow(target, now) {
+		t.Fatalf("second probe allowed while the first is outstanding")
+	}
+	if !health.allow(target, now.Add(healthBaseBackoff)) {
+		t.Fatalf("lost probe was never retried")
+	}
+
+	// A failed probe opens the circuit again.
+	if rec := fail(now); rec.status() != "open" || rec.nextRetry.Sub(now) != healthOpenPeriod {
+		t.Fatalf("after failed probe: status %q, retry in %s", rec.status(), rec.nextRetry.Sub(now))
+	}
+
+	// A successful probe closes it.
+	now = now.Add(healthOpenPeriod)
+	if !health.allow(target, now) {
+		t.Fatalf("second half-open probe not allowed")
+	}
+	health.success(target, 3, now)
+	rec = health.snapshot()[0]
+	if rec.status() != "ok" || rec.failures != 0 || rec.panes != 3 || !health.allow(target, now) || !health.allow(target, now) {
+		t.Fatalf("record after success = %+v", rec)
+	}
+}
+
+func TestHealthTrackerRetriesMissingServersImmediately(t *testing.T) {
+	health := newHealthTracker()
+	target := makeSocketTarget("/tmp/stale.sock")
+	now := time.Unix(1000, 0)
+
+	health.failure(target, errors.New("no server running on /tmp/stale.sock"), now)
+	if !health.allow(target, now) {
+		t.Fatalf("missing server should not back off")
+	}
+	if status := health.snapshot()[0].status(); status != "down" {
+		t.Fatalf("status = %q", status)
+	}
+	if health.unhealthy() != 0 {
+		t.Fatalf("missing servers must not count as failing")
+	}
+}
+
+func TestUpdateStateSkipsSocketsInBackoff(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	calls := map[string]int{}
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, socketPath string, args ...string) (string, error) {
+		if args[0] == "list-panes" {
+			calls[socketPath]++
+			if socketPath == "/tmp/wedged.sock" {
+				return "", errors.New("context deadline exceeded")
+			}
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
+		}
+		return fakeTmuxChain(args, func(paneID string) *fakeTmuxPane {
+			return &fakeTmuxPane{screen: []string{"content of " + paneID}}
+		})
+	}
+
+	state := appState{
+		sessions: map[string]sessionView{},
+		scroll:   map[string]int{},
+		follow:   map[string]bool{},
+		health:   newHealthTracker(),
+	}
+	cfg := config{lines: 50, maxWorkers: 1, explicitSockets: []string{"/tmp/good.sock", "/tmp/wedged.sock"}}
+
+	updateState(context.Background(), &state, cfg)
+	updateState(context.Background(), &state, cfg)
+	if calls["/tmp/wedged.sock"] != 1 || calls["/tmp/good.sock"] != 2 {
+		t.Fatalf("calls = %v", calls)
+	}
+	if len(state.sessions) != 1 {
+		t.Fatalf("sessions = %d", len(state.sessions))
+	}
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(100, 10)
+	state.showSockets = true
+	draw(screen, state, cfg)
+	if row := readScreenRow(screen, 2, 100); !strings.Contains(row, "ok") || !strings.Contains(row, "good.sock") {
+		t.Fatalf("overview row 2 = %q", row)
+	}
+	if row := readScreenRow(screen, 3, 100); !strings.Contains(row, "backoff") || !strings.Contains(row, "context deadline exceeded") {
+		t.Fatalf("overview row 3 = %q", row)
+	}
+	if status := readScreenRow(screen, 9, 100); !strings.Contains(status, "sockets:2 (1 failing)") {
+		t.Fatalf("status = %q", status)
+	}
+}
@@ -1,28 +1,12 @@
 package main
 
-import "sort"
-
+// orderedSessionNames returns the view keys in display order: the
+// socket → session → window → pane hierarchy flattened depth first.
 func orderedSessionNames(state appState) []string {
 	names := make([]string, 0, len(state.sessions))
-	for name := range state.sessions {
-		names = append(names, name)
+	for _, socket := range buildHierarchy(state.sessions) {
+		names = append(names, socket.panes()...)
 	}
-	sort.Slice(names, func(i, j int) bool {
-		left, lok := state.sessions[names[i]]
-		right, rok := state.sessions[names[j]]
-		if !lok || !rok {
-			return names[i] < names[j]
-		}
-		if left.name == right.name {
-			leftSocket := socketKey(left.socketPath)
-			rightSocket := socketKey(right.socketPath)
-			if leftSocket == rightSocket {
-				return names[i] < names[j]
-			}
-			return leftSocket < rightSocket
-		}
-		return left.name < right.name
-	})
 	return names
 }
 
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// navLevel is the level of the socket → session → window → pane hierarchy
+// that focus movement steps through.
+type navLevel int
+
+const (
+	navPane navLevel = iota
+	navWindow
+	navSession
+	navSocket
+)
+
+func (l navLevel) String() string {
+	switch l {
+	case navWindow:
+		return "window"
+	case navSession:
+		return "session"
+	case navSocket:
+		return "socket"
+	default:
+		return "pane"
+	}
+}
+
+// parent returns the next level up, wrapping from socket back to pane.
+func (l navLevel) parent() navLevel {
+	if l >= navSocket {
+		return navPane
+	}
+	return l + 1
+}
+
+type socketNode struct {
+	key      string
+	hint     string
+	sessions []*sessionNode
+}
+
+type sessionNode struct {
+	name    string
+	socket  *socketNode
+	windows []*windowNode
+}
+
+type windowNode struct {
+	index   int
+	name    string
+	active  bool
+	session *sessionNode
+	// panes holds view keys in pane index order.
+	panes []string
+}
+
+// panePath is where a pane sits in the hierarchy; it orders views and refs
+// the same way the tree does.
+type panePath struct {
+	socket  string
+	session string
+	window  int
+	pane    int
+	key     string
+	paneID  string
+}
+
+func viewPath(key string, sess sessionView) panePath {
+	return panePath{socket: socketKey(sess.socketPath), session: sess.name, window: sess.windowIndex, pane: sess.paneIndex, key: key, paneID: sess.paneID}
+}
+
+func refPath(ref sessionRef) panePath {
+	return panePath{socket: ref.socket.key, session: ref.name, window: ref.pane.windowIndex, pane: ref.pane.paneIndex, key: ref.key, paneID: ref.paneID}
+}
+
+func (p panePath) less(o panePath) bool {
+	switch {
+	case p.socket != o.socket:
+		return p.socket < o.socket
+	case p.session != o.session:
+		return p.session < o.session
+	case p.window != o.window:
+		return p.window < o.window
+	case p.pane != o.pane:
+		return p.pane < o.pane
+	case p.paneID != o.paneID:
+		return p.paneID < o.paneID
+	default:
+		return p.key < o.key
+	}
+}
+
+// buildHierarchy groups views into sockets, sessions and windows, each level
+// in display order.
+func buildHierarchy(sessions map[string]sessionView) []*socketNode {
+	keys := make([]string, 0, len(sessions))
+	for key := range sessions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return viewPath(keys[i], sessions[keys[i]]).less(viewPath(keys[j], sessions[keys[j]]))
+	})
+
+	var sockets []*socketNode
+	var socket *socketNode
+	var session *sessionNode
+	var window *windowNode
+	for _, key := range keys {
+		sess := sessions[key]
+		path := viewPath(key, sess)
+		if socket == nil || socket.key != path.socket {
+			socket = &socketNode{key: path.socket, hint: sess.socketHint}
+			sockets = append(sockets, socket)
+			session = nil
+		}
+		if session == nil || session.name != sess.name {
+			session = &sessionNode{name: sess.name, socket: socket}
+			socket.sessions = append(socket.sessions, session)
+			window = nil
+		}
+		if window == nil || window.index != sess.windowIndex {
+			window = &windowNode{index: sess.windowIndex, name: sess.windowName, session: session}
+			session.windows = append(session.windows, window)
+		}
+		window.active = window.active || sess.windowActive
+		window.panes = append(window.panes, key)
+	}
+	return sockets
+}
+
+// panes lists the view keys below a node in display order.
+func (s *socketNode) panes() []string {
+	var keys []string
+	for _, session := range s.sessions {
+		keys = append(keys, session.panes()...)
+	}
+	return keys
+}
+
+func (s *sessionNode) panes() []string {
+	var keys []string
+	for _, window := range s.windows {
+		keys = append(keys, window.panes...)
+	}
+	return keys
+}
+
+// paneTitle is the header label of a view: session:window.pane followed by
+// the window name.
+func paneTitle(sess sessionView) string {
+	title := fmt.Sprintf("%s:%d.%d", sess.name, sess.windowIndex, sess.paneIndex)
+	if sess.windowName != "" {
+		title += " " + sess.windowName
+	}
+	return title
+}
+
+// levelGroups splits the ordered view keys into the groups focus steps
+// between at level: single panes, windows, sessions or sockets.
+func levelGroups(sessions map[string]sessionView, level navLevel) [][]string {
+	var groups [][]string
+	for _, socket := range buildHierarchy(sessions) {
+		if level == navSocket {
+			groups = append(groups, socket.panes())
+			continue
+		}
+		for _, session := range socket.sessions {
+			if level == navSession {
+				groups = append(groups, session.panes())
+				continue
+			}
+			for _, window := range session.windows {
+				if level == navWindow {
+					groups = append(groups, window.panes)
+					continue
+				}
+				for _, key := range window.panes {
+					groups = append(groups, []string{key})
+				}
+			}
+		}
+	}
+	return groups
+}
+
+// groupEntry picks the pane to focus when entering a group: the active pane
+// of its active window, or its first pane.
+func groupEntry(sessions map[string]sessionView, group []string) string {
+	for _, key := range group {
+		sess := sessions[key]
+		if sess.windowActive && sess.paneActive {
+			return key
+		}
+	}
+	for _, key := range group {
+		if sessions[key].paneActive {
+			return key
+		}
+	}
+	return group[0]
+}
+
+// focusGroup returns the index of the group holding key, or -1.
+func focusGroup(groups [][]string, key string) int {
+	for i, group := range groups {
+		for _, k := range group {
+			if k == key {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func hierarchyState() appState {
+	pane := func(socket, session string, window, index int, active bool) sessionView {
+		return sessionView{
+			name:         session,
+			socketPath:   socket,
+			windowIndex:  window,
+			windowActive: window == 1,
+			paneIndex:    index,
+			paneActive:   active,
+		}
+	}
+	return appState{sessions: map[string]sessionView{
+		"b.1.0": pane("/tmp/b.sock", "beta", 1, 0, true),
+		"a.2.0": pane("/tmp/a.sock", "alpha", 2, 0, true),
+		"a.1.1": pane("/tmp/a.sock", "alpha", 1, 1, true),
+		"a.1.0": pane("/tmp/a.sock", "alpha", 1, 0, false),
+		"g.1.0": pane("/tmp/a.sock", "gamma", 1, 0, true),
+	}}
+}
+
+func TestBuildHierarchyOrdersBySocketSessionWindowPane(t *testing.T) {
+	state := hierarchyState()
+	tree := buildHierarchy(state.sessions)
+	if len(tree) != 2 || len(tree[0].sessions) != 2 || len(tree[0].sessions[0].windows) != 2 {
+		t.Fatalf("tree shape = %d sockets", len(tree))
+	}
+	if w := tree[0].sessions[0].windows[0]; w.index != 1 || !w.active || !reflect.DeepEqual(w.panes, []string{"a.1.0", "a.1.1"}) {
+		t.Fatalf("first window = %+v", w)
+	}
+	want := []string{"a.1.0", "a.1.1", "a.2.0", "g.1.0", "b.1.0"}
+	if got := orderedSessionNames(state); !reflect.DeepEqual(got, want) {
+		t.Fatalf("orderedSessionNames = %v, want %v", got, want)
+	}
+	if got := levelGroups(state.sessions, navSession); len(got) != 3 || len(got[0]) != 3 {
+		t.Fatalf("session groups = %v", got)
+	}
+}
+
+func TestMoveFocusBetweenLevels(t *testing.T) {
+	state := hierarchyState()
+	focusKey(&state, "a.1.0")
+
+	moveWithinParent(&state, navWindow, 1)
+	if state.focusName != "a.2.0" {
+		t.Fatalf("next window = %q", state.focusName)
+	}
+	moveWithinParent(&state, navWindow, 1)
+	if state.focusName != "a.1.1" {
+		t.Fatalf("next window wraps to the active pane of window 1, got %q", state.focusName)
+	}
+	moveWithinParent(&state, navSession, 1)
+	if state.focusName != "g.1.0" {
+		t.Fatalf("next session on socket = %q", state.focusName)
+	}
+	moveWithinParent(&state, navSession, 1)
+	if state.focusName != "a.1.1" {
+		t.Fatalf("sessions wrap within the socket, got %q", state.focusName)
+	}
+	moveFocusLevel(&state, navSocket, 1)
+	if state.focusName != "b.1.0" || state.focusIndex != 4 {
+		t.Fatalf("next socket = %q/%d", state.focusName, state.focusIndex)
+	}
+
+	level := navPane
+	for _, want := range []navLevel{navWindow, navSession, navSocket, navPane} {
+		level = level.parent()
+		if level != want {
+			t.Fatalf("parent level = %v, want %v", level, want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/gdamore/tcell/v2"
@@ -13,98 +14,105 @@ import (
 
 func startCompose(state *appState) {
 	state.composeActive = true
+	state.composeMarked = false
 	state.selectTarget = false
 	state.sendKeyActive = false
 	state.composeBuf = nil
 }
 
-func isCtrlS(ev *tcell.EventKey) bool {
-	if ev.Key() == tcell.KeyCtrlS {
-		return true
-	}
-	if ev.Key() == tcell.KeyRune && ev.Modifiers()&tcell.ModCtrl != 0 {
-		return ev.Rune() == 's' || ev.Rune() == 'S'
-	}
-	return false
+// startComposeMarked starts compose with every key fanned out to the
+// marked panes instead of the focused one.
+func startComposeMarked(state *appState) error {
+	if len(markedKeys(*state)) == 0 {
+		return errors.New("no marked panes (x marks the focused pane)")
+	}
+	startCompose(state)
+	state.composeMarked = true
+	return nil
 }
 
 func startSendKey(state *appState) {
 	state.sendKeyActive = true
 	state.composeActive = false
+	state.composeMarked = false
 	state.selectTarget = false
 }
 
-func handleComposeKey(ctx context.Context, state *appState, cfg config, ev *tcell.EventKey) bool {
-	if isCtrlS(ev) {
-		state.composeActive = false
-		state.selectTarget = false
-		state.composeBuf = nil
-		return true
+// toggleMark marks or unmarks the focused pane for synchronized typing.
+func toggleMark(state *appState) {
+	key := focusedKey(*state)
+	if key == "" {
+		return
 	}
-	key, literal, ok := tmuxKeyFromEvent(ev)
-	if !ok {
-		return false
+	if state.marked[key] {
+		delete(state.marked, key)
+		return
 	}
-	if err := sendKeyToFocused(ctx, state, cfg, key, literal); err != nil {
-		state.lastErr = err.Error()
+	if state.marked == nil {
+		state.marked = map[string]bool{}
 	}
-	return true
+	state.marked[key] = true
 }
 
-func handleSelectKey(ctx context.Context, state *appState, cfg config, ev *tcell.EventKey, screen tcell.Screen) bool {
-	switch ev.Key() {
-	case tcell.KeyEsc:
-		if err := sendKeyToFocused(ctx, state, cfg, "Escape", false); err != nil {
-			state.lastErr = err.Error()
+// markedKeys returns the marked panes that still exist, in display order.
+func markedKeys(state appState) []string {
+	var keys []string
+	for _, key := range orderedSessionNames(state) {
+		if state.marked[key] {
+			keys = append(keys, key)
 		}
-		return true
-	case tcell.KeyCtrlS:
-		state.selectTarget = false
-		return true
-	case tcell.KeyEnter:
-		if err := sendComposeToFocused(ctx, state, cfg); err != nil {
-			state.lastErr = err.Error()
-		}
-		return true
-	case tcell.KeyTAB:
-		moveFocus(state, 1)
-		return true
-	case tcell.KeyBacktab:
-		moveFocus(state, -1)
-		return true
-	case tcell.KeyUp:
-		moveFocus(state, -1)
-		return true
-	case tcell.KeyDown:
-		moveFocus(state, 1)
-		return true
-	case tcell.KeyCtrlC:
-		if err := sendKeyToFocused(ctx, state, cfg, "C-c", false); err != nil {
-			state.lastErr = err.Error()
-		}
-		return true
-	case tcell.KeyRune:
-		r := ev.Rune()
-		if r >= '1' && r <= '9' {
-			names := orderedSessionNames(*state)
-			idx := int(r - '1')
-			if idx >= 0 && idx < len(names) {
-				state.focusIndex = idx
-				state.focusName = names[idx]
+	}
+	return keys
+}
+
+// sendKeyToMarked sends key to every marked pane, whatever socket it is on.
+func sendKeyToMarked(ctx context.Context, state *appState, cfg config, key string, literal bool) []error {
+	args := []string{key}
+	if literal {
+		args = []string{"-l", key}
+	}
+	return eachMarkedPane(ctx, state, cfg, func(sess sessionView, paneID string) error {
+		_, err := runTmuxOnSocketFn(ctx, cfg, sess.socketPath, append([]string{"send-keys", "-t", paneID}, args...)...)
+		return err
+	})
+}
+
+// eachMarkedPane runs fn for every marked pane. The panes are handled
+// concurrently so one wedged server does not hold up the rest, and each
+// pane that fails gets its own error.
+func eachMarkedPane(ctx context.Context, state *appState, cfg config, fn func(sess sessionView, paneID string) error) []error {
+	keys := markedKeys(*state)
+	if len(keys) == 0 {
+		return []error{errors.New("no marked panes")}
+	}
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		sess := state.sessions[k]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paneID := sess.paneID
+			if paneID == "" {
+				var err error
+				if paneID, err = activePaneID(ctx, cfg, sess.socketPath, sess.name); err != nil {
+					errs[i] = fmt.Errorf("%s: %w", paneTitle(sess), err)
+					return
+				}
 			}
-			return true
-		}
-		if r == 'n' || r == 'N' {
-			moveFocus(state, 1)
-			return true
-		}
-		if r == 'p' || r == 'P' {
-			moveFocus(state, -1)
-			return true
+			if err := fn(sess, paneID); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", paneTitle(sess), err)
+			}
+		}()
+	}
+	wg.Wait()
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
 		}
 	}
-	_ = screen
-	return false
+	return failed
 }
 
 func handleSelectMouse(ctx context.Context, state *appState, cfg config, ev *tcell.EventMouse, screen tcell.Screen) bool {
@@ -112,7 +120,7 @@ func handleSelectMouse(ctx context.Context, state *appState, cfg config, ev *tce
 		return false
 	}
 	x, y := ev.Position()
-	idx := sessionIndexAt(screen, len(state.sessions), x, y)
+	idx := viewIndexAt(*state, screen, x, y)
 	if idx < 0 {
 		return false
 	}
@@ -123,7 +131,7 @@ func handleSelectMouse(ctx context.Context, state *appState, cfg config, ev *tce
 	state.focusIndex = idx
 	state.focusName = names[idx]
 	if err := sendComposeToFocused(ctx, state, cfg); err != nil {
-		state.lastErr = err.Error()
+		showToast(state, "error", err.Error())
 	}
 	return true
 }
@@ -196,22 +204,6 @@ func killFocusedSession(ctx context.Context, state *appState, cfg config) error
 	return nil
 }
 
-func handleSendKey(ctx context.Context, state *appState, cfg config, ev *tcell.EventKey) bool {
-	if isCtrlS(ev) {
-		state.sendKeyActive = false
-		return true
-	}
-	key, literal, ok := tmuxKeyFromEvent(ev)
-	if !ok {
-		return false
-	}
-	if err := sendKeyToFocused(ctx, state, cfg, key, literal); err != nil {
-		state.lastErr = err.Error()
-	}
-	state.sendKeyActive = false
-	return true
-}
-
 func tmuxKeyFromEvent(ev *tcell.EventKey) (string, bool, bool) {
 	switch ev.Key() {
 	case tcell.KeyEsc:
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gdamore/tcell/v2"
@@ -63,6 +66,85 @@ func TestActionRoutingUsesSessionSocket(t *testing.T) {
 	}
 }
 
+func TestComposeMarkedFansOutPerPane(t *testing.T) {
+	pane := func(socket, name, id string) sessionView {
+		return sessionView{key: sessionQualifiedKey(socket, name), name: name, socketPath: socket, paneID: id}
+	}
+	alpha, beta, gamma := pane("/tmp/a.sock", "alpha", "%1"), pane("/tmp/a.sock", "beta", "%2"), pane("/tmp/b.sock", "gamma", "%7")
+	state := appState{sessions: map[string]sessionView{alpha.key: alpha, beta.key: beta, gamma.key: gamma}}
+	cfg := config{}
+
+	var mu sync.Mutex
+	var calls []string
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() { runTmuxOnSocketFn = origRun })
+	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, socket+"|"+strings.Join(args, " "))
+		if socket == "/tmp/b.sock" {
+			return "", errors.New("no server running")
+		}
+		return "", nil
+	}
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
+	press := func(key tcell.Key, r rune) {
+		t.Helper()
+		dispatchKey(&keys, tcell.NewEventKey(key, r, tcell.ModNone))
+	}
+
+	press(tcell.KeyRune, 'b')
+	if state.composeActive || len(state.toasts) != 1 || !strings.Contains(state.toasts[0].text, "no marked panes") {
+		t.Fatalf("b without marks: compose=%v toasts=%+v", state.composeActive, state.toasts)
+	}
+	state.toasts = nil
+
+	// Mark alpha and gamma; marking beta twice leaves it unmarked.
+	press(tcell.KeyRune, 'x')
+	press(tcell.KeyTab, 0)
+	press(tcell.KeyRune, 'x')
+	press(tcell.KeyRune, 'x')
+	press(tcell.KeyTab, 0)
+	press(tcell.KeyRune, 'x')
+	if got := strings.Join(markedKeys(state), " "); got != alpha.key+" "+gamma.key {
+		t.Fatalf("marked = %q", got)
+	}
+
+	screen := newTextScreen(t, 60, 10)
+	draw(screen, state, config{statusLeft: "mode,marks"})
+	if row := readScreenRow(screen, 9, 60); !strings.Contains(row, "marked:2") {
+		t.Fatalf("status = %q", row)
+	}
+	if top := readScreenRow(screen, 0, 60); !strings.Contains(top, "●") {
+		t.Fatalf("marked cell has no marker: %q", top)
+	}
+
+	press(tcell.KeyRune, 'b')
+	press(tcell.KeyRune, 'h')
+	press(tcell.KeyEnter, 0)
+	sort.Strings(calls)
+	want := []string{
+		"/tmp/a.sock|send-keys -t %1 -l h",
+		"/tmp/a.sock|send-keys -t %1 Enter",
+		"/tmp/b.sock|send-keys -t %7 -l h",
+		"/tmp/b.sock|send-keys -t %7 Enter",
+	}
+	sort.Strings(want)
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("calls =\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+	// Each key reports the failing pane on its own and still reaches the rest.
+	if len(state.toasts) != 2 || !strings.HasPrefix(state.toasts[0].text, "gamma:0.0: no server running") {
+		t.Fatalf("toasts = %+v", state.toasts)
+	}
+
+	press(tcell.KeyCtrlS, 0)
+	press(tcell.KeyCtrlX, 0)
+	if state.composeActive || state.composeMarked || len(markedKeys(state)) != 0 {
+		t.Fatalf("compose=%v marked=%v marks=%q after C-s C-x", state.composeActive, state.composeMarked, markedKeys(state))
+	}
+}
+
 func TestConnectFocusedUsesSwitchOnlyForCurrentSocket(t *testing.T) {
 	socketPath := "/tmp/lisa-b.sock"
 	sessionKey := sessionQualifiedKey(socketPath, "beta")
@@ -146,25 +228,30 @@ func TestDrawCellAndStatusIncludeSocketInfo(t *testing.T) {
 	screen.SetSize(80, 8)
 
 	sess := sessionView{
-		key:        "default::alpha",
-		name:       "alpha",
-		socketHint: "lisa-123",
-		paneID:     "%1",
-		lines:      []string{"line"},
+		key:         "default::alpha",
+		name:        "alpha",
+		socketHint:  "lisa-123",
+		paneID:      "%1",
+		lines:       []string{"line"},
+		windowIndex: 2,
+		windowName:  "editor",
+		paneIndex:   1,
 	}
 	drawCell(
 		screen,
 		0, 0, 80, 7,
 		sess,
+		borderSets[0],
 		tcell.StyleDefault,
 		tcell.StyleDefault,
 		tcell.StyleDefault,
 		0,
 		true,
+		thumbOff,
 	)
 
 	title := readScreenRow(screen, 1, 80)
-	if !strings.Contains(title, "alpha [lisa-123] (%1)") {
+	if !strings.Contains(title, "alpha:2.1 editor [lisa-123] (%1)") {
 		t.Fatalf("title = %q", title)
 	}
 
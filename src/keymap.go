@@ -0,0 +1,689 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// keyContext is what a key action acts on. Actions set quit to leave the
+// visualiser.
+type keyContext struct {
+	ctx       context.Context
+	screen    tcell.Screen
+	state     *appState
+	cfg       *config
+	refresher *refresher
+	quit      bool
+}
+
+// refresh asks the refresher for a refresh with the current config; full
+// makes every pane due now.
+func (k *keyContext) refresh(full bool) {
+	if k.refresher != nil {
+		k.refresher.request(*k.cfg, full)
+	}
+}
+
+func (k *keyContext) fail(err error) {
+	if err != nil {
+		showToast(k.state, "error", err.Error())
+	}
+}
+
+// modeSet is a set of focus modes an action applies in.
+type modeSet uint8
+
+func modes(ms ...focusMode) modeSet {
+	var set modeSet
+	for _, m := range ms {
+		set |= 1 << m
+	}
+	return set
+}
+
+func (s modeSet) has(m focusMode) bool { return s&(1<<m) != 0 }
+
+func (s modeSet) String() string {
+	var names []string
+	for m := focusMode(0); m < focusModeCount; m++ {
+		if s.has(m) {
+			names = append(names, strings.ToLower(modeNames[m]))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// keyAction is a named behaviour keys are bound to. keys are its default
+// bindings in tmux key syntax, and label, when set, names them in the help
+// while they are not overridden. An action with anyKey set has no
+// bindings: it takes every key no binding claims, and anyKey is its label.
+type keyAction struct {
+	name   string
+	modes  modeSet
+	keys   []string
+	label  string
+	anyKey string
+	desc   string
+	run    func(k *keyContext, ev *tcell.EventKey)
+}
+
+// keyActions is every action, in the order the help lists them. Key
+// handling, the ? help overlay and -check-keys all read it through the
+// keymap, so the help always matches what the keys do.
+var keyActions = []keyAction{
+	// Update prompt. Keys it does not bind fall through to the mode below.
+	{name: "update-now", modes: modes(modeUpdate), keys: []string{"Enter", "u", "U"}, desc: "update now", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.state.updatePrompt = false
+		updated, err := runUpdateFlow(k.screen, k.state.updateVersion)
+		if err != nil && !updated {
+			k.fail(err)
+		}
+		k.quit = updated
+	}},
+	{name: "update-ignore", modes: modes(modeUpdate), keys: []string{"i", "I"}, desc: "ignore updates for 7 days", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.fail(ignoreUpdatesFor(7 * 24 * time.Hour))
+		dismissUpdate(k.state)
+	}},
+	{name: "update-dismiss", modes: modes(modeUpdate), keys: []string{"n", "N", "C-s"}, desc: "not now", run: func(k *keyContext, ev *tcell.EventKey) { dismissUpdate(k.state) }},
+	{name: "send-escape", modes: modes(modeUpdate, modeSelect), keys: []string{"Escape"}, desc: "send Escape to the focused pane", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.fail(sendKeyToFocused(k.ctx, k.state, *k.cfg, "Escape", false))
+	}},
+
+	// Compose: every key goes to the focused pane, or to every marked pane,
+	// as it is typed.
+	{name: "compose-leave", modes: modes(modeCompose), keys: []string{"C-s"}, desc: "leave compose", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.state.composeActive = false
+		k.state.composeMarked = false
+		k.state.selectTarget = false
+		k.state.composeBuf = nil
+	}},
+	{name: "compose-type", modes: modes(modeCompose), anyKey: "other keys", desc: "send to the pane, or marked panes (Esc included)", run: func(k *keyContext, ev *tcell.EventKey) {
+		if !k.state.composeMarked {
+			sendEventKey(k, ev)
+			return
+		}
+		key, literal, _ := tmuxKeyFromEvent(ev)
+		for _, err := range sendKeyToMarked(k.ctx, k.state, *k.cfg, key, literal) {
+			k.fail(err)
+		}
+	}},
+
+	// Select target for the composed text.
+	{name: "select-cancel", modes: modes(modeSelect), keys: []string{"C-s"}, desc: "cancel", run: func(k *keyContext, ev *tcell.EventKey) { k.state.selectTarget = false }},
+	{name: "select-send", modes: modes(modeSelect), keys: []string{"Enter"}, desc: "send to the focused pane", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.fail(sendComposeToFocused(k.ctx, k.state, *k.cfg))
+	}},
+	{name: "select-next", modes: modes(modeSelect), keys: []string{"Tab", "Down", "n", "N"}, desc: "next target", run: func(k *keyContext, ev *tcell.EventKey) { moveFocus(k.state, 1) }},
+	{name: "select-prev", modes: modes(modeSelect), keys: []string{"BTab", "Up", "p", "P"}, desc: "previous target", run: func(k *keyContext, ev *tcell.EventKey) { moveFocus(k.state, -1) }},
+	{name: "select-number", modes: modes(modeSelect), keys: strings.Split("1 2 3 4 5 6 7 8 9", " "), label: "1-9", desc: "pick target by number", run: func(k *keyContext, ev *tcell.EventKey) {
+		names := orderedSessionNames(*k.state)
+		if idx := int(ev.Rune() - '1'); idx >= 0 && idx < len(names) {
+			k.state.focusIndex = idx
+			k.state.focusName = names[idx]
+		}
+	}},
+	{name: "select-ctrl-c", modes: modes(modeSelect), keys: []string{"C-c"}, desc: "send Ctrl+C to the focused pane", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.fail(sendKeyToFocused(k.ctx, k.state, *k.cfg, "C-c", false))
+	}},
+
+	// Send key: the next key goes to the focused pane, then the mode ends.
+	{name: "send-key-cancel", modes: modes(modeSendKey), keys: []string{"C-s"}, desc: "cancel", run: func(k *keyContext, ev *tcell.EventKey) { k.state.sendKeyActive = false }},
+	{name: "send-key-type", modes: modes(modeSendKey), anyKey: "any key", desc: "send it to the focused pane and leave", run: func(k *keyContext, ev *tcell.EventKey) {
+		sendEventKey(k, ev)
+		k.state.sendKeyActive = false
+	}},
+
+	// Command palette: keys edit the line until Enter runs it.
+	{name: "command-run", modes: modes(modeCommand), keys: []string{"Enter"}, desc: "run the command", run: func(k *keyContext, ev *tcell.EventKey) {
+		runPaletteCommand(k.ctx, k.state, *k.cfg)
+		k.refresh(true)
+	}},
+	{name: "command-close", modes: modes(modeCommand), keys: []string{"Escape", "C-s"}, desc: "close the palette", run: func(k *keyContext, ev *tcell.EventKey) { closePalette(k.state) }},
+	{name: "command-complete", modes: modes(modeCommand), keys: []string{"Tab"}, desc: "complete a command or target", run: func(k *keyContext, ev *tcell.EventKey) { completePalette(k.state) }},
+	{name: "command-history-prev", modes: modes(modeCommand), keys: []string{"Up", "C-p"}, desc: "previous command", run: func(k *keyContext, ev *tcell.EventKey) { browseHistory(k.state, -1) }},
+	{name: "command-history-next", modes: modes(modeCommand), keys: []string{"Down", "C-n"}, desc: "next command", run: func(k *keyContext, ev *tcell.EventKey) { browseHistory(k.state, 1) }},
+	{name: "command-delete", modes: modes(modeCommand), keys: []string{"BSpace"}, desc: "delete a character", run: func(k *keyContext, ev *tcell.EventKey) {
+		if input := k.state.command.input; len(input) > 0 {
+			editPalette(k.state, input[:len(input)-1])
+		}
+	}},
+	{name: "command-clear", modes: modes(modeCommand), keys: []string{"C-u"}, desc: "clear the line", run: func(k *keyContext, ev *tcell.EventKey) { editPalette(k.state, nil) }},
+	{name: "command-scroll-up", modes: modes(modeCommand), keys: []string{"PageUp"}, desc: "scroll the output up", run: func(k *keyContext, ev *tcell.EventKey) { scrollPalette(k.state, k.screen, -5) }},
+	{name: "command-scroll-down", modes: modes(modeCommand), keys: []string{"PageDown"}, desc: "scroll the output down", run: func(k *keyContext, ev *tcell.EventKey) { scrollPalette(k.state, k.screen, 5) }},
+	{name: "command-type", modes: modes(modeCommand), anyKey: "other keys", desc: "type into the line", run: func(k *keyContext, ev *tcell.EventKey) {
+		if ev.Key() == tcell.KeyRune && ev.Modifiers()&(tcell.ModCtrl|tcell.ModAlt) == 0 {
+			editPalette(k.state, append(k.state.command.input, ev.Rune()))
+		}
+	}},
+
+	// Normal mode.
+	{name: "quit", modes: modes(modeNormal), keys: []string{"q", "Q", "C-c"}, desc: "quit", run: func(k *keyContext, ev *tcell.EventKey) { k.quit = true }},
+	{name: "help", modes: modes(modeNormal), keys: []string{"?"}, desc: "toggle this help", run: func(k *keyContext, ev *tcell.EventKey) { k.state.showHelp = !k.state.showHelp }},
+	{name: "help-close", modes: modes(modeNormal), keys: []string{"Escape"}, desc: "close the help", run: func(k *keyContext, ev *tcell.EventKey) { k.state.showHelp = false }},
+	{name: "focus-next", modes: modes(modeNormal), keys: []string{"Tab", "n", "N"}, desc: "focus next at the nav level", run: func(k *keyContext, ev *tcell.EventKey) {
+		moveFocusLevel(k.state, k.state.navLevel, 1)
+	}},
+	{name: "focus-prev", modes: modes(modeNormal), keys: []string{"BTab", "p", "P"}, desc: "focus previous at the nav level", run: func(k *keyContext, ev *tcell.EventKey) {
+		moveFocusLevel(k.state, k.state.navLevel, -1)
+	}},
+	{name: "level-up", modes: modes(modeNormal), keys: []string{"u", "U"}, desc: "go up a navigation level", run: func(k *keyContext, ev *tcell.EventKey) { k.state.navLevel = k.state.navLevel.parent() }},
+	{name: "window-prev", modes: modes(modeNormal), keys: []string{"("}, desc: "previous window", run: func(k *keyContext, ev *tcell.EventKey) { moveWithinParent(k.state, navWindow, -1) }},
+	{name: "window-next", modes: modes(modeNormal), keys: []string{")"}, desc: "next window", run: func(k *keyContext, ev *tcell.EventKey) { moveWithinParent(k.state, navWindow, 1) }},
+	{name: "session-prev", modes: modes(modeNormal), keys: []string{"{"}, desc: "previous session", run: func(k *keyContext, ev *tcell.EventKey) { moveWithinParent(k.state, navSession, -1) }},
+	{name: "session-next", modes: modes(modeNormal), keys: []string{"}"}, desc: "next session", run: func(k *keyContext, ev *tcell.EventKey) { moveWithinParent(k.state, navSession, 1) }},
+	{name: "scroll-up", modes: modes(modeNormal), keys: []string{"k", "K", "Up"}, desc: "scroll up", run: func(k *keyContext, ev *tcell.EventKey) { scrollFocused(k.state, k.screen, -1) }},
+	{name: "scroll-down", modes: modes(modeNormal), keys: []string{"j", "J", "Down"}, desc: "scroll down", run: func(k *keyContext, ev *tcell.EventKey) { scrollFocused(k.state, k.screen, 1) }},
+	{name: "scroll-page-up", modes: modes(modeNormal), keys: []string{"PageUp"}, desc: "scroll up faster", run: func(k *keyContext, ev *tcell.EventKey) { scrollFocused(k.state, k.screen, -5) }},
+	{name: "scroll-page-down", modes: modes(modeNormal), keys: []string{"PageDown"}, desc: "scroll down faster", run: func(k *keyContext, ev *tcell.EventKey) { scrollFocused(k.state, k.screen, 5) }},
+	{name: "scroll-top", modes: modes(modeNormal), keys: []string{"Home"}, desc: "jump to the top", run: func(k *keyContext, ev *tcell.EventKey) { jumpScroll(k.state, k.screen, true) }},
+	{name: "scroll-bottom", modes: modes(modeNormal), keys: []string{"End"}, desc: "jump to the bottom and follow", run: func(k *keyContext, ev *tcell.EventKey) { jumpScroll(k.state, k.screen, false) }},
+	{name: "page-prev", modes: modes(modeNormal), keys: []string{"<", "M-Left"}, desc: "previous page", run: func(k *keyContext, ev *tcell.EventKey) { movePage(k.state, k.screen, -1) }},
+	{name: "page-next", modes: modes(modeNormal), keys: []string{">", "M-Right"}, desc: "next page", run: func(k *keyContext, ev *tcell.EventKey) { movePage(k.state, k.screen, 1) }},
+	{name: "zoom", modes: modes(modeNormal), keys: []string{"z", "Z"}, desc: "zoom the focused pane", run: func(k *keyContext, ev *tcell.EventKey) { k.state.zoomed = !k.state.zoomed }},
+	{name: "attach", modes: modes(modeNormal), keys: []string{"Enter"}, desc: "attach to the focused session", run: func(k *keyContext, ev *tcell.EventKey) {
+		exit, err := connectFocused(k.ctx, k.state, *k.cfg, k.screen)
+		if err != nil && !exit {
+			k.fail(err)
+		}
+		k.quit = exit
+	}},
+	{name: "compose", modes: modes(modeNormal), keys: []string{"i", "I"}, desc: "compose live input to the pane", run: func(k *keyContext, ev *tcell.EventKey) { startCompose(k.state) }},
+	{name: "command", modes: modes(modeNormal), keys: []string{":"}, desc: "run a tmux command", run: func(k *keyContext, ev *tcell.EventKey) { openPalette(k.state) }},
+	{name: "compose-marked", modes: modes(modeNormal), keys: []string{"b", "B"}, desc: "compose to all marked panes", run: func(k *keyContext, ev *tcell.EventKey) { k.fail(startComposeMarked(k.state)) }},
+	{name: "mark", modes: modes(modeNormal), keys: []string{"x", "X"}, desc: "mark or unmark the pane", run: func(k *keyContext, ev *tcell.EventKey) { toggleMark(k.state) }},
+	{name: "marks-clear", modes: modes(modeNormal), keys: []string{"C-x"}, desc: "clear all marks", run: func(k *keyContext, ev *tcell.EventKey) { k.state.marked = nil }},
+	{name: "send-key", modes: modes(modeNormal), keys: []string{"s", "S"}, desc: "send one key to the pane", run: func(k *keyContext, ev *tcell.EventKey) { startSendKey(k.state) }},
+	{name: "kill-session", modes: modes(modeNormal), keys: []string{"C-k"}, desc: "kill the focused session", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.fail(killFocusedSession(k.ctx, k.state, *k.cfg))
+		k.refresh(true)
+	}},
+	{name: "refresh", modes: modes(modeNormal), keys: []string{"r", "R"}, desc: "refresh every pane now", run: func(k *keyContext, ev *tcell.EventKey) { k.refresh(true) }},
+	{name: "lines-more", modes: modes(modeNormal), keys: []string{"+"}, desc: "capture 50 more lines", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.cfg.lines += 50
+		k.refresh(true)
+	}},
+	{name: "lines-fewer", modes: modes(modeNormal), keys: []string{"-"}, desc: "capture 50 fewer lines", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.cfg.lines = maxInt(k.cfg.lines-50, 20)
+		k.refresh(true)
+	}},
+	{name: "interval-shorter", modes: modes(modeNormal), keys: []string{"["}, desc: "shorten the refresh interval", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.cfg.interval -= 200 * time.Millisecond
+		if k.cfg.interval < 200*time.Millisecond {
+			k.cfg.interval = 200 * time.Millisecond
+		}
+		if k.cfg.minInterval > k.cfg.interval {
+			k.cfg.minInterval = k.cfg.interval
+		}
+		k.refresh(false)
+	}},
+	{name: "interval-longer", modes: modes(modeNormal), keys: []string{"]"}, desc: "lengthen the refresh interval", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.cfg.interval += 200 * time.Millisecond
+		if k.cfg.maxInterval < k.cfg.interval {
+			k.cfg.maxInterval = k.cfg.interval
+		}
+		k.refresh(false)
+	}},
+	{name: "sockets", modes: modes(modeNormal), keys: []string{"o", "O"}, desc: "toggle the socket overview", run: func(k *keyContext, ev *tcell.EventKey) { k.state.showSockets = !k.state.showSockets }},
+	{name: "window-layout", modes: modes(modeNormal), keys: []string{"w", "W"}, desc: "toggle window layout", run: func(k *keyContext, ev *tcell.EventKey) { k.state.windowLayout = !k.state.windowLayout }},
+	{name: "layout", modes: modes(modeNormal), keys: []string{"l", "L"}, desc: "cycle the cell layout", run: func(k *keyContext, ev *tcell.EventKey) { k.state.layout = nextLayout(k.state.layout) }},
+	{name: "theme", modes: modes(modeNormal), keys: []string{"c", "C"}, desc: "cycle the colour theme", run: func(k *keyContext, ev *tcell.EventKey) { k.state.theme = nextTheme(*k.state) }},
+	{name: "thumbnail", modes: modes(modeNormal), keys: []string{"t", "T"}, desc: "cycle the thumbnail mode", run: func(k *keyContext, ev *tcell.EventKey) { k.state.thumbnail = k.state.thumbnail.next() }},
+	{name: "mouse", modes: modes(modeNormal), keys: []string{"m", "M"}, desc: "toggle mouse capture", run: func(k *keyContext, ev *tcell.EventKey) {
+		if k.state.mouseEnabled {
+			k.screen.DisableMouse()
+		} else {
+			k.screen.EnableMouse()
+		}
+		k.state.mouseEnabled = !k.state.mouseEnabled
+	}},
+	{name: "mouse-passthrough", modes: modes(modeNormal), keys: []string{"f", "F"}, desc: "toggle mouse passthrough to panes", run: func(k *keyContext, ev *tcell.EventKey) {
+		k.state.passthrough = !k.state.passthrough
+		k.state.mouseGrab = mouseGrab{}
+		if k.state.passthrough && !k.state.mouseEnabled {
+			k.screen.EnableMouse()
+			k.state.mouseEnabled = true
+		}
+	}},
+}
+
+func dismissUpdate(state *appState) {
+	state.updatePrompt = false
+	state.updateVersion = ""
+}
+
+// sendEventKey sends the pressed key to the focused pane.
+func sendEventKey(k *keyContext, ev *tcell.EventKey) {
+	key, literal, _ := tmuxKeyFromEvent(ev)
+	k.fail(sendKeyToFocused(k.ctx, k.state, *k.cfg, key, literal))
+}
+
+func keyActionNames() []string {
+	names := make([]string, len(keyActions))
+	for i, a := range keyActions {
+		names[i] = a.name
+	}
+	return names
+}
+
+func keyActionByName(name string) (*keyAction, bool) {
+	for i := range keyActions {
+		if keyActions[i].name == name {
+			return &keyActions[i], true
+		}
+	}
+	return nil, false
+}
+
+// keySpec is one key press: a special key, or a rune when key is
+// tcell.KeyRune. alt is set when it was typed with Meta.
+type keySpec struct {
+	key tcell.Key
+	ch  rune
+	alt bool
+}
+
+// keyNames maps tmux key names, and a few common aliases, to keys. They
+// are matched without regard to case.
+var keyNames = map[string]tcell.Key{
+	"enter": tcell.KeyEnter, "tab": tcell.KeyTab, "btab": tcell.KeyBacktab, "s-tab": tcell.KeyBacktab,
+	"escape": tcell.KeyEsc, "esc": tcell.KeyEsc, "bspace": tcell.KeyBackspace, "backspace": tcell.KeyBackspace,
+	"up": tcell.KeyUp, "down": tcell.KeyDown, "left": tcell.KeyLeft, "right": tcell.KeyRight,
+	"home": tcell.KeyHome, "end": tcell.KeyEnd,
+	"pageup": tcell.KeyPgUp, "ppage": tcell.KeyPgUp, "pgup": tcell.KeyPgUp,
+	"pagedown": tcell.KeyPgDn, "npage": tcell.KeyPgDn, "pgdn": tcell.KeyPgDn,
+	"insert": tcell.KeyInsert, "ic": tcell.KeyInsert, "delete": tcell.KeyDelete, "dc": tcell.KeyDelete,
+	"f1": tcell.KeyF1, "f2": tcell.KeyF2, "f3": tcell.KeyF3, "f4": tcell.KeyF4, "f5": tcell.KeyF5, "f6": tcell.KeyF6,
+	"f7": tcell.KeyF7, "f8": tcell.KeyF8, "f9": tcell.KeyF9, "f10": tcell.KeyF10, "f11": tcell.KeyF11, "f12": tcell.KeyF12,
+}
+
+// metaKeys are the special keys that can be bound with Meta. Terminals
+// report them with a modifier parameter, which tcell decodes reliably,
+// unlike Meta with Enter or Tab, which arrive as Escape and the key.
+var metaKeys = map[tcell.Key]bool{
+	tcell.KeyUp: true, tcell.KeyDown: true, tcell.KeyLeft: true, tcell.KeyRight: true,
+	tcell.KeyHome: true, tcell.KeyEnd: true, tcell.KeyPgUp: true, tcell.KeyPgDn: true,
+}
+
+// keyLabels are the names keys are shown with; parseKey reads them back.
+var keyLabels = map[tcell.Key]string{
+	tcell.KeyEnter: "Enter", tcell.KeyTab: "Tab", tcell.KeyBacktab: "BTab", tcell.KeyEsc: "Escape", tcell.KeyBackspace: "BSpace",
+	tcell.KeyUp: "Up", tcell.KeyDown: "Down", tcell.KeyLeft: "Left", tcell.KeyRight: "Right", tcell.KeyHome: "Home", tcell.KeyEnd: "End",
+	tcell.KeyPgUp: "PageUp", tcell.KeyPgDn: "PageDown", tcell.KeyInsert: "Insert", tcell.KeyDelete: "Delete",
+	tcell.KeyF1: "F1", tcell.KeyF2: "F2", tcell.KeyF3: "F3", tcell.KeyF4: "F4", tcell.KeyF5: "F5", tcell.KeyF6: "F6",
+	tcell.KeyF7: "F7", tcell.KeyF8: "F8", tcell.KeyF9: "F9", tcell.KeyF10: "F10", tcell.KeyF11: "F11", tcell.KeyF12: "F12",
+}
+
+// parseKey reads one key in tmux syntax: a single character, Space, C-x for
+// a control letter, M-x for a character or navigation key typed with Meta,
+// or a key name such as Enter, BTab, PageUp or F5.
+func parseKey(name string) (keySpec, error) {
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) && r != utf8.RuneError {
+		return keySpec{key: tcell.KeyRune, ch: r}, nil
+	}
+	switch {
+	case strings.EqualFold(name, "Space"):
+		return keySpec{key: tcell.KeyRune, ch: ' '}, nil
+	case strings.HasPrefix(name, "C-") && len(name) == 3:
+		if lower := unicode.ToLower(rune(name[2])); lower >= 'a' && lower <= 'z' {
+			return keySpec{key: tcell.KeyCtrlA + tcell.Key(lower-'a')}, nil
+		}
+	case strings.HasPrefix(name, "M-"):
+		if spec, err := parseKey(name[2:]); err == nil && (spec.key == tcell.KeyRune || metaKeys[spec.key]) && !spec.alt {
+			spec.alt = true
+			return spec, nil
+		}
+	default:
+		if key, ok := keyNames[strings.ToLower(name)]; ok {
+			return keySpec{key: key}, nil
+		}
+	}
+	return keySpec{}, fmt.Errorf("unknown key %q", name)
+}
+
+func (s keySpec) String() string {
+	if s.key == tcell.KeyRune {
+		name := string(s.ch)
+		if s.ch == ' ' {
+			name = "Space"
+		}
+		if s.alt {
+			name = "M-" + name
+		}
+		return name
+	}
+	if label, ok := keyLabels[s.key]; ok {
+		if s.alt {
+			label = "M-" + label
+		}
+		return label
+	}
+	if s.key >= tcell.KeyCtrlA && s.key <= tcell.KeyCtrlZ {
+		return "C-" + string(rune('a'+s.key-tcell.KeyCtrlA))
+	}
+	if name, ok := tcell.KeyNames[s.key]; ok {
+		return name
+	}
+	return "?"
+}
+
+// normalizeKey turns an event into the keySpec bindings are matched
+// against. A letter typed with Ctrl becomes its control key, so C-s matches
+// however the terminal reports it.
+func normalizeKey(ev *tcell.EventKey) keySpec {
+	switch ev.Key() {
+	case tcell.KeyRune:
+	case tcell.KeyBackspace2:
+		return keySpec{key: tcell.KeyBackspace}
+	default:
+		return keySpec{key: ev.Key(), alt: metaKeys[ev.Key()] && ev.Modifiers()&tcell.ModAlt != 0}
+	}
+	r := ev.Rune()
+	if ev.Modifiers()&tcell.ModCtrl != 0 {
+		if lower := unicode.ToLower(r); lower >= 'a' && lower <= 'z' {
+			return keySpec{key: tcell.KeyCtrlA + tcell.Key(lower-'a')}
+		}
+	}
+	return keySpec{key: tcell.KeyRune, ch: r, alt: ev.Modifiers()&tcell.ModAlt != 0}
+}
+
+// keySeq is the keys of one binding. Longer than one key it is a chord,
+// its leading keys a prefix as with tmux's C-b.
+type keySeq []keySpec
+
+// parseKeySeq reads space-separated keys, such as "C-a k".
+func parseKeySeq(s string) (keySeq, error) {
+	var seq keySeq
+	for _, name := range strings.Fields(s) {
+		spec, err := parseKey(name)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, spec)
+	}
+	if len(seq) == 0 {
+		return nil, errors.New("empty key binding")
+	}
+	return seq, nil
+}
+
+func (s keySeq) String() string {
+	names := make([]string, len(s))
+	for i, spec := range s {
+		names[i] = spec.String()
+	}
+	return strings.Join(names, " ")
+}
+
+func (s keySeq) hasPrefix(prefix keySeq) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// keyBinding is a key sequence bound to an action.
+type keyBinding struct {
+	seq    keySeq
+	action *keyAction
+}
+
+// keyMap is the resolved bindings, in keyActions order. custom holds the
+// actions whose keys came from the key file.
+type keyMap struct {
+	bindings []keyBinding
+	custom   map[*keyAction]bool
+}
+
+// keyFile is the JSON layout of the key file: for each action named, the
+// key sequences that replace its default keys. An empty list unbinds it.
+type keyFile struct {
+	Bindings map[string][]string `json:"bindings"`
+}
+
+// buildKeymap binds every action to its default keys, or to the keys given
+// for it in overrides.
+func buildKeymap(overrides map[string][]string) (keyMap, error) {
+	for name, keys := range overrides {
+		action, ok := keyActionByName(name)
+		if !ok {
+			return keyMap{}, fmt.Errorf("unknown key action %q (want one of %s)", name, strings.Join(keyActionNames(), ", "))
+		}
+		if action.anyKey != "" && len(keys) > 0 {
+			return keyMap{}, fmt.Errorf("key action %q takes every unbound key and cannot be bound", name)
+		}
+	}
+	km := keyMap{custom: map[*keyAction]bool{}}
+	for i := range keyActions {
+		action := &keyActions[i]
+		keys := action.keys
+		if override, ok := overrides[action.name]; ok {
+			keys = override
+			km.custom[action] = true
+		}
+		for _, s := range keys {
+			seq, err := parseKeySeq(s)
+			if err != nil {
+				return keyMap{}, fmt.Errorf("key action %q: %w", action.name, err)
+			}
+			km.bindings = append(km.bindings, keyBinding{seq, action})
+		}
+	}
+	return km, nil
+}
+
+// defaultKeymap is the keymap without a key file.
+var defaultKeymap, _ = buildKeymap(nil)
+
+// loadKeymap builds the keymap from the key file at path. An empty path
+// reads the default key file, which may be missing.
+func loadKeymap(path string) (keyMap, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = configFilePath("keys.json"); err != nil {
+			return defaultKeymap, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+	case explicit || !errors.Is(err, os.ErrNotExist):
+		return keyMap{}, fmt.Errorf("key file: %w", err)
+	default:
+		return defaultKeymap, nil
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return keyMap{}, fmt.Errorf("key file %s: %w", path, err)
+	}
+	km, err := buildKeymap(file.Bindings)
+	if err != nil {
+		return keyMap{}, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return km, nil
+}
+
+// conflicts lists bindings that cannot all work in a mode they share: one
+// sequence bound to two actions, or a sequence that is also the prefix of
+// a chord and so never completes.
+func (km keyMap) conflicts() []string {
+	var out []string
+	for i, a := range km.bindings {
+		for _, b := range km.bindings[i+1:] {
+			shared := a.action.modes & b.action.modes
+			if shared == 0 {
+				continue
+			}
+			short, long := a, b
+			if len(short.seq) > len(long.seq) {
+				short, long = b, a
+			}
+			switch {
+			case !long.seq.hasPrefix(short.seq):
+			case len(short.seq) == len(long.seq):
+				if a.action != b.action {
+					out = append(out, fmt.Sprintf("%s: %q is bound to both %s and %s", shared, a.seq.String(), a.action.name, b.action.name))
+				}
+			default:
+				out = append(out, fmt.Sprintf("%s: %q (%s) is a prefix of %q (%s)", shared, short.seq.String(), short.action.name, long.seq.String(), long.action.name))
+			}
+		}
+	}
+	return out
+}
+
+// describe lists every action with its modes, keys and description, one
+// per line, for -check-keys.
+func (km keyMap) describe() []string {
+	out := make([]string, 0, len(keyActions))
+	for i := range keyActions {
+		action := &keyActions[i]
+		keys := km.keyLabel(action)
+		if keys == "" {
+			keys = "(unbound)"
+		}
+		out = append(out, fmt.Sprintf("%-17s %-24s %-20s %s", action.name, action.modes, keys, action.desc))
+	}
+	return out
+}
+
+// keyLabel is how the help names the keys bound to action. The upper case
+// of a letter that is bound in both cases is left out.
+func (km keyMap) keyLabel(action *keyAction) string {
+	if action.anyKey != "" {
+		return action.anyKey
+	}
+	if action.label != "" && !km.custom[action] {
+		return action.label
+	}
+	var seqs []keySeq
+	bound := map[keySpec]bool{}
+	for _, b := range km.bindings {
+		if b.action == action {
+			seqs = append(seqs, b.seq)
+			if len(b.seq) == 1 {
+				bound[b.seq[0]] = true
+			}
+		}
+	}
+	var names []string
+	for _, seq := range seqs {
+		if k := seq[0]; len(seq) == 1 && k.key == tcell.KeyRune && unicode.IsUpper(k.ch) && bound[keySpec{key: tcell.KeyRune, ch: unicode.ToLower(k.ch), alt: k.alt}] {
+			continue
+		}
+		names = append(names, seq.String())
+	}
+	return strings.Join(names, " / ")
+}
+
+// activeKeymap is the keymap keys are read through: the one loaded at
+// startup, or the defaults.
+func activeKeymap(state appState) keyMap {
+	if state.keymap.bindings == nil {
+		return defaultKeymap
+	}
+	return state.keymap
+}
+
+// keyModes lists the modes whose bindings apply, in the order they are
+// tried: the update prompt sits on top of whatever mode is below it.
+func keyModes(state appState) []focusMode {
+	below := state
+	below.updatePrompt = false
+	if state.updatePrompt {
+		return []focusMode{modeUpdate, stateMode(below)}
+	}
+	return []focusMode{stateMode(below)}
+}
+
+// lookupKey finds the binding seq completes in state's modes, or reports
+// whether seq is the prefix of a chord there.
+func lookupKey(state appState, seq keySeq) (keyBinding, bool, bool) {
+	modes := keyModes(state)
+	for _, mode := range modes {
+		for _, b := range activeKeymap(state).bindings {
+			if b.action.modes.has(mode) && len(b.seq) == len(seq) && b.seq.hasPrefix(seq) {
+				return b, true, false
+			}
+		}
+	}
+	for _, mode := range modes {
+		for _, b := range activeKeymap(state).bindings {
+			if b.action.modes.has(mode) && b.seq.hasPrefix(seq) {
+				return keyBinding{}, false, true
+			}
+		}
+	}
+	return keyBinding{}, false, false
+}
+
+// dispatchKey runs the action for ev, or holds ev as the prefix of a
+// chord, and reports whether the key was used. As in tmux, a key that
+// completes no chord after a prefix is dropped. Keys nothing binds go to
+// the mode's catch-all action, if it has one.
+func dispatchKey(k *keyContext, ev *tcell.EventKey) bool {
+	pending := k.state.keyPending
+	seq := append(pending[:len(pending):len(pending)], normalizeKey(ev))
+	k.state.keyPending = nil
+	b, ok, prefix := lookupKey(*k.state, seq)
+	switch {
+	case ok:
+		b.action.run(k, ev)
+		return true
+	case prefix:
+		k.state.keyPending = seq
+		return true
+	case len(pending) > 0:
+		return true
+	}
+	if _, _, ok := tmuxKeyFromEvent(ev); !ok {
+		return false
+	}
+	for _, mode := range keyModes(*k.state) {
+		for i := range keyActions {
+			if action := &keyActions[i]; action.anyKey != "" && action.modes.has(mode) {
+				action.run(k, ev)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// helpEntry is one line of the help overlay.
+type helpEntry struct {
+	keys, desc string
+}
+
+// helpEntries lists the bound actions that apply in state, mode by mode in
+// keyActions order.
+func helpEntries(state appState) []helpEntry {
+	km := activeKeymap(state)
+	var out []helpEntry
+	for _, mode := range keyModes(state) {
+		for i := range keyActions {
+			action := &keyActions[i]
+			if !action.modes.has(mode) {
+				continue
+			}
+			if keys := km.keyLabel(action); keys != "" {
+				out = append(out, helpEntry{keys, action.desc})
+			}
+		}
+	}
+	return out
+}
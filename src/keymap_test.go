@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestDefaultKeymapHasNoConflicts(t *testing.T) {
+	if conflicts := defaultKeymap.conflicts(); len(conflicts) > 0 {
+		t.Fatalf("default bindings conflict:\n%s", strings.Join(conflicts, "\n"))
+	}
+	for mode := focusMode(0); mode < focusModeCount; mode++ {
+		catchAll := ""
+		for _, a := range keyActions {
+			if a.desc == "" || a.run == nil {
+				t.Fatalf("action %q has no description or run", a.name)
+			}
+			if a.anyKey == "" || !a.modes.has(mode) {
+				continue
+			}
+			if catchAll != "" {
+				t.Fatalf("mode %d has two catch-all actions: %q and %q", mode, catchAll, a.name)
+			}
+			catchAll = a.name
+		}
+	}
+}
+
+func TestParseKeySeq(t *testing.T) {
+	for in, want := range map[string]string{
+		"C-a k":          "C-a k",
+		"C-K":            "C-k",
+		"M-x":            "M-x",
+		"S-Tab Esc":      "BTab Escape",
+		"space PgDn":     "Space PageDown",
+		"  F5   Enter ":  "F5 Enter",
+		"DC BSpace":      "Delete BSpace",
+		"M-left M-PPage": "M-Left M-PageUp",
+	} {
+		seq, err := parseKeySeq(in)
+		if err != nil || seq.String() != want {
+			t.Fatalf("parseKeySeq(%q) = %q, %v; want %q", in, seq.String(), err, want)
+		}
+		if again, err := parseKeySeq(seq.String()); err != nil || again.String() != want {
+			t.Fatalf("%q does not round-trip: %q, %v", want, again.String(), err)
+		}
+	}
+	for _, in := range []string{"", "C-1", "M-Enter", "Hyper-x", "C-a Nope"} {
+		if _, err := parseKeySeq(in); err == nil {
+			t.Fatalf("parseKeySeq(%q) succeeded", in)
+		}
+	}
+	if got := normalizeKey(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModAlt)).String(); got != "M-Right" {
+		t.Fatalf("Meta+Right normalized to %q", got)
+	}
+	if got := normalizeKey(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModAlt)).String(); got != "Enter" {
+		t.Fatalf("Meta+Enter normalized to %q", got)
+	}
+}
+
+func TestLoadKeymapFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+	write := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"bindings": {"kill-session": ["C-a k"], "zoom": ["C-a z", "F2"], "mouse": []}}`)
+	km, err := loadKeymap(path)
+	if err != nil {
+		t.Fatalf("loadKeymap: %v", err)
+	}
+	if conflicts := km.conflicts(); len(conflicts) > 0 {
+		t.Fatalf("conflicts = %q", conflicts)
+	}
+	kill, _ := keyActionByName("kill-session")
+	zoom, _ := keyActionByName("zoom")
+	mouse, _ := keyActionByName("mouse")
+	quit, _ := keyActionByName("quit")
+	for action, want := range map[*keyAction]string{kill: "C-a k", zoom: "C-a z / F2", mouse: "", quit: "q / C-c"} {
+		if got := km.keyLabel(action); got != want {
+			t.Fatalf("%s keys = %q, want %q", action.name, got, want)
+		}
+	}
+
+	write(`{"bindings": {"zoom": ["q"], "refresh": ["C-a"], "theme": ["C-a c"]}}`)
+	km, err = loadKeymap(path)
+	if err != nil {
+		t.Fatalf("loadKeymap: %v", err)
+	}
+	got := strings.Join(km.conflicts(), "\n")
+	for _, want := range []string{`normal: "q" is bound to both quit and zoom`, `normal: "C-a" (refresh) is a prefix of "C-a c" (theme)`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("conflicts missing %q:\n%s", want, got)
+		}
+	}
+
+	for body, want := range map[string]string{
+		`{"bindings": {"teleport": ["x"]}}`:     `unknown key action "teleport"`,
+		`{"bindings": {"zoom": ["C-a Nope"]}}`:  `key action "zoom": unknown key "Nope"`,
+		`{"bindings": {"compose-type": ["x"]}}`: `cannot be bound`,
+		`{"bindings": `:                         `unexpected end of JSON input`,
+	} {
+		write(body)
+		if _, err := loadKeymap(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("loadKeymap(%s) error = %v, want %q", body, err, want)
+		}
+	}
+	if _, err := loadKeymap(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatalf("missing explicit key file did not fail")
+	}
+}
+
+func TestDispatchKeyChords(t *testing.T) {
+	km, err := buildKeymap(map[string][]string{"zoom": {"C-a z"}, "sockets": {"C-a C-a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := appState{sessions: map[string]sessionView{}, keymap: km}
+	cfg := config{}
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
+	ctrlA := tcell.NewEventKey(tcell.KeyCtrlA, 0, tcell.ModCtrl)
+	z := tcell.NewEventKey(tcell.KeyRune, 'z', tcell.ModNone)
+
+	if dispatchKey(&keys, z) || state.zoomed {
+		t.Fatalf("bare z zoomed after it was rebound")
+	}
+	if !dispatchKey(&keys, ctrlA) || state.keyPending.String() != "C-a" {
+		t.Fatalf("C-a not held as a prefix: pending %q", state.keyPending.String())
+	}
+	screen := newTextScreen(t, 60, 1)
+	drawStatus(screen, 60, 0, tcell.StyleDefault, state, config{statusLeft: "mode"}, 0)
+	if row := readScreenRow(screen, 0, 60); !strings.HasPrefix(row, " NORMAL  C-a …") {
+		t.Fatalf("status does not show the pending chord: %q", row)
+	}
+	dispatchKey(&keys, z)
+	if !state.zoomed || state.keyPending != nil {
+		t.Fatalf("C-a z: zoomed=%v pending=%q", state.zoomed, state.keyPending.String())
+	}
+	dispatchKey(&keys, ctrlA)
+	dispatchKey(&keys, ctrlA)
+	if !state.showSockets {
+		t.Fatalf("C-a C-a did not toggle the sockets")
+	}
+	// A key completing no chord is dropped rather than run on its own.
+	dispatchKey(&keys, ctrlA)
+	if !dispatchKey(&keys, tcell.NewEventKey(tcell.KeyRune, 'q', tcell.ModNone)) || keys.quit || state.keyPending != nil {
+		t.Fatalf("C-a q: quit=%v pending=%q", keys.quit, state.keyPending.String())
+	}
+}
+
+func TestDispatchKeyNormalMode(t *testing.T) {
+	state := appState{sessions: map[string]sessionView{}}
+	cfg := config{lines: 500}
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
+	press := func(ev *tcell.EventKey) bool {
+		t.Helper()
+		return dispatchKey(&keys, ev)
+	}
+
+	if !press(tcell.NewEventKey(tcell.KeyRune, 'Z', tcell.ModNone)) || !state.zoomed {
+		t.Fatalf("Z did not zoom")
+	}
+	press(tcell.NewEventKey(tcell.KeyRune, '+', tcell.ModNone))
+	if cfg.lines != 550 {
+		t.Fatalf("lines = %d after +", cfg.lines)
+	}
+	press(tcell.NewEventKey(tcell.KeyRune, '?', tcell.ModShift))
+	if !state.showHelp {
+		t.Fatalf("? did not open the help")
+	}
+	press(tcell.NewEventKey(tcell.KeyEsc, 0, tcell.ModNone))
+	if state.showHelp {
+		t.Fatalf("Esc did not close the help")
+	}
+	if press(tcell.NewEventKey(tcell.KeyF7, 0, tcell.ModNone)) {
+		t.Fatalf("unbound key was handled")
+	}
+	if keys.quit {
+		t.Fatalf("quit before q")
+	}
+	press(tcell.NewEventKey(tcell.KeyCtrlC, 0, tcell.ModCtrl))
+	if !keys.quit {
+		t.Fatalf("Ctrl+C did not quit")
+	}
+}
+
+func TestUpdatePromptKeysFallThroughToMode(t *testing.T) {
+	state := appState{sessions: map[string]sessionView{}, updatePrompt: true, updateVersion: "v9"}
+	cfg := config{}
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
+
+	dispatchKey(&keys, tcell.NewEventKey(tcell.KeyRune, 'z', tcell.ModNone))
+	if !state.zoomed || !state.updatePrompt {
+		t.Fatalf("z under the update prompt: zoomed=%v prompt=%v", state.zoomed, state.updatePrompt)
+	}
+	dispatchKey(&keys, tcell.NewEventKey(tcell.KeyRune, 'n', tcell.ModNone))
+	if state.updatePrompt || state.updateVersion != "" {
+		t.Fatalf("n did not dismiss the update prompt")
+	}
+}
+
+func TestSendKeyModeSendsOneKey(t *testing.T) {
+	state := appState{
+		sessions:      map[string]sessionView{"a": {key: "a", name: "alpha", socketPath: "/tmp/s", paneID: "%3"}},
+		focusName:     "a",
+		sendKeyActive: true,
+	}
+	cfg := config{}
+	var calls []string
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() { runTmuxOnSocketFn = origRun })
+	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
+		calls = append(calls, socket+"|"+strings.Join(args, " "))
+		return "", nil
+	}
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
+
+	dispatchKey(&keys, tcell.NewEventKey(tcell.KeyRune, 'q', tcell.ModNone))
+	if keys.quit || state.sendKeyActive {
+		t.Fatalf("quit=%v sendKeyActive=%v, want q sent and the mode left", keys.quit, state.sendKeyActive)
+	}
+	if len(calls) != 1 || calls[0] != "/tmp/s|send-keys -t %3 -l q" {
+		t.Fatalf("calls = %q", calls)
+	}
+}
+
+func TestHelpOverlayListsCurrentModeBindings(t *testing.T) {
+	entries := func(state appState) string {
+		var lines []string
+		for _, e := range helpEntries(state) {
+			lines = append(lines, e.keys+"="+e.desc)
+		}
+		return strings.Join(lines, "\n")
+	}
+	normal := entries(appState{})
+	for _, want := range []string{"q / C-c=quit", "Tab / n=focus next at the nav level", "k / Up=scroll up", "C-k=kill the focused session", "?=toggle this help"} {
+		if !strings.Contains(normal, want) {
+			t.Fatalf("normal help missing %q:\n%s", want, normal)
+		}
+	}
+	compose := entries(appState{composeActive: true})
+	if !strings.Contains(compose, "C-s=leave compose") || strings.Contains(compose, "quit") {
+		t.Fatalf("compose help:\n%s", compose)
+	}
+	if sel := entries(appState{selectTarget: true}); !strings.Contains(sel, "1-9=pick target by number") {
+		t.Fatalf("select help:\n%s", sel)
+	}
+	update := entries(appState{updatePrompt: true})
+	if !strings.HasPrefix(update, "Enter / u=update now") || !strings.Contains(update, "quit") {
+		t.Fatalf("update help should list the prompt keys, then normal mode:\n%s", update)
+	}
+
+	screen := newTextScreen(t, 100, 30)
+	state := appState{sessions: map[string]sessionView{}, scroll: map[string]int{}, follow: map[string]bool{}, showHelp: true, lastRefresh: statusClock()}
+	draw(screen, state, config{})
+	var text strings.Builder
+	for y := 0; y < 30; y++ {
+		text.WriteString(readScreenRow(screen, y, 100) + "\n")
+	}
+	for _, a := range keyActions {
+		if a.modes.has(modeNormal) && !strings.Contains(text.String(), a.desc) {
+			t.Fatalf("help overlay missing %q:\n%s", a.desc, text.String())
+		}
+	}
+	if !strings.Contains(text.String(), "Keys: normal") {
+		t.Fatalf("help overlay title missing:\n%s", text.String())
+	}
+}
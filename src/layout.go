@@ -1,11 +1,28 @@
 package main
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/gdamore/tcell/v2"
 )
 
+// rect is a screen area; x1 and y1 are exclusive.
+type rect struct {
+	x0 int
+	y0 int
+	x1 int
+	y1 int
+}
+
+func (r rect) empty() bool {
+	return r.x1 <= r.x0 || r.y1 <= r.y0
+}
+
+func (r rect) contains(x, y int) bool {
+	return x >= r.x0 && x < r.x1 && y >= r.y0 && y < r.y1
+}
+
 func gridDims(count int) (cols, rows int) {
 	if count <= 0 {
 		return 1, 1
@@ -24,66 +41,248 @@ func gridDims(count int) (cols, rows int) {
 	return cols, rows
 }
 
-func contentHeightForIndex(count, index int, screen tcell.Screen) int {
-	_, height := screen.Size()
+// cellContentRect is the area inside a cell's box below its title row.
+func cellContentRect(cell rect) rect {
+	top := cell.y0 + 2
+	if cell.y1-cell.y0 <= 3 {
+		top = cell.y0 + 1
+	}
+	return rect{x0: cell.x0 + 1, y0: top, x1: cell.x1 - 1, y1: cell.y1 - 1}
+}
+
+// cellFrame is one cell and the views drawn in it. With window layout on,
+// a cell holds every listed pane of one tmux window. Cells the layout does
+// not show have an empty rect.
+type cellFrame struct {
+	cell rect
+	keys []string
+}
+
+// screenLayout is the placement of everything above the status bar for one
+// draw; drawing, hit-testing and scrolling all work from it.
+type screenLayout struct {
+	engine layoutEngine
+	frames []cellFrame
+	focus  int
+	tabBar rect
+	tabs   []rect
+	// tabsBefore and tabsAfter report tabs scrolled out of the strip at
+	// either end.
+	tabsBefore bool
+	tabsAfter  bool
+	// Paged engines show perPage entries at a time; page is the one
+	// holding the focused entry.
+	page    int
+	pages   int
+	perPage int
+}
+
+// layoutScreen places the cells for state on a width x height screen.
+func layoutScreen(state appState, width, height int) screenLayout {
 	statusHeight := 1
 	if height < 2 {
 		statusHeight = 0
 	}
-	gridHeight := height - statusHeight
-	if gridHeight <= 0 {
-		return 0
+	area := rect{x0: 0, y0: 0, x1: width, y1: height - statusHeight}
+	out := screenLayout{engine: currentLayout(state), focus: -1}
+	if state.zoomed {
+		out.engine = zoomLayout{}
 	}
-	cols, rows := gridDims(count)
-	if cols <= 0 || rows <= 0 {
-		return 0
+	if area.empty() {
+		return out
 	}
-	row := index / cols
-	y0 := (gridHeight * row) / rows
-	y1 := (gridHeight * (row + 1)) / rows
-	h := y1 - y0
-	if h <= 1 {
-		return 0
+
+	var groups [][]string
+	if state.windowCells() {
+		groups = levelGroups(state.sessions, navWindow)
+	} else {
+		for _, name := range orderedSessionNames(state) {
+			groups = append(groups, []string{name})
+		}
 	}
-	contentTop := y0 + 2
-	if h <= 3 {
-		contentTop = y0 + 1
+	out.focus = focusGroup(groups, focusedKey(state))
+	if bar, ok := out.engine.(tabBarLayout); ok && len(groups) > 0 {
+		out.tabBar = bar.tabBar(area)
+		area.y0 = out.tabBar.y1
+		labels := make([]string, 0, len(groups))
+		for _, keys := range groups {
+			labels = append(labels, frameLabel(state, keys))
+		}
+		out.tabs, out.tabsBefore, out.tabsAfter = tabSpans(out.tabBar, labels, out.focus)
 	}
-	contentHeight := y1 - 1 - contentTop
-	if contentHeight < 0 {
-		return 0
+	focus := maxInt(out.focus, 0)
+	first, count := 0, len(groups)
+	out.pages, out.perPage = 1, count
+	if paged, ok := out.engine.(pagedLayout); ok && count > 0 {
+		out.perPage = maxInt(1, paged.capacity(area, count, state.minCellWidth, state.minCellHeight))
+		out.pages = (count + out.perPage - 1) / out.perPage
+		out.page = focus / out.perPage
+		first = out.page * out.perPage
+		count = minInt(out.perPage, len(groups)-first)
 	}
-	return contentHeight
+	cells := out.engine.cells(count, focus-first, area)
+	out.frames = make([]cellFrame, 0, len(groups))
+	for i, keys := range groups {
+		var cell rect
+		if i >= first && i < first+count {
+			cell = cells[i-first]
+		}
+		out.frames = append(out.frames, cellFrame{cell: cell, keys: keys})
+	}
+	return out
 }
 
-func sessionIndexAt(screen tcell.Screen, count, x, y int) int {
-	if count <= 0 {
-		return -1
+// windowCells reports whether cells hold whole tmux windows. Zoom always
+// shows the focused pane on its own.
+func (s appState) windowCells() bool {
+	return s.windowLayout && !s.zoomed
+}
+
+// frameLabel names a cell in the tab strip.
+func frameLabel(state appState, keys []string) string {
+	sess := state.sessions[keys[0]]
+	if state.windowCells() {
+		return fmt.Sprintf("%s:%d", sess.name, sess.windowIndex)
 	}
-	width, height := screen.Size()
-	if width <= 0 || height <= 0 {
-		return -1
+	if sess.paneID == "" {
+		return sess.name
 	}
-	statusHeight := 1
-	if height < 2 {
-		statusHeight = 0
+	return fmt.Sprintf("%s:%d.%d", sess.name, sess.windowIndex, sess.paneIndex)
+}
+
+// tabSpans places " label " tabs left to right in bar. When they do not
+// all fit, the strip is scrolled just far enough to show the focused tab;
+// before and after report tabs cut off at either end, which leave room for
+// a < or > marker. Tabs off the strip get empty spans.
+func tabSpans(bar rect, labels []string, focus int) (spans []rect, before, after bool) {
+	focus = clampInt(focus, 0, len(labels)-1)
+	for first := 0; ; first++ {
+		spans, last := placeTabs(bar, labels, first, first == focus)
+		if last >= focus || first >= focus {
+			return spans, first > 0, last < len(labels)-1
+		}
 	}
-	gridHeight := height - statusHeight
-	if gridHeight <= 0 {
-		return -1
+}
+
+// placeTabs lays out tabs from labels[first] on until one does not fit and
+// returns the index of the last one placed. A clipped tab is shown only
+// when it is first and clip is set, so a focused label wider than the strip
+// still appears.
+func placeTabs(bar rect, labels []string, first int, clip bool) (spans []rect, last int) {
+	spans = make([]rect, len(labels))
+	x := bar.x0
+	if first > 0 {
+		x += 2
 	}
-	if x < 0 || y < 0 || x >= width || y >= gridHeight {
-		return -1
+	end := x - 1
+	for _, label := range labels[first:] {
+		end += textWidth(label) + 3
 	}
-	cols, rows := gridDims(count)
-	if cols <= 0 || rows <= 0 {
-		return -1
+	limit := bar.x1
+	if end > bar.x1 {
+		limit -= 2
+	}
+	last = first - 1
+	for i := first; i < len(labels); i++ {
+		w := textWidth(labels[i]) + 2
+		if x+w > limit {
+			if i == first && clip && x < limit {
+				spans[i] = rect{x0: x, y0: bar.y0, x1: limit, y1: bar.y1}
+				last = i
+			}
+			break
+		}
+		spans[i] = rect{x0: x, y0: bar.y0, x1: x + w, y1: bar.y1}
+		last = i
+		x += w + 1
+	}
+	return spans, last
+}
+
+// windowPanes lays a window frame's panes out inside its content area. The
+// layout comes from #{window_layout}; when it is missing, unparsable or does
+// not mention every listed pane, the panes are stacked instead. byPane maps
+// pane ids to view keys.
+func windowPanes(state appState, frame cellFrame) (layout windowLayout, placed map[string]rect, byPane map[string]string) {
+	byPane = make(map[string]string, len(frame.keys))
+	paneIDs := make([]string, 0, len(frame.keys))
+	for _, key := range frame.keys {
+		paneID := state.sessions[key].paneID
+		byPane[paneID] = key
+		paneIDs = append(paneIDs, paneID)
+	}
+	layout, err := parseWindowLayout(state.sessions[frame.keys[0]].windowLayout)
+	if err == nil {
+		known := make(map[string]struct{}, len(layout.panes))
+		for _, pane := range layout.panes {
+			known[pane.id] = struct{}{}
+		}
+		for _, paneID := range paneIDs {
+			if _, ok := known[paneID]; !ok {
+				err = fmt.Errorf("window layout: pane %s missing", paneID)
+				break
+			}
+		}
+	}
+	if err != nil {
+		layout = stackedWindowLayout(paneIDs)
 	}
-	col := (x * cols) / width
-	row := (y * rows) / gridHeight
-	idx := row*cols + col
-	if idx >= count {
+	return layout, layout.place(cellContentRect(frame.cell)), byPane
+}
+
+// viewRects returns the content area of every view on screen.
+func viewRects(state appState, screen tcell.Screen) map[string]rect {
+	width, height := screen.Size()
+	rects := make(map[string]rect, len(state.sessions))
+	for _, frame := range layoutScreen(state, width, height).frames {
+		if frame.cell.empty() {
+			continue
+		}
+		if !state.windowCells() {
+			rects[frame.keys[0]] = cellContentRect(frame.cell)
+			continue
+		}
+		_, placed, byPane := windowPanes(state, frame)
+		for paneID, key := range byPane {
+			rects[key] = placed[paneID]
+		}
+	}
+	return rects
+}
+
+// viewIndexAt returns the index in orderedSessionNames of the view at x,y:
+// the view whose cell, pane or tab is there, or -1.
+func viewIndexAt(state appState, screen tcell.Screen, x, y int) int {
+	width, height := screen.Size()
+	layout := layoutScreen(state, width, height)
+	names := orderedSessionNames(state)
+	for i, tab := range layout.tabs {
+		if tab.contains(x, y) {
+			return focusIndexForName(names, groupEntry(state.sessions, layout.frames[i].keys))
+		}
+	}
+	if !state.windowCells() {
+		for _, frame := range layout.frames {
+			if frame.cell.contains(x, y) {
+				return focusIndexForName(names, frame.keys[0])
+			}
+		}
 		return -1
 	}
-	return idx
+	rects := viewRects(state, screen)
+	for i, name := range names {
+		if r, ok := rects[name]; ok && r.contains(x, y) {
+			return i
+		}
+	}
+	return -1
+}
+
+// focusedContentHeight is the number of lines the focused view shows.
+func focusedContentHeight(state appState, screen tcell.Screen, names []string) int {
+	r, ok := viewRects(state, screen)[names[state.focusIndex]]
+	if !ok || r.empty() {
+		return 0
+	}
+	return r.y1 - r.y0
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// layoutEngine arranges the cells of the grid area. cells returns one rect
+// per entry; entries it does not show get an empty rect. focus is the index
+// of the focused entry.
+type layoutEngine interface {
+	name() string
+	cells(count, focus int, area rect) []rect
+}
+
+// tabBarLayout is implemented by engines that reserve a tab strip.
+type tabBarLayout interface {
+	tabBar(area rect) rect
+}
+
+// pagedLayout is implemented by engines whose cells shrink as entries are
+// added. capacity is how many of count entries fit in area without a cell
+// dropping below minWidth x minHeight; the rest go on further pages.
+type pagedLayout interface {
+	capacity(area rect, count, minWidth, minHeight int) int
+}
+
+// layoutEngines lists the engines in the order the layout key cycles them.
+var layoutEngines = []layoutEngine{
+	gridLayout{},
+	mainStackLayout{},
+	rowsLayout{},
+	columnsLayout{},
+	tabsLayout{},
+}
+
+func layoutNames() []string {
+	names := make([]string, 0, len(layoutEngines))
+	for _, engine := range layoutEngines {
+		names = append(names, engine.name())
+	}
+	return names
+}
+
+func layoutByName(name string) (layoutEngine, error) {
+	for _, engine := range layoutEngines {
+		if engine.name() == name {
+			return engine, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown layout %q (want one of %s)", name, strings.Join(layoutNames(), ", "))
+}
+
+// currentLayout is the engine named by state.layout, the grid by default.
+func currentLayout(state appState) layoutEngine {
+	if engine, err := layoutByName(state.layout); err == nil {
+		return engine
+	}
+	return layoutEngines[0]
+}
+
+// nextLayout returns the name of the engine after current.
+func nextLayout(current string) string {
+	for i, engine := range layoutEngines {
+		if engine.name() == current {
+			return layoutEngines[(i+1)%len(layoutEngines)].name()
+		}
+	}
+	return layoutEngines[0].name()
+}
+
+// gridLayout is the near-square grid from gridDims.
+type gridLayout struct{}
+
+func (gridLayout) name() string { return "grid" }
+
+func (gridLayout) cells(count, _ int, area rect) []rect {
+	cols, rows := gridDims(count)
+	w := area.x1 - area.x0
+	h := area.y1 - area.y0
+	out := make([]rect, count)
+	for i := range out {
+		col := i % cols
+		row := i / cols
+		out[i] = rect{
+			x0: area.x0 + (w*col)/cols,
+			y0: area.y0 + (h*row)/rows,
+			x1: area.x0 + (w*(col+1))/cols,
+			y1: area.y0 + (h*(row+1))/rows,
+		}
+	}
+	return out
+}
+
+func (gridLayout) capacity(area rect, count, minWidth, minHeight int) int {
+	w := area.x1 - area.x0
+	h := area.y1 - area.y0
+	fits := 1
+	for n := 2; n <= count; n++ {
+		cols, rows := gridDims(n)
+		if w/cols < minWidth || h/rows < minHeight {
+			break
+		}
+		fits = n
+	}
+	return fits
+}
+
+// mainStackLayout gives the focused entry the left three fifths and stacks
+// the others on the right.
+type mainStackLayout struct{}
+
+func (mainStackLayout) name() string { return "main" }
+
+func (mainStackLayout) cells(count, focus int, area rect) []rect {
+	out := make([]rect, count)
+	if count == 0 {
+		return out
+	}
+	if count == 1 {
+		out[0] = area
+		return out
+	}
+	split := area.x0 + (area.x1-area.x0)*3/5
+	out[focus] = rect{x0: area.x0, y0: area.y0, x1: split, y1: area.y1}
+	stack := splitRows(rect{x0: split, y0: area.y0, x1: area.x1, y1: area.y1}, count-1)
+	j := 0
+	for i := range out {
+		if i == focus {
+			continue
+		}
+		out[i] = stack[j]
+		j++
+	}
+	return out
+}
+
+func (mainStackLayout) capacity(area rect, count, _, minHeight int) int {
+	return 1 + stackCapacity(area.y1-area.y0, minHeight)
+}
+
+// rowsLayout stacks full-width cells top to bottom.
+type rowsLayout struct{}
+
+func (rowsLayout) name() string { return "rows" }
+
+func (rowsLayout) cells(count, _ int, area rect) []rect {
+	return splitRows(area, count)
+}
+
+func (rowsLayout) capacity(area rect, count, _, minHeight int) int {
+	return stackCapacity(area.y1-area.y0, minHeight)
+}
+
+// columnsLayout puts full-height cells side by side.
+type columnsLayout struct{}
+
+func (columnsLayout) name() string { return "columns" }
+
+func (columnsLayout) cells(count, _ int, area rect) []rect {
+	out := make([]rect, count)
+	w := area.x1 - area.x0
+	for i := range out {
+		out[i] = rect{x0: area.x0 + w*i/count, y0: area.y0, x1: area.x0 + w*(i+1)/count, y1: area.y1}
+	}
+	return out
+}
+
+func (columnsLayout) capacity(area rect, count, minWidth, _ int) int {
+	return stackCapacity(area.x1-area.x0, minWidth)
+}
+
+// tabsLayout shows only the focused entry, below a one-line tab strip.
+type tabsLayout struct{}
+
+func (tabsLayout) name() string { return "tabs" }
+
+func (tabsLayout) cells(count, focus int, area rect) []rect {
+	return zoomLayout{}.cells(count, focus, area)
+}
+
+func (tabsLayout) tabBar(area rect) rect {
+	return rect{x0: area.x0, y0: area.y0, x1: area.x1, y1: minInt(area.y0+1, area.y1)}
+}
+
+// zoomLayout gives the focused entry the whole area. It is not in
+// layoutEngines: zoom overrides whichever engine is active.
+type zoomLayout struct{}
+
+func (zoomLayout) name() string { return "zoom" }
+
+func (zoomLayout) cells(count, focus int, area rect) []rect {
+	out := make([]rect, count)
+	if count > 0 {
+		out[focus] = area
+	}
+	return out
+}
+
+// stackCapacity is how many cells of at least min fit in span; any number
+// fits when min is not set.
+func stackCapacity(span, min int) int {
+	if min <= 0 {
+		return math.MaxInt32
+	}
+	return maxInt(1, span/min)
+}
+
+func splitRows(area rect, count int) []rect {
+	out := make([]rect, count)
+	h := area.y1 - area.y0
+	for i := range out {
+		out[i] = rect{x0: area.x0, y0: area.y0 + h*i/count, x1: area.x1, y1: area.y0 + h*(i+1)/count}
+	}
+	return out
+}
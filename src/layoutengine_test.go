@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestLayoutEnginesPlaceCells(t *testing.T) {
+	area := rect{x0: 0, y0: 0, x1: 100, y1: 30}
+	cases := []struct {
+		engine layoutEngine
+		focus  int
+		want   []rect
+	}{
+		{gridLayout{}, 0, []rect{{0, 0, 50, 15}, {50, 0, 100, 15}, {0, 15, 50, 30}}},
+		{mainStackLayout{}, 1, []rect{{60, 0, 100, 15}, {0, 0, 60, 30}, {60, 15, 100, 30}}},
+		{rowsLayout{}, 0, []rect{{0, 0, 100, 10}, {0, 10, 100, 20}, {0, 20, 100, 30}}},
+		{columnsLayout{}, 0, []rect{{0, 0, 33, 30}, {33, 0, 66, 30}, {66, 0, 100, 30}}},
+		{tabsLayout{}, 2, []rect{{}, {}, {0, 0, 100, 30}}},
+	}
+	for _, c := range cases {
+		if got := c.engine.cells(3, c.focus, area); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%s cells = %v, want %v", c.engine.name(), got, c.want)
+		}
+	}
+}
+
+func TestLayoutByNameAndCycle(t *testing.T) {
+	if _, err := layoutByName("spiral"); err == nil || !strings.Contains(err.Error(), "grid, main, rows, columns, tabs") {
+		t.Fatalf("unknown layout error = %v", err)
+	}
+	name := "grid"
+	for range layoutEngines {
+		name = nextLayout(name)
+	}
+	if name != "grid" {
+		t.Fatalf("cycling all layouts ended on %q", name)
+	}
+	if engine := currentLayout(appState{}); engine.name() != "grid" {
+		t.Fatalf("default layout = %q", engine.name())
+	}
+}
+
+func TestTabsLayoutDrawsFocusedEntryAndHitTestsTabs(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(40, 10)
+
+	state := appState{
+		sessions: map[string]sessionView{
+			"a": {key: "a", name: "alpha", paneID: "%1", lines: []string{"alpha out"}},
+			"b": {key: "b", name: "beta", paneID: "%2", lines: []string{"beta out"}},
+		},
+		scroll:     map[string]int{},
+		follow:     map[string]bool{"a": true, "b": true},
+		focusIndex: 1,
+		layout:     "tabs",
+	}
+	draw(screen, state, config{})
+
+	if row := readScreenRow(screen, 0, 40); !strings.HasPrefix(row, " alpha:0.0   beta:0.0 ") {
+		t.Fatalf("tab strip = %q", row)
+	}
+	if row := readScreenRow(screen, 3, 40); !strings.HasPrefix(row, "|beta out") {
+		t.Fatalf("content = %q", row)
+	}
+	if idx := viewIndexAt(state, screen, 2, 0); idx != 0 {
+		t.Fatalf("click on first tab = %d", idx)
+	}
+	if h := focusedContentHeight(state, screen, orderedSessionNames(state)); h != 5 {
+		t.Fatalf("focused content height = %d", h)
+	}
+	state.focusIndex = 0
+	if h := focusedContentHeight(state, screen, orderedSessionNames(state)); h != 5 {
+		t.Fatalf("content height after switching tabs = %d", h)
+	}
+}
+
+func TestTabStripScrollsToFocusedTab(t *testing.T) {
+	screen := newTextScreen(t, 40, 10)
+	state := appState{sessions: map[string]sessionView{}, scroll: map[string]int{}, follow: map[string]bool{}, layout: "tabs"}
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("s%d", i)
+		state.sessions[key] = sessionView{key: key, name: key, paneID: fmt.Sprintf("%%%d", i), lines: []string{key + " out"}}
+	}
+	for _, tc := range []struct {
+		focus int
+		strip string
+		last  int
+	}{
+		{0, " s0:0.0   s1:0.0   s2:0.0   s3:0.0     >", 3},
+		{6, "<  s3:0.0   s4:0.0   s5:0.0   s6:0.0   >", 6},
+		{7, "<  s4:0.0   s5:0.0   s6:0.0   s7:0.0    ", 7},
+	} {
+		state.focusIndex = tc.focus
+		draw(screen, state, config{})
+		if row := readScreenRow(screen, 0, 40); row != tc.strip {
+			t.Fatalf("focus %d: tab strip = %q, want %q", tc.focus, row, tc.strip)
+		}
+		if idx := viewIndexAt(state, screen, 33, 0); idx != tc.last {
+			t.Fatalf("focus %d: click on the last shown tab = %d, want %d", tc.focus, idx, tc.last)
+		}
+	}
+}
+
+func TestZoomShowsFocusedPaneAndKeepsLayout(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(40, 12)
+
+	pane := func(id string, index int) sessionView {
+		return sessionView{key: id, name: "alpha", paneID: id, paneIndex: index, windowLayout: "b25d,80x24,0,0{40x24,0,0,1,39x24,41,0,2}", lines: []string{"out " + id}}
+	}
+	state := appState{
+		sessions:     map[string]sessionView{"%1": pane("%1", 0), "%2": pane("%2", 1)},
+		scroll:       map[string]int{"%2": 3},
+		follow:       map[string]bool{},
+		focusIndex:   1,
+		layout:       "columns",
+		windowLayout: true,
+		zoomed:       true,
+	}
+	names := orderedSessionNames(state)
+	if h := focusedContentHeight(state, screen, names); h != 8 {
+		t.Fatalf("zoomed content height = %d", h)
+	}
+	draw(screen, state, config{})
+	if row := readScreenRow(screen, 1, 40); !strings.HasPrefix(row, "|alpha:0.1 (%2)") {
+		t.Fatalf("zoomed title = %q", row)
+	}
+	if idx := viewIndexAt(state, screen, 30, 5); idx != 1 {
+		t.Fatalf("zoomed hit test = %d", idx)
+	}
+
+	state.zoomed = false
+	if layout := layoutScreen(state, 40, 12); layout.engine.name() != "columns" || len(layout.frames) != 1 {
+		t.Fatalf("unzoomed layout = %s with %d frames", layout.engine.name(), len(layout.frames))
+	}
+	if state.scroll["%2"] != 3 {
+		t.Fatalf("scroll position lost: %v", state.scroll)
+	}
+}
+
+func TestGridPaginatesAtMinimumCellSize(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(60, 20)
+
+	state := appState{
+		sessions:      map[string]sessionView{},
+		scroll:        map[string]int{},
+		follow:        map[string]bool{},
+		focusIndex:    8,
+		minCellWidth:  20,
+		minCellHeight: 6,
+	}
+	for _, key := range strings.Split("a b c d e f g h i j", " ") {
+		state.sessions[key] = sessionView{key: key, name: key}
+	}
+
+	layout := layoutScreen(state, 60, 20)
+	if layout.pages != 2 || layout.perPage != 9 || layout.page != 0 {
+		t.Fatalf("page %d/%d with %d per page", layout.page, layout.pages, layout.perPage)
+	}
+	for _, frame := range layout.frames[:9] {
+		if w, h := frame.cell.x1-frame.cell.x0, frame.cell.y1-frame.cell.y0; w < 20 || h < 6 {
+			t.Fatalf("cell %v below the minimum size", frame.cell)
+		}
+	}
+	if !layout.frames[9].cell.empty() {
+		t.Fatalf("entry on the next page was placed: %v", layout.frames[9].cell)
+	}
+
+	moveFocus(&state, 1)
+	if layout := layoutScreen(state, 60, 20); layout.page != 1 || layout.frames[9].cell.empty() {
+		t.Fatalf("focus did not carry to the second page")
+	}
+	drawStatus(screen, 60, 19, tcell.StyleDefault, state, config{}, 10)
+	if row := readScreenRow(screen, 19, 60); !strings.Contains(row, "page:2/2") {
+		t.Fatalf("status = %q", row)
+	}
+
+	movePage(&state, screen, -1)
+	if state.focusName != "a" {
+		t.Fatalf("page left focused %q", state.focusName)
+	}
+	movePage(&state, screen, -1)
+	if state.focusName != "a" {
+		t.Fatalf("page left past the first page focused %q", state.focusName)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -23,8 +24,11 @@ func main() {
 		socketGlob:           defaultLisaSocketGlob,
 	}
 	showVersion := false
+	checkKeys := false
 	flag.IntVar(&cfg.lines, "lines", 500, "number of lines to capture per session")
 	flag.DurationVar(&cfg.interval, "interval", 1*time.Second, "refresh interval")
+	flag.DurationVar(&cfg.minInterval, "min-interval", 250*time.Millisecond, "refresh interval for the focused pane and busy panes")
+	flag.DurationVar(&cfg.maxInterval, "max-interval", 8*time.Second, "refresh interval idle panes back off to")
 	flag.DurationVar(&cfg.cmdTimeout, "cmd-timeout", 900*time.Millisecond, "timeout for each tmux command")
 	flag.IntVar(&cfg.maxWorkers, "workers", 4, "max concurrent tmux capture workers")
 	flag.BoolVar(&cfg.allPanes, "all-panes", true, "capture and render all panes (false: active pane only)")
@@ -32,6 +36,20 @@ func main() {
 	flag.BoolVar(&cfg.includeLisaSockets, "include-lisa-sockets", true, "include lisa sockets from socket-glob")
 	flag.StringVar(&cfg.socketGlob, "socket-glob", defaultLisaSocketGlob, "glob used to discover lisa sockets")
 	flag.Var((*stringSliceFlag)(&cfg.explicitSockets), "socket", "explicit tmux socket path (repeatable)")
+	flag.StringVar(&cfg.layout, "layout", "grid", "cell layout: "+strings.Join(layoutNames(), ", "))
+	flag.IntVar(&cfg.minCellWidth, "min-cell-width", 24, "minimum cell width before the grid is split into pages")
+	flag.IntVar(&cfg.minCellHeight, "min-cell-height", 6, "minimum cell height before the grid is split into pages")
+	flag.StringVar(&cfg.theme, "theme", builtinThemes[0].name, "colour theme (built-in or from the theme file)")
+	flag.StringVar(&cfg.themeFile, "theme-file", "", "JSON file with user themes (default: themes.json in the user config dir)")
+	flag.StringVar(&cfg.keysFile, "keys-file", "", "JSON file with key bindings (default: keys.json in the user config dir)")
+	flag.BoolVar(&checkKeys, "check-keys", false, "print the key bindings and any conflicts, then exit")
+	flag.StringVar(&cfg.thumbnail, "thumbnail", "off", "draw panes larger than their cell as thumbnails: "+strings.Join(thumbnailNames, ", "))
+	flag.StringVar(&cfg.statusLeft, "status-left", defaultStatusLeft, "status bar segments on the left: "+strings.Join(statusSegmentNames(), ", "))
+	flag.StringVar(&cfg.statusCenter, "status-center", defaultStatusCenter, "status bar segments in the centre")
+	flag.StringVar(&cfg.statusRight, "status-right", defaultStatusRight, "status bar segments on the right")
+	flag.BoolVar(&cfg.windowLayout, "window-layout", false, "draw the panes of each tmux window in one cell, arranged as in tmux")
+	flag.BoolVar(&cfg.mousePassthrough, "mouse-passthrough", false, "forward clicks, drags and wheel events to panes whose application reads the mouse (toggle with f)")
+	flag.BoolVar(&cfg.controlMode, "control-mode", false, "stream pane output through one tmux control-mode client per session (falls back to polling)")
 	flag.BoolVar(&showVersion, "version", false, "print version and exit")
 	flag.BoolVar(&showVersion, "v", false, "print version and exit (shorthand)")
 	flag.Parse()
@@ -41,15 +59,74 @@ func main() {
 		return
 	}
 
+	if _, err := layoutByName(cfg.layout); err != nil {
+		fmt.Println(err)
+		return
+	}
+	thumbnail, err := thumbnailByName(cfg.thumbnail)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, spec := range []string{cfg.statusLeft, cfg.statusCenter, cfg.statusRight} {
+		if _, err := parseStatusSegments(spec); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	themes, err := loadThemes(cfg.themeFile, noColorRequested())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := themeByName(themes, cfg.theme); err != nil {
+		fmt.Println(err)
+		return
+	}
+	keymap, err := loadKeymap(cfg.keysFile)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if checkKeys {
+		for _, line := range keymap.describe() {
+			fmt.Println(line)
+		}
+	}
+	if conflicts := keymap.conflicts(); len(conflicts) > 0 {
+		fmt.Println("key binding conflicts:")
+		for _, c := range conflicts {
+			fmt.Println("  " + c)
+		}
+		return
+	}
+	if checkKeys {
+		return
+	}
 	if cfg.lines < 20 {
 		cfg.lines = 20
 	}
 	if cfg.interval < 200*time.Millisecond {
 		cfg.interval = 200 * time.Millisecond
 	}
+	if cfg.minInterval < 200*time.Millisecond {
+		cfg.minInterval = 200 * time.Millisecond
+	}
+	if cfg.minInterval > cfg.interval {
+		cfg.minInterval = cfg.interval
+	}
+	if cfg.maxInterval < cfg.interval {
+		cfg.maxInterval = cfg.interval
+	}
 	if cfg.cmdTimeout < 300*time.Millisecond {
 		cfg.cmdTimeout = 300 * time.Millisecond
 	}
+	if cfg.minCellWidth < 3 {
+		cfg.minCellWidth = 3
+	}
+	if cfg.minCellHeight < 3 {
+		cfg.minCellHeight = 3
+	}
 	if cfg.maxWorkers < 1 {
 		cfg.maxWorkers = 1
 	}
@@ -66,8 +143,13 @@ func main() {
 	defer screen.Fini()
 
 	screen.EnableMouse()
+	screen.EnablePaste()
 
-	state := appState{sessions: map[string]sessionView{}, scroll: map[string]int{}, follow: map[string]bool{}, mouseEnabled: true}
+	state := appState{sessions: map[string]sessionView{}, scroll: map[string]int{}, follow: map[string]bool{}, mouseEnabled: true, passthrough: cfg.mousePassthrough, windowLayout: cfg.windowLayout, layout: cfg.layout, minCellWidth: cfg.minCellWidth, minCellHeight: cfg.minCellHeight, theme: cfg.theme, themes: themes, thumbnail: thumbnail, keymap: keymap, schedule: newRefreshScheduler(), health: newHealthTracker()}
+	if cfg.controlMode {
+		state.control = newControlManager()
+		defer state.control.close()
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -89,24 +171,24 @@ func main() {
 		}
 	}()
 
-	refresh := func() {
-		updateState(ctx, &state, cfg)
-		draw(screen, state, cfg)
-	}
+	refresher := newRefresher(cfg, refreshSources{control: state.control, schedule: state.schedule, health: state.health})
+	go refresher.run(ctx)
 
-	refresh()
-	ticker := time.NewTicker(cfg.interval)
-	defer ticker.Stop()
-	resetTicker := func() {
-		ticker.Stop()
-		ticker = time.NewTicker(cfg.interval)
-	}
+	statusTicker := time.NewTicker(time.Second)
+	defer statusTicker.Stop()
 
+	draw(screen, state, cfg)
 	running := true
 	for running {
+		refresher.setFocus(state.focusName)
 		select {
-		case <-ticker.C:
-			refresh()
+		case snap := <-refresher.snapshots:
+			applySnapshot(&state, snap)
+			draw(screen, state, cfg)
+		case now := <-statusTicker.C:
+			if expireToasts(&state, now) || statusUsesClock(cfg) {
+				draw(screen, state, cfg)
+			}
 		case update := <-updateCh:
 			if update.err == nil && update.available {
 				state.updatePrompt = true
@@ -122,155 +204,25 @@ func main() {
 			case *tcell.EventResize:
 				screen.Sync()
 				draw(screen, state, cfg)
-			case *tcell.EventKey:
-				if state.updatePrompt {
-					if tev.Key() == tcell.KeyEsc {
-						if err := sendKeyToFocused(ctx, &state, cfg, "Escape", false); err != nil {
-							state.lastErr = err.Error()
-						}
-						draw(screen, state, cfg)
-						break
-					}
-					if isCtrlS(tev) {
-						state.updatePrompt = false
-						state.updateVersion = ""
-						draw(screen, state, cfg)
-						break
-					}
-					action, handled := handleUpdateKey(&state, tev)
-					if handled {
-						if action == updateNow {
-							updated, err := runUpdateFlow(screen, state.updateVersion)
-							if err != nil && !updated {
-								state.lastErr = err.Error()
-								draw(screen, state, cfg)
-								break
-							}
-							if updated {
-								running = false
-								break
-							}
-						}
-						draw(screen, state, cfg)
-						break
-					}
-				}
-				if state.composeActive {
-					if handleComposeKey(ctx, &state, cfg, tev) {
-						draw(screen, state, cfg)
-					}
-					continue
+			case *tcell.EventPaste:
+				keys := keyContext{ctx: ctx, screen: screen, state: &state, cfg: &cfg, refresher: refresher}
+				if handlePaste(&keys, tev) {
+					draw(screen, state, cfg)
 				}
-				if state.selectTarget {
-					if handleSelectKey(ctx, &state, cfg, tev, screen) {
-						draw(screen, state, cfg)
-					}
+			case *tcell.EventKey:
+				if state.pasting {
+					collectPaste(&state, tev)
 					continue
 				}
-				if state.sendKeyActive {
-					if handleSendKey(ctx, &state, cfg, tev) {
-						draw(screen, state, cfg)
-					}
+				keys := keyContext{ctx: ctx, screen: screen, state: &state, cfg: &cfg, refresher: refresher}
+				if !dispatchKey(&keys, tev) {
 					continue
 				}
-				switch tev.Key() {
-				case tcell.KeyCtrlC:
+				if keys.quit {
 					running = false
-				case tcell.KeyCtrlK:
-					if err := killFocusedSession(ctx, &state, cfg); err != nil {
-						state.lastErr = err.Error()
-					}
-					refresh()
-				case tcell.KeyEnter:
-					exit, err := connectFocused(ctx, &state, cfg, screen)
-					if err != nil {
-						if !exit {
-							state.lastErr = err.Error()
-							draw(screen, state, cfg)
-						}
-					}
-					if exit {
-						running = false
-					}
-				case tcell.KeyUp:
-					scrollFocused(&state, screen, -1)
-					draw(screen, state, cfg)
-				case tcell.KeyDown:
-					scrollFocused(&state, screen, 1)
-					draw(screen, state, cfg)
-				case tcell.KeyPgUp:
-					scrollFocused(&state, screen, -5)
-					draw(screen, state, cfg)
-				case tcell.KeyPgDn:
-					scrollFocused(&state, screen, 5)
-					draw(screen, state, cfg)
-				case tcell.KeyHome:
-					jumpScroll(&state, screen, true)
-					draw(screen, state, cfg)
-				case tcell.KeyEnd:
-					jumpScroll(&state, screen, false)
-					draw(screen, state, cfg)
-				case tcell.KeyTAB:
-					moveFocus(&state, 1)
-					draw(screen, state, cfg)
-				case tcell.KeyBacktab:
-					moveFocus(&state, -1)
-					draw(screen, state, cfg)
-				default:
-					switch tev.Rune() {
-					case 'q', 'Q':
-						running = false
-					case 'r', 'R':
-						refresh()
-					case '+':
-						cfg.lines += 50
-						refresh()
-					case '-':
-						cfg.lines -= 50
-						if cfg.lines < 20 {
-							cfg.lines = 20
-						}
-						refresh()
-					case '[':
-						cfg.interval -= 200 * time.Millisecond
-						if cfg.interval < 200*time.Millisecond {
-							cfg.interval = 200 * time.Millisecond
-						}
-						resetTicker()
-						refresh()
-					case ']':
-						cfg.interval += 200 * time.Millisecond
-						resetTicker()
-						refresh()
-					case 'i', 'I':
-						startCompose(&state)
-						draw(screen, state, cfg)
-					case 's', 'S':
-						startSendKey(&state)
-						draw(screen, state, cfg)
-					case 'm', 'M':
-						if state.mouseEnabled {
-							screen.DisableMouse()
-							state.mouseEnabled = false
-						} else {
-							screen.EnableMouse()
-							state.mouseEnabled = true
-						}
-						draw(screen, state, cfg)
-					case 'j', 'J':
-						scrollFocused(&state, screen, 1)
-						draw(screen, state, cfg)
-					case 'k', 'K':
-						scrollFocused(&state, screen, -1)
-						draw(screen, state, cfg)
-					case 'n', 'N':
-						moveFocus(&state, 1)
-						draw(screen, state, cfg)
-					case 'p', 'P':
-						moveFocus(&state, -1)
-						draw(screen, state, cfg)
-					}
+					break
 				}
+				draw(screen, state, cfg)
 			case *tcell.EventMouse:
 				if state.selectTarget {
 					if handleSelectMouse(ctx, &state, cfg, tev, screen) {
@@ -282,6 +234,22 @@ func main() {
 					continue
 				}
 				buttons := tev.Buttons()
+				if state.commandActive {
+					if buttons&(tcell.WheelUp|tcell.Button4) != 0 {
+						scrollPalette(&state, screen, -3)
+					} else if buttons&(tcell.WheelDown|tcell.Button5) != 0 {
+						scrollPalette(&state, screen, 3)
+					}
+					draw(screen, state, cfg)
+					continue
+				}
+				if state.passthrough && !state.showHelp {
+					keys := keyContext{ctx: ctx, screen: screen, state: &state, cfg: &cfg, refresher: refresher}
+					if handleMousePassthrough(&keys, tev) {
+						draw(screen, state, cfg)
+						continue
+					}
+				}
 				if buttons&(tcell.WheelUp|tcell.Button4) != 0 {
 					scrollFocused(&state, screen, -3)
 					draw(screen, state, cfg)
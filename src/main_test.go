@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"github.com/gdamore/tcell/v2"
@@ -47,56 +48,57 @@ func TestFocusIndexForName(t *testing.T) {
 	}
 }
 
-func TestSessionIndexAt(t *testing.T) {
+func TestViewIndexAt(t *testing.T) {
 	screen := tcell.NewSimulationScreen("UTF-8")
 	if err := screen.Init(); err != nil {
 		t.Fatalf("init screen: %v", err)
 	}
 	defer screen.Fini()
 	screen.SetSize(100, 40)
+	state := appState{sessions: map[string]sessionView{"a": {}, "b": {}, "c": {}, "d": {}}}
 
-	if idx := sessionIndexAt(screen, 4, 10, 10); idx != 0 {
+	if idx := viewIndexAt(state, screen, 10, 10); idx != 0 {
 		t.Fatalf("idx at (10,10) = %d", idx)
 	}
-	if idx := sessionIndexAt(screen, 4, 60, 10); idx != 1 {
+	if idx := viewIndexAt(state, screen, 60, 10); idx != 1 {
 		t.Fatalf("idx at (60,10) = %d", idx)
 	}
-	if idx := sessionIndexAt(screen, 4, 10, 25); idx != 2 {
+	if idx := viewIndexAt(state, screen, 10, 25); idx != 2 {
 		t.Fatalf("idx at (10,25) = %d", idx)
 	}
-	if idx := sessionIndexAt(screen, 4, 60, 25); idx != 3 {
+	if idx := viewIndexAt(state, screen, 60, 25); idx != 3 {
 		t.Fatalf("idx at (60,25) = %d", idx)
 	}
-	if idx := sessionIndexAt(screen, 4, 10, 39); idx != -1 {
+	if idx := viewIndexAt(state, screen, 10, 39); idx != -1 {
 		t.Fatalf("idx at (10,39) = %d", idx)
 	}
 }
 
-func TestContentHeightForIndex(t *testing.T) {
+func TestFocusedContentHeight(t *testing.T) {
 	screen := tcell.NewSimulationScreen("UTF-8")
 	if err := screen.Init(); err != nil {
 		t.Fatalf("init screen: %v", err)
 	}
 	defer screen.Fini()
 	screen.SetSize(80, 20)
+	state := appState{sessions: map[string]sessionView{"a": {}, "b": {}}}
 
-	if h := contentHeightForIndex(2, 0, screen); h != 6 {
-		t.Fatalf("contentHeightForIndex = %d", h)
+	if h := focusedContentHeight(state, screen, orderedSessionNames(state)); h != 6 {
+		t.Fatalf("focusedContentHeight = %d", h)
 	}
 }
 
 func TestParseSGRParams(t *testing.T) {
-	params := parseSGRParams("")
-	if len(params) != 1 || params[0] != 0 {
-		t.Fatalf("parse empty = %v", params)
-	}
-	params = parseSGRParams("1;31;0")
-	if len(params) != 3 || params[0] != 1 || params[1] != 31 || params[2] != 0 {
-		t.Fatalf("parse 1;31;0 = %v", params)
-	}
-	params = parseSGRParams(";;")
-	if len(params) != 3 || params[0] != 0 || params[1] != 0 || params[2] != 0 {
-		t.Fatalf("parse ;; = %v", params)
+	for in, want := range map[string][]sgrParam{
+		"":                {{0}},
+		"1;31;0":          {{1}, {31}, {0}},
+		";;":              {{0}, {0}, {0}},
+		"4:3;38:2::1:2:3": {{4, 3}, {38, 2, 0, 1, 2, 3}},
+		"1;x;2":           {{1}, {2}},
+	} {
+		if got := parseSGRParams(in); !reflect.DeepEqual(got, want) {
+			t.Fatalf("parse %q = %v, want %v", in, got, want)
+		}
 	}
 }
 
@@ -120,37 +122,102 @@ func TestApplySGR(t *testing.T) {
 	base := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorBlack)
 	state := ansiState{style: base}
 
-	state = applySGR(state, base, []int{31})
+	state = applySGR(state, base, []sgrParam{{31}})
 	fg, _, _ := state.style.Decompose()
 	if fg != tcell.ColorMaroon {
 		t.Fatalf("fg = %v", fg)
 	}
 
-	state = applySGR(state, base, []int{1})
+	state = applySGR(state, base, []sgrParam{{1}})
 	_, _, attr := state.style.Decompose()
 	if attr&tcell.AttrBold == 0 {
 		t.Fatalf("bold not set")
 	}
 
-	state = applySGR(state, base, []int{38, 2, 10, 20, 30})
+	state = applySGR(state, base, []sgrParam{{38}, {2}, {10}, {20}, {30}})
 	fg, _, _ = state.style.Decompose()
 	if fg != tcell.NewRGBColor(10, 20, 30) {
 		t.Fatalf("rgb fg = %v", fg)
 	}
 
-	state = applySGR(state, base, []int{48, 5, 200})
+	state = applySGR(state, base, []sgrParam{{48}, {5}, {200}})
 	_, bg, _ := state.style.Decompose()
 	if bg != tcell.PaletteColor(200) {
 		t.Fatalf("palette bg = %v", bg)
 	}
 
-	state = applySGR(state, base, []int{0})
+	state = applySGR(state, base, []sgrParam{{0}})
 	fg, bg, _ = state.style.Decompose()
 	if fg != tcell.ColorWhite || bg != tcell.ColorBlack {
 		t.Fatalf("reset fg/bg = %v/%v", fg, bg)
 	}
 }
 
+func TestApplySGRAttributes(t *testing.T) {
+	base := tcell.StyleDefault
+	cases := []struct {
+		sgr  string
+		want tcell.Style
+	}{
+		{"1", base.Bold(true)},
+		{"2", base.Dim(true)},
+		{"3", base.Italic(true)},
+		{"4", base.Underline(true)},
+		{"5", base.Blink(true)},
+		{"6", base.Blink(true)},
+		{"7", base.Reverse(true)},
+		{"9", base.StrikeThrough(true)},
+		{"21", base.Underline(tcell.UnderlineStyleDouble)},
+		{"4:0", base.Underline(tcell.UnderlineStyleNone)},
+		{"4:2", base.Underline(tcell.UnderlineStyleDouble)},
+		{"4:3", base.Underline(tcell.UnderlineStyleCurly)},
+		{"4:4", base.Underline(tcell.UnderlineStyleDotted)},
+		{"4:5", base.Underline(tcell.UnderlineStyleDashed)},
+		{"1;2;22", base},
+		{"3;23", base},
+		{"4:3;24", base.Underline(false)},
+		{"5;25", base},
+		{"7;27", base},
+		{"9;29", base},
+		{"38:5:200", base.Foreground(tcell.PaletteColor(200))},
+		{"38:2::10:20:30", base.Foreground(tcell.NewRGBColor(10, 20, 30))},
+		{"38:2:10:20:30", base.Foreground(tcell.NewRGBColor(10, 20, 30))},
+		{"48:2:0:1:2:3", base.Background(tcell.NewRGBColor(1, 2, 3))},
+		{"58:2::255:0:0", base.Underline(tcell.NewRGBColor(255, 0, 0))},
+		{"58;5;9;59", base.Underline(tcell.ColorDefault)},
+		{"4:3;58;5;1", base.Underline(tcell.UnderlineStyleCurly, tcell.PaletteColor(1))},
+		{"1;3;4:3;9;38;5;1;48:5:2", base.Bold(true).Italic(true).StrikeThrough(true).Underline(tcell.UnderlineStyleCurly).Foreground(tcell.PaletteColor(1)).Background(tcell.PaletteColor(2))},
+		{"1;2;3;4;5;7;9;0", base},
+	}
+	for _, c := range cases {
+		if got := applySGR(ansiState{style: base}, base, parseSGRParams(c.sgr)).style; got != c.want {
+			t.Fatalf("SGR %s = %+v, want %+v", c.sgr, got, c.want)
+		}
+	}
+
+	state := applySGR(ansiState{style: base}, base, parseSGRParams("8;53"))
+	if !state.hidden || !state.overline {
+		t.Fatalf("conceal/overline not tracked: %+v", state)
+	}
+	state = applySGR(state, base, parseSGRParams("28;55"))
+	if state.hidden || state.overline {
+		t.Fatalf("conceal/overline not reset: %+v", state)
+	}
+}
+
+func TestDrawAnsiTextConcealsHiddenText(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 1)
+	drawAnsiText(screen, 0, 0, 10, "a\x1b[8msecret\x1b[28mb", tcell.StyleDefault)
+	if row := readScreenRow(screen, 0, 10); row != "a      b  " {
+		t.Fatalf("row = %q", row)
+	}
+}
+
 func TestDrawAnsiText(t *testing.T) {
 	screen := tcell.NewSimulationScreen("UTF-8")
 	if err := screen.Init(); err != nil {
@@ -178,20 +245,86 @@ func TestDrawAnsiText(t *testing.T) {
 	}
 }
 
-func TestHandleComposeKey(t *testing.T) {
-	state := appState{sessions: map[string]sessionView{}}
+func TestScrollRangeFollowsPaneGeometry(t *testing.T) {
+	// 3 history lines, then a 6-row screen of which only 2 rows have text.
+	sess := sessionView{
+		lines:      []string{"h1", "h2", "h3", "$ ls", "$ "},
+		screenRows: 2,
+		height:     6,
+		cursor:     paneCursor{x: 2, y: 1, visible: true, valid: true},
+	}
+	if follow, max := scrollRange(sess, 10); follow != 0 || max != 0 {
+		t.Fatalf("tall cell = %d/%d, want whole pane from the top", follow, max)
+	}
+	if follow, max := scrollRange(sess, 8); follow != 1 || max != 1 {
+		t.Fatalf("exact cell = %d/%d, want screen anchored to the bottom", follow, max)
+	}
+	if follow, max := scrollRange(sess, 2); follow != 3 || max != 3 {
+		t.Fatalf("short cell = %d/%d, want to end at the cursor row", follow, max)
+	}
+
+	sess.lines = []string{"h1", "top", "", "", "status"}
+	sess.screenRows = 4
+	sess.height = 4
+	sess.cursor = paneCursor{x: 0, y: 0, visible: true, valid: true}
+	if follow, max := scrollRange(sess, 2); follow != 1 || max != 3 {
+		t.Fatalf("cursor above bottom = %d/%d, want cursor row kept in view", follow, max)
+	}
+}
+
+func TestDrawCellDrawsCursorAndCropsToPaneWidth(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 7)
+	body := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorBlack)
+
+	sess := sessionView{
+		key:        "a",
+		name:       "a",
+		lines:      []string{"$ echo hi", "hi", "$ "},
+		screenRows: 3,
+		width:      6,
+		height:     4,
+		cursor:     paneCursor{x: 2, y: 2, visible: true, valid: true},
+	}
+	drawCell(screen, 0, 0, 20, 7, sess, borderSets[0], body, body, body, 0, true, thumbOff)
+
+	if row := readScreenRow(screen, 2, 20); row != "|$ echo            |" {
+		t.Fatalf("first row = %q, want text cropped to the pane width", row)
+	}
+	if row := readScreenRow(screen, 5, 20); row != "|                  |" {
+		t.Fatalf("last row = %q, want the blank last pane row", row)
+	}
+	_, _, style, _ := screen.GetContent(3, 4)
+	if _, _, attrs := style.Decompose(); attrs&tcell.AttrReverse == 0 {
+		t.Fatalf("cursor cell attrs = %v, want reverse", attrs)
+	}
+
+	sess.cursor.visible = false
+	screen.Clear()
+	drawCell(screen, 0, 0, 20, 7, sess, borderSets[0], body, body, body, 0, true, thumbOff)
+	_, _, style, _ = screen.GetContent(3, 4)
+	if _, _, attrs := style.Decompose(); attrs&tcell.AttrReverse != 0 {
+		t.Fatalf("hidden cursor was drawn")
+	}
+}
+
+func TestComposeKeys(t *testing.T) {
+	state := appState{sessions: map[string]sessionView{}, composeActive: true}
 	cfg := config{}
-	ctx := context.Background()
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
 
-	if !handleComposeKey(ctx, &state, cfg, tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModNone)) {
+	if !dispatchKey(&keys, tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModNone)) {
 		t.Fatalf("expected handled")
 	}
-	if state.lastErr == "" {
-		t.Fatalf("expected error when no sessions")
+	if len(state.toasts) != 1 || state.toasts[0].severity != "error" {
+		t.Fatalf("expected an error toast when no sessions, got %+v", state.toasts)
 	}
 
-	state.composeActive = true
-	handleComposeKey(ctx, &state, cfg, tcell.NewEventKey(tcell.KeyCtrlS, 0, tcell.ModNone))
+	dispatchKey(&keys, tcell.NewEventKey(tcell.KeyRune, 's', tcell.ModCtrl))
 	if state.composeActive || state.composeBuf != nil {
 		t.Fatalf("composeActive/composeBuf = %v/%v", state.composeActive, state.composeBuf)
 	}
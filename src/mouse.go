@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// paneMouse is the mouse reporting the application in a pane turned on.
+type paneMouse struct {
+	on     bool // any mouse mode: presses and releases are reported
+	motion bool // button-event or any-event mode: drags are reported too
+	sgr    bool // SGR (1006) encoding rather than the legacy X10 bytes
+}
+
+// paneMouseFormat fetches the pane's mouse flags as one list-panes field.
+const paneMouseFormat = "#{mouse_any_flag}#{mouse_button_flag}#{mouse_all_flag}#{mouse_sgr_flag}"
+
+func parsePaneMouse(v string) paneMouse {
+	flag := func(i int) bool { return i < len(v) && v[i] == '1' }
+	return paneMouse{on: flag(0), motion: flag(1) || flag(2), sgr: flag(3)}
+}
+
+// mouseGrab is the pane a forwarded button press went to. Drags and the
+// release go to it as well, clamped to its edges, the way a terminal keeps
+// reporting to the window a press started in.
+type mouseGrab struct {
+	key    string
+	button int
+	col    int
+	row    int
+}
+
+// Mouse report codes, as xterm numbers them.
+const (
+	mouseLeft      = 0
+	mouseMiddle    = 1
+	mouseRight     = 2
+	mouseDrag      = 32
+	mouseWheelUp   = 64
+	mouseWheelDown = 65
+)
+
+// mouseButtonCode returns the report code of the button or wheel in
+// buttons, with the modifier bits of mods added; ok is false for plain
+// pointer motion.
+func mouseButtonCode(buttons tcell.ButtonMask, mods tcell.ModMask) (code int, ok bool) {
+	switch {
+	case buttons&(tcell.WheelUp|tcell.Button4) != 0:
+		code = mouseWheelUp
+	case buttons&(tcell.WheelDown|tcell.Button5) != 0:
+		code = mouseWheelDown
+	case buttons&tcell.Button1 != 0:
+		code = mouseLeft
+	case buttons&tcell.Button3 != 0:
+		code = mouseMiddle
+	case buttons&tcell.Button2 != 0:
+		code = mouseRight
+	default:
+		return 0, false
+	}
+	if mods&tcell.ModShift != 0 {
+		code |= 4
+	}
+	if mods&tcell.ModAlt != 0 {
+		code |= 8
+	}
+	if mods&tcell.ModCtrl != 0 {
+		code |= 16
+	}
+	return code, true
+}
+
+// mouseSequence encodes a report the way a terminal would for the pane's
+// mode: SGR as ESC [ < code ; x ; y M (m on release), legacy as ESC [ M and
+// three bytes offset by 32, which cannot reach past column or row 223.
+func mouseSequence(mouse paneMouse, code, col, row int, release bool) ([]byte, bool) {
+	if mouse.sgr {
+		final := 'M'
+		if release {
+			final = 'm'
+		}
+		return []byte(fmt.Sprintf("\x1b[<%d;%d;%d%c", code, col+1, row+1, final)), true
+	}
+	if release {
+		// Legacy reports do not say which button went up.
+		code = code&^3 | 3
+	}
+	if col+33 > 0xff || row+33 > 0xff {
+		return nil, false
+	}
+	return []byte{0x1b, '[', 'M', byte(32 + code), byte(33 + col), byte(33 + row)}, true
+}
+
+// sendMouse writes a mouse report to the pane as raw bytes with send-keys
+// -H, so tmux passes it through untranslated.
+func sendMouse(ctx context.Context, cfg config, sess sessionView, seq []byte) error {
+	args := []string{"send-keys", "-t", sess.paneID, "-H"}
+	for _, b := range seq {
+		args = append(args, fmt.Sprintf("%02x", b))
+	}
+	_, err := runTmuxOnSocketFn(ctx, cfg, sess.socketPath, args...)
+	return err
+}
+
+// paneCell maps screen position x, y to a column and row of the screen of
+// the pane drawn in area. mapped is false when the cell cannot be mapped,
+// e.g. while it shows a scaled thumbnail; inside is false when x, y falls on
+// history, blank space past the pane or outside area, where col and row are
+// still set so a grab can clamp them.
+func paneCell(area rect, sess sessionView, scrollTop int, follow bool, thumb thumbnailMode, x, y int) (col, row int, mapped, inside bool) {
+	pane, ok := paneScreen(sess)
+	height := area.y1 - area.y0
+	width := area.x1 - area.x0
+	if !ok || area.empty() {
+		return 0, 0, false, false
+	}
+	if thumb != thumbOff && !(sess.width > 0 && sess.width <= width && pane.rows <= height) {
+		return 0, 0, false, false
+	}
+	followStart, maxStart := scrollRange(sess, height)
+	start := followStart
+	if !follow {
+		start = clampInt(scrollTop, 0, maxStart)
+	}
+	if sess.width > 0 && sess.width < width {
+		width = sess.width
+	}
+	col, row = x-area.x0, start+y-area.y0-pane.top
+	return col, row, true, area.contains(x, y) && col < width && row >= 0 && row < pane.rows
+}
+
+// handleMousePassthrough forwards a mouse event to the pane under the
+// pointer when passthrough is on and the application in the pane asked for
+// mouse reports. A forwarded press also focuses the pane. It reports
+// whether the event was used; otherwise the visualiser handles it itself.
+func handleMousePassthrough(k *keyContext, ev *tcell.EventMouse) bool {
+	state := k.state
+	x, y := ev.Position()
+	buttons := ev.Buttons()
+	rects := viewRects(*state, k.screen)
+
+	if grab := state.mouseGrab; grab.key != "" {
+		sess, ok := state.sessions[grab.key]
+		area, shown := rects[grab.key]
+		if !ok || !shown {
+			state.mouseGrab = mouseGrab{}
+			return false
+		}
+		col, row, mapped, _ := paneCell(area, sess, state.scroll[grab.key], state.follow[grab.key], state.thumbnail, x, y)
+		if mapped {
+			pane, _ := paneScreen(sess)
+			width := sess.width
+			if width <= 0 {
+				width = area.x1 - area.x0
+			}
+			col = clampInt(col, 0, width-1)
+			row = clampInt(row, 0, pane.rows-1)
+		} else {
+			col, row = grab.col, grab.row
+		}
+		if buttons&(tcell.Button1|tcell.Button2|tcell.Button3) == 0 {
+			state.mouseGrab = mouseGrab{}
+			if seq, ok := mouseSequence(sess.mouse, grab.button, col, row, true); ok {
+				k.fail(sendMouse(k.ctx, *k.cfg, sess, seq))
+			}
+			k.refresh(false)
+			return true
+		}
+		if !sess.mouse.motion || col == grab.col && row == grab.row {
+			return true
+		}
+		state.mouseGrab.col, state.mouseGrab.row = col, row
+		if seq, ok := mouseSequence(sess.mouse, grab.button|mouseDrag, col, row, false); ok {
+			k.fail(sendMouse(k.ctx, *k.cfg, sess, seq))
+		}
+		return true
+	}
+
+	code, ok := mouseButtonCode(buttons, ev.Modifiers())
+	if !ok {
+		return false
+	}
+	for key, area := range rects {
+		if !area.contains(x, y) {
+			continue
+		}
+		sess := state.sessions[key]
+		if !sess.mouse.on || sess.paneID == "" {
+			return false
+		}
+		col, row, _, inside := paneCell(area, sess, state.scroll[key], state.follow[key], state.thumbnail, x, y)
+		if !inside {
+			return false
+		}
+		seq, ok := mouseSequence(sess.mouse, code, col, row, false)
+		if !ok {
+			return false
+		}
+		names := orderedSessionNames(*state)
+		if i := focusIndexForName(names, key); i >= 0 {
+			state.focusIndex = i
+			state.focusName = key
+		}
+		if code < mouseWheelUp {
+			state.mouseGrab = mouseGrab{key: key, button: code, col: col, row: row}
+		}
+		k.fail(sendMouse(k.ctx, *k.cfg, sess, seq))
+		k.refresh(false)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestMouseSequence(t *testing.T) {
+	sgr := paneMouse{on: true, sgr: true}
+	legacy := paneMouse{on: true}
+	for _, tc := range []struct {
+		mouse    paneMouse
+		code     int
+		col, row int
+		release  bool
+		want     string
+	}{
+		{sgr, mouseLeft, 0, 0, false, "\x1b[<0;1;1M"},
+		{sgr, mouseRight | 4, 9, 3, true, "\x1b[<6;10;4m"},
+		{sgr, mouseLeft | mouseDrag, 300, 2, false, "\x1b[<32;301;3M"},
+		{legacy, mouseWheelDown, 4, 1, false, "\x1b[M\x61\x25\x22"},
+		{legacy, mouseMiddle | 16, 0, 0, true, "\x1b[M\x33\x21\x21"},
+	} {
+		got, ok := mouseSequence(tc.mouse, tc.code, tc.col, tc.row, tc.release)
+		if !ok || string(got) != tc.want {
+			t.Fatalf("mouseSequence(%+v, %d, %d, %d, %v) = %q, %v; want %q", tc.mouse, tc.code, tc.col, tc.row, tc.release, got, ok, tc.want)
+		}
+	}
+	if _, ok := mouseSequence(legacy, mouseLeft, 223, 0, false); ok {
+		t.Fatalf("legacy report past column 223 accepted")
+	}
+	if got := parsePaneMouse("1001"); got != (paneMouse{on: true, sgr: true}) {
+		t.Fatalf("parsePaneMouse(1001) = %+v", got)
+	}
+	if got := parsePaneMouse("1110"); got != (paneMouse{on: true, motion: true}) {
+		t.Fatalf("parsePaneMouse(1110) = %+v", got)
+	}
+}
+
+func TestMousePassthroughForwardsToPaneUnderPointer(t *testing.T) {
+	screenLines := []string{"menu", "item one", "item two", "", ""}
+	state := appState{
+		sessions: map[string]sessionView{
+			"a": {key: "a", name: "agent", socketPath: "/tmp/a.sock", paneID: "%1", lines: screenLines, screenRows: 5, width: 20, height: 5, mouse: paneMouse{on: true, motion: true, sgr: true}},
+			"b": {key: "b", name: "shell", socketPath: "/tmp/a.sock", paneID: "%2", lines: screenLines, screenRows: 5, width: 20, height: 5},
+		},
+		scroll:      map[string]int{},
+		follow:      map[string]bool{"a": true, "b": true},
+		focusName:   "b",
+		focusIndex:  1,
+		passthrough: true,
+	}
+	cfg := config{}
+	var mu sync.Mutex
+	var sent []string
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() { runTmuxOnSocketFn = origRun })
+	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(args) < 4 || args[0] != "send-keys" || args[3] != "-H" {
+			t.Errorf("unexpected tmux call %q", args)
+			return "", nil
+		}
+		raw, err := hex.DecodeString(strings.Join(args[4:], ""))
+		if err != nil {
+			t.Errorf("bad hex keys %q: %v", args[4:], err)
+		}
+		sent = append(sent, socket+"|"+args[2]+"|"+string(raw))
+		return "", nil
+	}
+	screen := newTextScreen(t, 80, 20)
+	keys := keyContext{ctx: context.Background(), screen: screen, state: &state, cfg: &cfg}
+	rects := viewRects(state, screen)
+	a, b := rects["a"], rects["b"]
+	mouse := func(x, y int, buttons tcell.ButtonMask) bool {
+		return handleMousePassthrough(&keys, tcell.NewEventMouse(x, y, buttons, tcell.ModNone))
+	}
+
+	// Press on "item two", drag past the pane's right edge, release.
+	if !mouse(a.x0+5, a.y0+2, tcell.Button1) || state.focusName != "a" {
+		t.Fatalf("press not forwarded or pane not focused (focus %q)", state.focusName)
+	}
+	mouse(a.x0+5, a.y0+2, tcell.Button1)
+	mouse(a.x0+40, a.y0+2, tcell.Button1)
+	mouse(a.x0+40, a.y0+3, tcell.ButtonNone)
+	want := []string{
+		"/tmp/a.sock|%1|\x1b[<0;6;3M",
+		"/tmp/a.sock|%1|\x1b[<32;20;3M",
+		"/tmp/a.sock|%1|\x1b[<0;20;4m",
+	}
+	if strings.Join(sent, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("sent %q, want %q", sent, want)
+	}
+
+	// The wheel goes to the pane too, and needs no release.
+	sent = nil
+	if !mouse(a.x0, a.y0, tcell.WheelUp) || len(sent) != 1 || sent[0] != "/tmp/a.sock|%1|\x1b[<64;1;1M" || state.mouseGrab.key != "" {
+		t.Fatalf("wheel sent %q, grab %+v", sent, state.mouseGrab)
+	}
+
+	// Below the pane's screen, and in a pane that does not read the mouse,
+	// the visualiser keeps the event.
+	sent = nil
+	if mouse(a.x0+1, a.y0+6, tcell.Button1) || mouse(b.x0+1, b.y0+1, tcell.WheelDown) || len(sent) != 0 {
+		t.Fatalf("event outside a mouse pane forwarded: %q", sent)
+	}
+}
@@ -35,27 +35,18 @@ func scrollFocused(state *appState, screen tcell.Screen, delta int) {
 	if !ok {
 		return
 	}
-	contentHeight := contentHeightForIndex(len(names), state.focusIndex, screen)
+	contentHeight := focusedContentHeight(*state, screen, names)
 	if contentHeight <= 0 {
 		return
 	}
-	maxStart := 0
-	if len(sess.lines) > contentHeight {
-		maxStart = len(sess.lines) - contentHeight
-	}
+	followStart, maxStart := scrollRange(sess, contentHeight)
 	current := state.scroll[name]
 	if state.follow[name] {
-		current = maxStart
-	}
-	next := current + delta
-	if next < 0 {
-		next = 0
-	}
-	if next > maxStart {
-		next = maxStart
+		current = followStart
 	}
+	next := clampInt(current+delta, 0, maxStart)
 	state.scroll[name] = next
-	state.follow[name] = next == maxStart
+	state.follow[name] = next == followStart
 }
 
 func jumpScroll(state *appState, screen tcell.Screen, toTop bool) {
@@ -72,19 +63,99 @@ func jumpScroll(state *appState, screen tcell.Screen, toTop bool) {
 	if !ok {
 		return
 	}
-	contentHeight := contentHeightForIndex(len(names), state.focusIndex, screen)
+	contentHeight := focusedContentHeight(*state, screen, names)
 	if contentHeight <= 0 {
 		return
 	}
-	maxStart := 0
-	if len(sess.lines) > contentHeight {
-		maxStart = len(sess.lines) - contentHeight
-	}
+	followStart, _ := scrollRange(sess, contentHeight)
 	if toTop {
 		state.scroll[name] = 0
 		state.follow[name] = false
 	} else {
-		state.scroll[name] = maxStart
+		state.scroll[name] = followStart
 		state.follow[name] = true
 	}
 }
+
+// focusedKey returns the key of the focused view, or "".
+func focusedKey(state appState) string {
+	names := orderedSessionNames(state)
+	if state.focusIndex < 0 || state.focusIndex >= len(names) {
+		return ""
+	}
+	return names[state.focusIndex]
+}
+
+// focusKey focuses the view with key.
+func focusKey(state *appState, key string) {
+	names := orderedSessionNames(*state)
+	if idx := focusIndexForName(names, key); idx >= 0 {
+		state.focusIndex = idx
+		state.focusName = key
+	}
+}
+
+// moveFocusLevel moves focus delta groups at level, e.g. to the next window
+// or session, landing on the group's active pane.
+func moveFocusLevel(state *appState, level navLevel, delta int) {
+	if level == navPane {
+		moveFocus(state, delta)
+		return
+	}
+	groups := levelGroups(state.sessions, level)
+	stepGroups(state, groups, delta)
+}
+
+// moveWithinParent moves focus delta groups at level without leaving the
+// parent of the focused group: windows of the focused session, or sessions
+// of the focused socket.
+func moveWithinParent(state *appState, level navLevel, delta int) {
+	parents := levelGroups(state.sessions, level.parent())
+	parent := focusGroup(parents, focusedKey(*state))
+	if parent < 0 {
+		moveFocusLevel(state, level, delta)
+		return
+	}
+	inParent := make(map[string]struct{}, len(parents[parent]))
+	for _, key := range parents[parent] {
+		inParent[key] = struct{}{}
+	}
+	var groups [][]string
+	for _, group := range levelGroups(state.sessions, level) {
+		if _, ok := inParent[group[0]]; ok {
+			groups = append(groups, group)
+		}
+	}
+	stepGroups(state, groups, delta)
+}
+
+func stepGroups(state *appState, groups [][]string, delta int) {
+	if len(groups) == 0 {
+		return
+	}
+	idx := focusGroup(groups, focusedKey(*state))
+	if idx < 0 {
+		idx = 0
+	} else {
+		idx = (idx + delta) % len(groups)
+		if idx < 0 {
+			idx += len(groups)
+		}
+	}
+	focusKey(state, groupEntry(state.sessions, groups[idx]))
+}
+
+// movePage focuses the first entry delta pages away when the layout is
+// paginated.
+func movePage(state *appState, screen tcell.Screen, delta int) {
+	width, height := screen.Size()
+	layout := layoutScreen(*state, width, height)
+	if layout.pages <= 1 {
+		return
+	}
+	page := clampInt(layout.page+delta, 0, layout.pages-1)
+	if page == layout.page {
+		return
+	}
+	focusKey(state, groupEntry(state.sessions, layout.frames[page*layout.perPage].keys))
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// tmuxCommands are the tmux command names the palette completes.
+var tmuxCommands = []string{
+	"attach-session", "bind-key", "break-pane", "capture-pane", "choose-buffer", "choose-client", "choose-tree",
+	"clear-history", "clear-prompt-history", "clock-mode", "command-prompt", "confirm-before", "copy-mode",
+	"customize-mode", "delete-buffer", "detach-client", "display-menu", "display-message", "display-panes",
+	"display-popup", "find-window", "has-session", "if-shell", "join-pane", "kill-pane", "kill-server",
+	"kill-session", "kill-window", "last-pane", "last-window", "link-window", "list-buffers", "list-clients",
+	"list-commands", "list-keys", "list-panes", "list-sessions", "list-windows", "load-buffer", "lock-client",
+	"lock-server", "lock-session", "move-pane", "move-window", "new-session", "new-window", "next-layout",
+	"next-window", "paste-buffer", "pipe-pane", "previous-layout", "previous-window", "refresh-client",
+	"rename-session", "rename-window", "resize-pane", "resize-window", "respawn-pane", "respawn-window",
+	"rotate-window", "run-shell", "save-buffer", "select-layout", "select-pane", "select-window", "send-keys",
+	"send-prefix", "server-access", "set-buffer", "set-environment", "set-hook", "set-option",
+	"set-window-option", "show-buffer", "show-environment", "show-hooks", "show-messages", "show-options",
+	"show-prompt-history", "show-window-options", "source-file", "split-window", "start-server",
+	"suspend-client", "swap-pane", "swap-window", "switch-client", "unbind-key", "unlink-window", "wait-for",
+}
+
+// commandPlaceholders are replaced with the focused entry's target before
+// a palette command runs.
+var commandPlaceholders = []string{"{session}", "{pane}", "{socket}"}
+
+// maxCommandHistory bounds the palette history.
+const maxCommandHistory = 100
+
+// commandPalette is the state of the : prompt. history outlives the
+// prompt, so earlier commands are a keypress away when it is reopened;
+// histPos indexes it while browsing (len(history) is the line being typed,
+// kept in draft).
+type commandPalette struct {
+	input   []rune
+	history []string
+	draft   string
+	histPos int
+	// title names the command the output came from; failed marks its
+	// first line as an error.
+	title  string
+	output []string
+	failed bool
+	scroll int
+}
+
+func openPalette(state *appState) {
+	state.commandActive = true
+	state.showHelp = false
+	state.command = commandPalette{history: state.command.history, histPos: len(state.command.history)}
+}
+
+func closePalette(state *appState) {
+	state.commandActive = false
+	state.command = commandPalette{history: state.command.history}
+}
+
+// editPalette replaces the input, which ends any history browsing.
+func editPalette(state *appState, input []rune) {
+	state.command.input = input
+	state.command.histPos = len(state.command.history)
+}
+
+// browseHistory steps through earlier commands (dir -1) or back towards
+// the line being typed (dir 1).
+func browseHistory(state *appState, dir int) {
+	p := &state.command
+	pos := p.histPos + dir
+	if pos < 0 || pos > len(p.history) {
+		return
+	}
+	if p.histPos == len(p.history) {
+		p.draft = string(p.input)
+	}
+	p.histPos = pos
+	if pos == len(p.history) {
+		p.input = []rune(p.draft)
+		return
+	}
+	p.input = []rune(p.history[pos])
+}
+
+// scrollPalette scrolls the output box by delta lines, stopping where its
+// last page is shown the way drawCommandPalette clamps it.
+func scrollPalette(state *appState, screen tcell.Screen, delta int) {
+	p := &state.command
+	_, height := screen.Size()
+	rows := paletteRows(height-1, len(p.output))
+	p.scroll = clampInt(p.scroll+delta, 0, maxInt(len(p.output)-rows, 0))
+}
+
+// paletteRows is the number of output lines the palette box shows when the
+// status bar sits at row bottom.
+func paletteRows(bottom, lines int) int {
+	if lines == 0 {
+		return 0
+	}
+	return minInt(lines, maxInt(bottom/2-3, 1))
+}
+
+// splitCommandLine splits a palette line into arguments the way a shell
+// would: whitespace separates them, single quotes are literal and double
+// quotes and backslashes escape.
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// runPaletteCommand runs the typed line on the focused entry's socket,
+// with its placeholders filled in, and shows the output in the palette.
+func runPaletteCommand(ctx context.Context, state *appState, cfg config) {
+	p := &state.command
+	line := strings.TrimSpace(string(p.input))
+	if line == "" {
+		return
+	}
+	if n := len(p.history); n == 0 || p.history[n-1] != line {
+		p.history = append(p.history, line)
+		if len(p.history) > maxCommandHistory {
+			p.history = p.history[len(p.history)-maxCommandHistory:]
+		}
+	}
+	editPalette(state, nil)
+	p.title, p.output, p.failed, p.scroll = line, nil, false, 0
+
+	out, err := runCommandLine(ctx, *state, cfg, line)
+	if err != nil {
+		p.failed = true
+		p.output = append(p.output, "error: "+err.Error())
+	}
+	if out != "" {
+		p.output = append(p.output, strings.Split(out, "\n")...)
+	}
+	if len(p.output) == 0 {
+		p.output = []string{"(no output)"}
+	}
+}
+
+func runCommandLine(ctx context.Context, state appState, cfg config, line string) (string, error) {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		return "", err
+	}
+	key := focusedKey(state)
+	if key == "" {
+		return "", errors.New("no tmux sessions")
+	}
+	sess := state.sessions[key]
+	paneID := sess.paneID
+	if paneID == "" && strings.Contains(line, "{pane}") {
+		if paneID, err = activePaneID(ctx, cfg, sess.socketPath, sess.name); err != nil {
+			return "", err
+		}
+	}
+	fill := strings.NewReplacer("{session}", sess.name, "{pane}", paneID, "{socket}", sess.socketPath)
+	for i, arg := range args {
+		args[i] = fill.Replace(arg)
+	}
+	return runTmuxOnSocketFn(ctx, cfg, sess.socketPath, args...)
+}
+
+// commandTargets lists what -t can name on the focused entry's socket:
+// the placeholders, then its sessions, windows and panes.
+func commandTargets(state appState) []string {
+	key := focusedKey(state)
+	if key == "" {
+		return commandPlaceholders
+	}
+	socket := state.sessions[key].socketPath
+	seen := map[string]bool{}
+	var targets []string
+	for _, sess := range state.sessions {
+		if sess.socketPath != socket {
+			continue
+		}
+		for _, t := range []string{sess.name, fmt.Sprintf("%s:%d", sess.name, sess.windowIndex), sess.paneID} {
+			if t != "" && !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+	sort.Strings(targets)
+	return append(append([]string(nil), commandPlaceholders...), targets...)
+}
+
+// completePalette completes the last word of the input: a command name
+// first or after a ; separator, a target after -t or -s, or a placeholder
+// after {. A unique match is completed with a trailing space; several are
+// completed to their common prefix and listed in the output.
+func completePalette(state *appState) {
+	input := string(state.command.input)
+	start := strings.LastIndexAny(input, " \t") + 1
+	word := input[start:]
+	fields := strings.Fields(input[:start])
+
+	var candidates []string
+	switch {
+	case len(fields) == 0 || fields[len(fields)-1] == ";":
+		candidates = tmuxCommands
+	case strings.HasPrefix(word, "{"):
+		candidates = commandPlaceholders
+	case fields[len(fields)-1] == "-t" || fields[len(fields)-1] == "-s":
+		candidates = commandTargets(*state)
+	default:
+		return
+	}
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return
+	case 1:
+		editPalette(state, []rune(input[:start]+matches[0]+" "))
+		return
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	editPalette(state, []rune(input[:start]+prefix))
+	p := &state.command
+	p.title, p.output, p.failed, p.scroll = "completions", matches, false, 0
+}
+
+// drawCommandPalette draws the : prompt above the status bar, with the
+// output of the last command (or the completions) in a scrollable box over
+// it.
+func drawCommandPalette(screen tcell.Screen, width, height int, state appState) {
+	bottom := height - 1
+	if width < 10 || bottom < 3 {
+		return
+	}
+	th := activeTheme(state)
+	boxStyle := th.overlayStyle()
+	p := state.command
+
+	rows := paletteRows(bottom, len(p.output))
+	y0 := maxInt(bottom-3-rows, 0)
+	drawBox(screen, th.borders, 0, y0, width, bottom, boxStyle)
+	for y := y0 + 1; y < bottom-1; y++ {
+		drawText(screen, 1, y, width-2, "", boxStyle)
+	}
+
+	title := "tmux"
+	if key := focusedKey(state); key != "" {
+		sess := state.sessions[key]
+		title = fmt.Sprintf("tmux on %s: %s", sess.socketPath, sess.name)
+		if sess.paneID != "" {
+			title += " (" + sess.paneID + ")"
+		}
+	}
+	if p.title != "" {
+		title += " | " + p.title
+	}
+	drawText(screen, 2, y0, width-4, " "+title+" ", th.overlayHeadStyle())
+
+	if rows > 0 {
+		scroll := clampInt(p.scroll, 0, maxInt(len(p.output)-rows, 0))
+		for i := 0; i < rows && scroll+i < len(p.output); i++ {
+			style := boxStyle
+			if p.failed && scroll+i == 0 {
+				style = th.severityStyle(boxStyle, "error")
+			}
+			drawText(screen, 1, y0+1+i, width-2, p.output[scroll+i], style)
+		}
+		if len(p.output) > rows {
+			more := fmt.Sprintf(" %d-%d/%d ", scroll+1, minInt(scroll+rows, len(p.output)), len(p.output))
+			drawText(screen, maxInt(width-2-textWidth(more), 1), bottom-1, textWidth(more), more, boxStyle)
+		}
+	}
+
+	input := ":" + string(p.input)
+	// Keep the end of a long line, where typing happens, in view.
+	for textWidth(input) > width-3 {
+		input = string([]rune(input)[1:])
+	}
+	drawText(screen, 1, bottom-2, width-2, input, boxStyle)
+	screen.SetContent(1+textWidth(input), bottom-2, ' ', nil, boxStyle.Reverse(true))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	for in, want := range map[string]string{
+		`list-windows -t {session}`:         `list-windows|-t|{session}`,
+		`  display -p  '#{pane_id} x' `:     `display|-p|#{pane_id} x`,
+		`rename-window "my \"win\"" ; last`: `rename-window|my "win"|;|last`,
+		`send-keys a\ b ''`:                 `send-keys|a b|`,
+	} {
+		args, err := splitCommandLine(in)
+		if err != nil || strings.Join(args, "|") != want {
+			t.Fatalf("splitCommandLine(%q) = %q, %v; want %q", in, args, err, want)
+		}
+	}
+	if _, err := splitCommandLine(`display "open`); err == nil {
+		t.Fatalf("unterminated quote accepted")
+	}
+}
+
+func typeKeys(keys *keyContext, text string) {
+	for _, r := range text {
+		dispatchKey(keys, tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+}
+
+func TestCommandPaletteRunsOnFocusedTarget(t *testing.T) {
+	state := appState{
+		sessions:  map[string]sessionView{"b": {key: "b", name: "beta", socketPath: "/tmp/b.sock", paneID: "%4"}},
+		focusName: "b",
+	}
+	cfg := config{}
+	var calls []string
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() { runTmuxOnSocketFn = origRun })
+	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
+		calls = append(calls, socket+"|"+strings.Join(args, "|"))
+		if args[0] == "bogus" {
+			return "", errors.New("unknown command: bogus")
+		}
+		return "0: beta\n1: logs", nil
+	}
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
+	press := func(key tcell.Key) { dispatchKey(&keys, tcell.NewEventKey(key, 0, tcell.ModNone)) }
+
+	typeKeys(&keys, ":")
+	if stateMode(state) != modeCommand {
+		t.Fatalf(": did not open the palette")
+	}
+	typeKeys(&keys, "list-windows -t {session} -F '#{window_index}: {pane} {socket}'x")
+	press(tcell.KeyBackspace2)
+	press(tcell.KeyEnter)
+	if want := "/tmp/b.sock|list-windows|-t|beta|-F|#{window_index}: %4 /tmp/b.sock"; len(calls) != 1 || calls[0] != want {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+	if got := strings.Join(state.command.output, "\n"); got != "0: beta\n1: logs" || len(state.command.input) != 0 {
+		t.Fatalf("output = %q, input = %q", got, string(state.command.input))
+	}
+
+	typeKeys(&keys, "bogus")
+	press(tcell.KeyEnter)
+	if !state.command.failed || state.command.output[0] != "error: unknown command: bogus" {
+		t.Fatalf("error output = %q", state.command.output)
+	}
+
+	screen := newTextScreen(t, 70, 12)
+	draw(screen, state, cfg)
+	var text strings.Builder
+	for y := 0; y < 12; y++ {
+		text.WriteString(readScreenRow(screen, y, 70) + "\n")
+	}
+	for _, want := range []string{"tmux on /tmp/b.sock: beta (%4) | bogus", "error: unknown command: bogus", " COMMAND ", ":"} {
+		if !strings.Contains(text.String(), want) {
+			t.Fatalf("palette missing %q:\n%s", want, text.String())
+		}
+	}
+
+	// History survives closing the palette; Down returns to the draft.
+	press(tcell.KeyEsc)
+	typeKeys(&keys, ":ls")
+	press(tcell.KeyUp)
+	press(tcell.KeyUp)
+	if got := string(state.command.input); !strings.HasPrefix(got, "list-windows") {
+		t.Fatalf("history after two Ups = %q", got)
+	}
+	press(tcell.KeyDown)
+	press(tcell.KeyDown)
+	if got := string(state.command.input); got != "ls" {
+		t.Fatalf("draft after browsing = %q", got)
+	}
+	press(tcell.KeyEsc)
+	if state.commandActive || stateMode(state) != modeNormal {
+		t.Fatalf("Esc did not close the palette")
+	}
+}
+
+func TestCommandPaletteCompletion(t *testing.T) {
+	state := appState{sessions: map[string]sessionView{
+		"a":  {key: "a", name: "alpha", socketPath: "/tmp/a.sock", paneID: "%1", windowIndex: 2},
+		"a2": {key: "a2", name: "alpine", socketPath: "/tmp/a.sock", paneID: "%5"},
+		"z":  {key: "z", name: "zeta", socketPath: "/tmp/z.sock", paneID: "%9"},
+	}, focusName: "a"}
+	openPalette(&state)
+	complete := func(input string) string {
+		t.Helper()
+		editPalette(&state, []rune(input))
+		completePalette(&state)
+		return string(state.command.input)
+	}
+
+	if got := complete("kill-w"); got != "kill-window " {
+		t.Fatalf("kill-w completed to %q", got)
+	}
+	if got := complete("new-w ; split-w"); got != "new-w ; split-window " {
+		t.Fatalf("command after ; completed to %q", got)
+	}
+	if got := complete("list-p"); got != "list-panes " {
+		t.Fatalf("list-p completed to %q", got)
+	}
+	if got := complete("select-window -t al"); got != "select-window -t alp" || strings.Join(state.command.output, " ") != "alpha alpha:2 alpine alpine:0" {
+		t.Fatalf("targets: input %q, listed %q", got, state.command.output)
+	}
+	if got := complete("kill-pane -t %"); got != "kill-pane -t %" || strings.Contains(strings.Join(state.command.output, " "), "%9") {
+		t.Fatalf("pane targets should stay on the focused socket: %q", state.command.output)
+	}
+	if got := complete("display -p {p"); got != "display -p {pane} " {
+		t.Fatalf("placeholder completed to %q", got)
+	}
+	if got := complete("display -p hello"); got != "display -p hello" {
+		t.Fatalf("plain argument changed to %q", got)
+	}
+}
+
+func TestCommandPaletteScrollStopsAtLastPage(t *testing.T) {
+	state := appState{sessions: map[string]sessionView{}}
+	openPalette(&state)
+	for i := 0; i < 30; i++ {
+		state.command.output = append(state.command.output, fmt.Sprintf("line %d", i))
+	}
+	screen := newTextScreen(t, 40, 20)
+	cfg := config{}
+	keys := keyContext{ctx: context.Background(), screen: screen, state: &state, cfg: &cfg}
+	press := func(key tcell.Key) { dispatchKey(&keys, tcell.NewEventKey(key, 0, tcell.ModNone)) }
+
+	// Six rows fit above the status bar, so the last page starts at 24.
+	for i := 0; i < 10; i++ {
+		press(tcell.KeyPgDn)
+	}
+	if state.command.scroll != 24 {
+		t.Fatalf("scroll = %d, want 24", state.command.scroll)
+	}
+	drawCommandPalette(screen, 40, 20, state)
+	if row := strings.TrimSpace(readScreenRow(screen, 16, 40)); !strings.Contains(row, "line 29") {
+		t.Fatalf("last output row = %q", row)
+	}
+
+	// Scrolling back moves the view at once instead of eating the overshoot.
+	press(tcell.KeyPgUp)
+	if state.command.scroll != 19 {
+		t.Fatalf("scroll after PageUp = %d, want 19", state.command.scroll)
+	}
+}
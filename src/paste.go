@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// collectPaste adds a key that arrived inside a bracketed paste to the
+// pasted text. tcell reports a paste as its start and end markers with the
+// text as key events in between.
+func collectPaste(state *appState, ev *tcell.EventKey) {
+	switch key := ev.Key(); {
+	case key == tcell.KeyRune:
+		state.pasteBuf = append(state.pasteBuf, ev.Rune())
+	case key == tcell.KeyEnter:
+		state.pasteBuf = append(state.pasteBuf, '\n')
+	case key >= tcell.KeyCtrlA && key <= tcell.KeyCtrlZ:
+		// Control characters other than Tab, Esc and Backspace come as
+		// Ctrl+letter keys; a line feed is Ctrl+J.
+		state.pasteBuf = append(state.pasteBuf, rune(key-tcell.KeyCtrlA+1))
+	case key > 0 && key < 0x20 || key == tcell.KeyDEL:
+		state.pasteBuf = append(state.pasteBuf, rune(key))
+	}
+}
+
+// handlePaste handles the start and end of a bracketed paste and reports
+// whether the screen needs redrawing. At the end the whole text is
+// delivered at once: to the focused pane in compose and send-key mode, to
+// every marked pane when composing to them, and to the line in the command
+// palette. Elsewhere it is dropped, so pasted text never runs as keys.
+func handlePaste(k *keyContext, ev *tcell.EventPaste) bool {
+	if ev.Start() {
+		k.state.pasting = true
+		k.state.pasteBuf = nil
+		return false
+	}
+	text := string(k.state.pasteBuf)
+	k.state.pasting = false
+	k.state.pasteBuf = nil
+	if text == "" {
+		return false
+	}
+	switch stateMode(*k.state) {
+	case modeCompose:
+		if !k.state.composeMarked {
+			k.fail(pasteToFocused(k.ctx, k.state, *k.cfg, text))
+			break
+		}
+		for _, err := range eachMarkedPane(k.ctx, k.state, *k.cfg, func(sess sessionView, paneID string) error {
+			return pasteToPane(k.ctx, *k.cfg, sess.socketPath, paneID, text)
+		}) {
+			k.fail(err)
+		}
+	case modeSendKey:
+		k.fail(pasteToFocused(k.ctx, k.state, *k.cfg, text))
+		k.state.sendKeyActive = false
+	case modeCommand:
+		line := strings.Join(strings.Fields(strings.ReplaceAll(text, "\n", " ")), " ")
+		editPalette(k.state, append(k.state.command.input, []rune(line)...))
+	default:
+		showToast(k.state, "warn", "paste ignored: press i to compose into the focused pane")
+	}
+	return true
+}
+
+func pasteToFocused(ctx context.Context, state *appState, cfg config, text string) error {
+	key := focusedKey(*state)
+	if key == "" {
+		return errors.New("no tmux sessions")
+	}
+	sess := state.sessions[key]
+	paneID := sess.paneID
+	if paneID == "" {
+		var err error
+		if paneID, err = activePaneID(ctx, cfg, sess.socketPath, sess.name); err != nil {
+			return err
+		}
+	}
+	return pasteToPane(ctx, cfg, sess.socketPath, paneID, text)
+}
+
+// pasteToPane loads text into a tmux buffer and pastes it into paneID with
+// paste-buffer -p, so an application that turned on bracketed paste gets
+// it as one paste. The text goes through a temporary file because tmux
+// commands are limited in length; the buffer is deleted once pasted.
+func pasteToPane(ctx context.Context, cfg config, socketPath, paneID, text string) error {
+	f, err := os.CreateTemp("", "tmux-visualiser-paste-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// One buffer per pane, so pastes to several panes on a socket at once
+	// do not take each other's text.
+	buffer := "tmux-visualiser-paste-" + strings.TrimPrefix(paneID, "%")
+	_, err = runTmuxOnSocketFn(ctx, cfg, socketPath, "load-buffer", "-b", buffer, f.Name(), ";", "paste-buffer", "-p", "-d", "-b", buffer, "-t", paneID)
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pasteInto feeds text to state as tcell reports a bracketed paste: start
+// marker, one key event per character, end marker.
+func pasteInto(keys *keyContext, text string) bool {
+	handlePaste(keys, tcell.NewEventPaste(true))
+	for _, r := range text {
+		switch r {
+		case '\r':
+			collectPaste(keys.state, tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+		default:
+			// As tcell's input parser does: a line feed becomes Ctrl+J.
+			collectPaste(keys.state, tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+		}
+	}
+	return handlePaste(keys, tcell.NewEventPaste(false))
+}
+
+func TestPasteDeliversOneBufferPerPane(t *testing.T) {
+	a := sessionView{key: "a", name: "alpha", socketPath: "/tmp/a.sock", paneID: "%1"}
+	b := sessionView{key: "b", name: "beta", socketPath: "/tmp/a.sock", paneID: "%2"}
+	state := appState{sessions: map[string]sessionView{"a": a, "b": b}, focusName: "a"}
+	cfg := config{}
+
+	var mu sync.Mutex
+	var calls []string
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() { runTmuxOnSocketFn = origRun })
+	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// The temporary file only lives for the call, so read it here.
+		data, err := os.ReadFile(args[3])
+		if err != nil {
+			t.Errorf("paste file: %v", err)
+		}
+		args[3] = "FILE"
+		calls = append(calls, socket+"|"+strings.Join(args, " ")+"|"+string(data))
+		return "", nil
+	}
+	keys := keyContext{ctx: context.Background(), state: &state, cfg: &cfg}
+
+	if !pasteInto(&keys, "ls") || len(calls) != 0 || len(state.toasts) != 1 || !strings.Contains(state.toasts[0].text, "paste ignored") {
+		t.Fatalf("paste in normal mode: calls %q, toasts %+v", calls, state.toasts)
+	}
+	if state.zoomed || keys.quit {
+		t.Fatalf("pasted text ran as keys")
+	}
+
+	startCompose(&state)
+	pasteInto(&keys, "echo one\r\techo two\n")
+	want := "/tmp/a.sock|load-buffer -b tmux-visualiser-paste-1 FILE ; paste-buffer -p -d -b tmux-visualiser-paste-1 -t %1|echo one\n\techo two\n"
+	if len(calls) != 1 || calls[0] != want {
+		t.Fatalf("calls = %q\nwant %q", calls, want)
+	}
+
+	calls = nil
+	state.marked = map[string]bool{"a": true, "b": true}
+	if err := startComposeMarked(&state); err != nil {
+		t.Fatal(err)
+	}
+	pasteInto(&keys, "yes")
+	sort.Strings(calls)
+	if len(calls) != 2 || !strings.Contains(calls[0], "-b tmux-visualiser-paste-1 -t %1|yes") || !strings.Contains(calls[1], "-b tmux-visualiser-paste-2 -t %2|yes") {
+		t.Fatalf("marked paste calls = %q", calls)
+	}
+
+	calls = nil
+	closePalette(&state)
+	state.composeActive = false
+	openPalette(&state)
+	typeKeys(&keys, "display ")
+	pasteInto(&keys, "-p\n  hi ")
+	if got := string(state.command.input); got != "display -p hi" || len(calls) != 0 {
+		t.Fatalf("palette input after paste = %q, calls %q", got, calls)
+	}
+}
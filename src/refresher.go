@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// refresher runs refreshes on its own goroutine and publishes each result as
+// an immutable snapshot, so the event loop never waits on tmux. Requests made
+// while a refresh is running are coalesced into one follow-up refresh; a
+// request that changes the config or asks for a full refresh cancels the
+// running one instead.
+type refresher struct {
+	sources   refreshSources
+	snapshots chan snapshot
+	wakeup    chan struct{}
+
+	mu      sync.Mutex
+	cfg     config
+	focus   string
+	restart bool
+}
+
+func newRefresher(cfg config, sources refreshSources) *refresher {
+	return &refresher{
+		sources:   sources,
+		snapshots: make(chan snapshot, 1),
+		wakeup:    make(chan struct{}, 1),
+		cfg:       cfg,
+	}
+}
+
+// request asks for a refresh with cfg. With full set, every pane is made
+// due and a refresh already in flight is abandoned.
+func (r *refresher) request(cfg config, full bool) {
+	r.mu.Lock()
+	if cfg.lines != r.cfg.lines || cfg.allPanes != r.cfg.allPanes {
+		full = true
+	}
+	r.cfg = cfg
+	if full {
+		r.restart = true
+	}
+	r.mu.Unlock()
+	if full {
+		r.sources.schedule.wake()
+	}
+	select {
+	case r.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// setFocus tells the refresher which entry the UI has focused.
+func (r *refresher) setFocus(key string) {
+	r.mu.Lock()
+	changed := r.focus != key
+	r.focus = key
+	r.mu.Unlock()
+	if changed {
+		r.sources.schedule.focus(key)
+	}
+}
+
+func (r *refresher) current() (config, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg, r.focus
+}
+
+func (r *refresher) takeRestart() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	restart := r.restart
+	r.restart = false
+	return restart
+}
+
+func (r *refresher) run(ctx context.Context) {
+	cfg, _ := r.current()
+	tick := tickInterval(cfg, r.sources.schedule)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	prev := map[string]sessionView{}
+	var cancel context.CancelFunc
+	type result struct {
+		snap      snapshot
+		cancelled bool
+	}
+	done := make(chan result, 1)
+	pending := true
+	running := false
+
+	start := func() {
+		cfg, focus := r.current()
+		if next := tickInterval(cfg, r.sources.schedule); next != tick {
+			tick = next
+			ticker.Reset(tick)
+		}
+		var refreshCtx context.Context
+		refreshCtx, cancel = context.WithCancel(ctx)
+		running = true
+		pending = false
+		r.takeRestart()
+		go func(ctx context.Context, prev map[string]sessionView) {
+			snap := collectSnapshot(ctx, cfg, r.sources, prev, focus)
+			done <- result{snap: snap, cancelled: ctx.Err() != nil}
+		}(refreshCtx, prev)
+	}
+
+	for {
+		if pending && !running {
+			start()
+		}
+		select {
+		case <-ctx.Done():
+			if cancel != nil {
+				cancel()
+			}
+			return
+		case <-ticker.C:
+			pending = true
+		case <-r.wakeup:
+			pending = true
+			if running && r.takeRestart() {
+				cancel()
+			}
+		case res := <-done:
+			running = false
+			cancel()
+			if res.cancelled {
+				// The replacement refresh is already pending.
+				continue
+			}
+			prev = res.snap.sessions
+			r.publish(res.snap)
+		}
+	}
+}
+
+// publish replaces any snapshot the UI has not picked up yet.
+func (r *refresher) publish(snap snapshot) {
+	select {
+	case <-r.snapshots:
+	default:
+	}
+	r.snapshots <- snap
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefresherCancelsInFlightRefreshOnConfigChange(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	var calls atomic.Int32
+	blocked := make(chan struct{})
+	cancelled := make(chan struct{})
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(ctx context.Context, _ config, _ string, args ...string) (string, error) {
+		if args[0] == "list-panes" && calls.Add(1) == 1 {
+			close(blocked)
+			<-ctx.Done()
+			close(cancelled)
+			return "", ctx.Err()
+		}
+		if args[0] == "list-panes" {
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
+		}
+		return fakeTmuxChain(args, func(paneID string) *fakeTmuxPane {
+			return &fakeTmuxPane{screen: []string{"content of " + paneID}}
+		})
+	}
+
+	cfg := config{lines: 50, maxWorkers: 1, interval: time.Hour, explicitSockets: []string{"/tmp/slow.sock"}}
+	health := newHealthTracker()
+	refresher := newRefresher(cfg, refreshSources{schedule: newRefreshScheduler(), health: health})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go refresher.run(ctx)
+
+	select {
+	case <-blocked:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("first refresh never started")
+	}
+	cfg.lines = 100
+	refresher.request(cfg, false)
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("in-flight refresh was not cancelled")
+	}
+	select {
+	case snap := <-refresher.snapshots:
+		if snap.err != "" || len(snap.sessions) != 1 {
+			t.Fatalf("snapshot = %+v", snap)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no snapshot after restart")
+	}
+	if unhealthy := health.unhealthy(); unhealthy != 0 {
+		t.Fatalf("cancelled refresh counted as socket failure")
+	}
+}
+
+func TestApplySnapshotKeepsUIState(t *testing.T) {
+	state := appState{
+		scroll:    map[string]int{"a": 4, "gone": 2},
+		follow:    map[string]bool{"a": false},
+		marked:    map[string]bool{"b": true, "gone": true},
+		focusName: "b",
+	}
+	applySnapshot(&state, snapshot{
+		sessions: map[string]sessionView{
+			"a": {key: "a", name: "a"},
+			"b": {key: "b", name: "b"},
+		},
+		socketCount: 1,
+		refreshedAt: time.Now(),
+	})
+	if state.scroll["a"] != 4 || state.follow["a"] || !state.follow["b"] {
+		t.Fatalf("scroll/follow = %v / %v", state.scroll, state.follow)
+	}
+	if _, ok := state.scroll["gone"]; ok {
+		t.Fatalf("scroll kept for vanished entry")
+	}
+	if !state.marked["b"] || len(state.marked) != 1 {
+		t.Fatalf("marks = %v, want only the surviving pane", state.marked)
+	}
+	if state.focusName != "b" || state.focusIndex != 1 {
+		t.Fatalf("focus = %q/%d", state.focusName, state.focusIndex)
+	}
+}
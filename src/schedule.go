@@ -0,0 +1,191 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// refreshScheduler gives every pane its own poll interval. The focused pane
+// is polled at cfg.minInterval; other panes start at cfg.interval, speed up
+// while their content keeps changing and back off towards cfg.maxInterval
+// while they stay idle. A socket is only queried when one of its panes is
+// due, or at least every cfg.interval so new sessions still show up.
+type refreshScheduler struct {
+	mu      sync.Mutex
+	panes   map[string]paneSchedule
+	sockets map[string]time.Time
+}
+
+type paneSchedule struct {
+	socket   string
+	interval time.Duration
+	due      time.Time
+}
+
+func newRefreshScheduler() *refreshScheduler {
+	return &refreshScheduler{
+		panes:   map[string]paneSchedule{},
+		sockets: map[string]time.Time{},
+	}
+}
+
+// socketDue reports whether the socket should be queried at now.
+func (s *refreshScheduler) socketDue(target socketTarget, now time.Time, cfg config) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.sockets[target.key]
+	if !ok || now.Sub(last) >= cfg.interval {
+		return true
+	}
+	for _, pane := range s.panes {
+		if pane.socket == target.key && !now.Before(pane.due) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *refreshScheduler) markSocket(target socketTarget, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sockets[target.key] = now
+}
+
+// paneDue reports whether the pane behind key should be captured at now.
+// Unknown panes are always due.
+func (s *refreshScheduler) paneDue(key string, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pane, ok := s.panes[key]
+	return !ok || !now.Before(pane.due)
+}
+
+// observe records the outcome of polling a pane and schedules its next poll.
+func (s *refreshScheduler) observe(key string, target socketTarget, focused, changed bool, now time.Time, cfg config) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pane, ok := s.panes[key]
+	switch {
+	case !ok:
+		pane.interval = cfg.interval
+	case changed:
+		pane.interval /= 2
+	default:
+		pane.interval *= 2
+	}
+	pane.interval = clampDuration(pane.interval, cfg.minInterval, cfg.maxInterval)
+	if focused {
+		pane.interval = cfg.minInterval
+	}
+	pane.socket = target.key
+	pane.due = now.Add(pane.interval)
+	s.panes[key] = pane
+}
+
+// focus pulls a newly focused pane forward so it is polled on the next tick.
+func (s *refreshScheduler) focus(key string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pane, ok := s.panes[key]; ok {
+		pane.due = time.Time{}
+		s.panes[key] = pane
+	}
+}
+
+// wake makes every socket and pane due, for explicit refreshes.
+func (s *refreshScheduler) wake() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, pane := range s.panes {
+		pane.due = time.Time{}
+		s.panes[key] = pane
+	}
+	for key := range s.sockets {
+		delete(s.sockets, key)
+	}
+}
+
+// prune forgets panes and sockets that are no longer shown.
+func (s *refreshScheduler) prune(keep map[string]sessionView) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sockets := make(map[string]struct{}, len(keep))
+	for key := range s.panes {
+		if _, ok := keep[key]; !ok {
+			delete(s.panes, key)
+		}
+	}
+	for _, view := range keep {
+		sockets[socketKey(view.socketPath)] = struct{}{}
+	}
+	for key := range s.sockets {
+		if _, ok := sockets[key]; !ok {
+			delete(s.sockets, key)
+		}
+	}
+}
+
+// interval returns the current poll interval of a pane, or 0 if unknown.
+func (s *refreshScheduler) interval(key string) time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.panes[key].interval
+}
+
+// rate returns the expected number of pane polls per second.
+func (s *refreshScheduler) rate() float64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0.0
+	for _, pane := range s.panes {
+		if pane.interval > 0 {
+			total += float64(time.Second) / float64(pane.interval)
+		}
+	}
+	return total
+}
+
+// tickInterval is how often the event loop asks the scheduler for due work.
+func tickInterval(cfg config, schedule *refreshScheduler) time.Duration {
+	if schedule == nil || cfg.minInterval <= 0 || cfg.minInterval > cfg.interval {
+		return cfg.interval
+	}
+	return cfg.minInterval
+}
+
+func clampDuration(d, lo, hi time.Duration) time.Duration {
+	if hi > 0 && d > hi {
+		d = hi
+	}
+	if d < lo {
+		d = lo
+	}
+	return d
+}
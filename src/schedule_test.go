@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefreshSchedulerBacksOffIdlePanes(t *testing.T) {
+	cfg := config{interval: time.Second, minInterval: 250 * time.Millisecond, maxInterval: 4 * time.Second}
+	target := makeSocketTarget("/tmp/a.sock")
+	schedule := newRefreshScheduler()
+	now := time.Unix(1000, 0)
+
+	schedule.observe("idle", target, false, true, now, cfg)
+	if got := schedule.interval("idle"); got != time.Second {
+		t.Fatalf("first interval = %s", got)
+	}
+	for i := 0; i < 5; i++ {
+		schedule.observe("idle", target, false, false, now, cfg)
+	}
+	if got := schedule.interval("idle"); got != cfg.maxInterval {
+		t.Fatalf("idle interval = %s, want %s", got, cfg.maxInterval)
+	}
+	for i := 0; i < 5; i++ {
+		schedule.observe("idle", target, false, true, now, cfg)
+	}
+	if got := schedule.interval("idle"); got != cfg.minInterval {
+		t.Fatalf("busy interval = %s, want %s", got, cfg.minInterval)
+	}
+
+	schedule.observe("focused", target, true, false, now, cfg)
+	if got := schedule.interval("focused"); got != cfg.minInterval {
+		t.Fatalf("focused interval = %s", got)
+	}
+	if schedule.paneDue("focused", now.Add(100*time.Millisecond)) {
+		t.Fatalf("pane due before its interval elapsed")
+	}
+	if !schedule.paneDue("focused", now.Add(cfg.minInterval)) {
+		t.Fatalf("pane not due after its interval elapsed")
+	}
+
+	schedule.observe("idle", target, false, false, now, cfg)
+	schedule.focus("idle")
+	if !schedule.paneDue("idle", now) {
+		t.Fatalf("newly focused pane should be due immediately")
+	}
+}
+
+func TestUpdateStateSkipsSocketsWithoutDuePanes(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	calls := 0
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, _ string, args ...string) (string, error) {
+		calls++
+		switch args[0] {
+		case "list-panes":
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
+		case "display-message":
+			return fakeTmuxChain(args, func(paneID string) *fakeTmuxPane {
+				return &fakeTmuxPane{screen: []string{"content of " + paneID}}
+			})
+		}
+		return "", nil
+	}
+
+	state := appState{
+		sessions: map[string]sessionView{},
+		scroll:   map[string]int{},
+		follow:   map[string]bool{},
+		schedule: newRefreshScheduler(),
+	}
+	cfg := config{
+		lines:           50,
+		maxWorkers:      1,
+		interval:        time.Hour,
+		minInterval:     time.Hour,
+		maxInterval:     time.Hour,
+		explicitSockets: []string{"/tmp/sched.sock"},
+	}
+	key := sessionQualifiedKey("/tmp/sched.sock", "alpha")
+
+	updateState(context.Background(), &state, cfg)
+	if calls != 2 {
+		t.Fatalf("first refresh calls = %d", calls)
+	}
+	updateState(context.Background(), &state, cfg)
+	if calls != 2 {
+		t.Fatalf("socket queried before any pane was due: %d calls", calls)
+	}
+	if got := strings.Join(state.sessions[key].lines, "\n"); got != "content of %1" {
+		t.Fatalf("carried lines = %q", got)
+	}
+
+	state.schedule.wake()
+	updateState(context.Background(), &state, cfg)
+	if calls != 3 {
+		t.Fatalf("woken refresh calls = %d, want discovery only", calls)
+	}
+}
+
+// withWindowActivity sets the window activity that tmux reports next to the
+// pane activity in a formatPaneRow row.
+func withWindowActivity(row string, at int64) string {
+	values := strings.Split(row, "\t")
+	for i, field := range paneFields {
+		if field.format == paneActivityFormat {
+			values[i] += strconv.FormatInt(at, 10)
+		}
+	}
+	return strings.Join(values, "\t")
+}
+
+func TestUpdateStateUsesPaneActivityForSiblingPanes(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	socketPath := "/tmp/siblings.sock"
+	busy := paneInfo{sessionName: "alpha", paneID: "%1", windowActive: true, paneActive: true, height: 2, historyLimit: 2000}
+	idle := paneInfo{sessionName: "alpha", paneID: "%2", windowActive: true, height: 2, historyLimit: 2000}
+	var windowActivity int64
+	captured := map[string]int{}
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, _ string, args ...string) (string, error) {
+		if args[0] == "list-panes" {
+			return paneListOutput(
+				withWindowActivity(formatPaneRow(busy), windowActivity),
+				withWindowActivity(formatPaneRow(idle), windowActivity),
+			), nil
+		}
+		for i, arg := range args {
+			if arg == "capture-pane" {
+				captured[chainFlag(args[i:], "-t")]++
+			}
+		}
+		return fakeTmuxChain(args, func(paneID string) *fakeTmuxPane {
+			return &fakeTmuxPane{screen: []string{"content of " + paneID, ""}}
+		})
+	}
+
+	state := appState{
+		sessions: map[string]sessionView{},
+		scroll:   map[string]int{},
+		follow:   map[string]bool{},
+		schedule: newRefreshScheduler(),
+	}
+	cfg := config{
+		lines:           50,
+		maxWorkers:      1,
+		allPanes:        true,
+		interval:        time.Hour,
+		minInterval:     time.Hour,
+		maxInterval:     time.Hour,
+		explicitSockets: []string{socketPath},
+	}
+	updateState(context.Background(), &state, cfg)
+	capturedAt := state.sessions[paneQualifiedKey(socketPath, "alpha", "%2")].capturedAt.Unix()
+
+	// The busy pane prints, which also bumps the shared window activity;
+	// its idle sibling keeps its old pane activity and is not recaptured.
+	for k := range captured {
+		delete(captured, k)
+	}
+	busy.activity = capturedAt
+	idle.activity = capturedAt - 1
+	windowActivity = capturedAt
+	state.schedule.wake()
+	updateState(context.Background(), &state, cfg)
+	if captured["%1"] == 0 || captured["%2"] != 0 {
+		t.Fatalf("captures = %v, want only the busy pane", captured)
+	}
+
+	// Without per-pane activity both panes follow the window.
+	for k := range captured {
+		delete(captured, k)
+	}
+	busy.activity, idle.activity = 0, 0
+	windowActivity = time.Now().Unix() + 1
+	state.schedule.wake()
+	updateState(context.Background(), &state, cfg)
+	if captured["%1"] == 0 || captured["%2"] == 0 {
+		t.Fatalf("captures = %v, want both panes from window activity", captured)
+	}
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -140,14 +143,14 @@ func TestListSessionsQualifiedKeyCollision(t *testing.T) {
 		runTmuxOnSocketFn = origRun
 	})
 	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
-		if len(args) < 1 || args[0] != "list-sessions" {
+		if len(args) < 1 || args[0] != "list-panes" {
 			return "", errors.New("unexpected command")
 		}
 		if socket == "" {
-			return "alpha\nbeta", nil
+			return paneListOutput(paneListRow("alpha", "%1", true), paneListRow("beta", "%2", true)), nil
 		}
 		if socket == socketA {
-			return "alpha", nil
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
 		}
 		return "", errors.New("unknown socket")
 	}
@@ -189,11 +192,11 @@ func TestListSessionsReturnsPartialResultsWithFatalErrors(t *testing.T) {
 		runTmuxOnSocketFn = origRun
 	})
 	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
-		if len(args) < 1 || args[0] != "list-sessions" {
+		if len(args) < 1 || args[0] != "list-panes" {
 			return "", errors.New("unexpected command")
 		}
 		if socket == "" {
-			return "alpha", nil
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
 		}
 		if socket == badSocket {
 			return "", errors.New("permission denied")
@@ -236,11 +239,11 @@ func TestListSessionsReturnsPartialResultsWithTmuxPermissionError(t *testing.T)
 		runTmuxOnSocketFn = origRun
 	})
 	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
-		if len(args) < 1 || args[0] != "list-sessions" {
+		if len(args) < 1 || args[0] != "list-panes" {
 			return "", errors.New("unexpected command")
 		}
 		if socket == "" {
-			return "alpha", nil
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
 		}
 		if socket == badSocket {
 			return "", errors.New("error connecting to /tmp/private.sock (Permission denied)")
@@ -283,8 +286,8 @@ func TestListSessionsIncludesSocketGlobDiscoveryError(t *testing.T) {
 		runTmuxOnSocketFn = origRun
 	})
 	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
-		if socket == "" && len(args) > 0 && args[0] == "list-sessions" {
-			return "alpha", nil
+		if socket == "" && len(args) > 0 && args[0] == "list-panes" {
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
 		}
 		return "", errors.New("unexpected command")
 	}
@@ -322,17 +325,13 @@ func TestUpdateStateKeepsPartialSessionsOnSocketError(t *testing.T) {
 	})
 	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
 		switch args[0] {
-		case "list-sessions":
+		case "list-panes":
 			if socket == "" {
-				return "alpha", nil
+				return paneListOutput(paneListRow("alpha", "%1", true)), nil
 			}
 			if socket == badSocket {
 				return "", errors.New("permission denied")
 			}
-		case "list-panes":
-			if socket == "" {
-				return "1 %1", nil
-			}
 		case "capture-pane":
 			if socket == "" {
 				return "line1\n", nil
@@ -559,9 +558,10 @@ func TestSocketUsedForListPaneCapture(t *testing.T) {
 	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
 		calls = append(calls, socket+"|"+strings.Join(args, " "))
 		switch args[0] {
-		case "list-sessions":
-			return "alpha", nil
 		case "list-panes":
+			if args[1] == "-a" {
+				return paneListOutput(paneListRow("alpha", "%2", false), paneListRow("alpha", "%1", true)), nil
+			}
 			return "0 %2\n1 %1", nil
 		case "capture-pane":
 			return "line1\nline2\n", nil
@@ -580,6 +580,9 @@ func TestSocketUsedForListPaneCapture(t *testing.T) {
 	if len(refs) != 1 || refs[0].key != sessionQualifiedKey(socketPath, "alpha") {
 		t.Fatalf("refs = %#v", refs)
 	}
+	if refs[0].paneID != "%1" {
+		t.Fatalf("active pane = %q", refs[0].paneID)
+	}
 
 	paneID, err := activePaneID(ctx, cfg, socketPath, "alpha")
 	if err != nil {
@@ -635,14 +638,14 @@ func TestListSessionsFallsBackToCurrentTMUXSocket(t *testing.T) {
 		runTmuxOnSocketFn = origRun
 	})
 	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
-		if len(args) < 1 || args[0] != "list-sessions" {
+		if len(args) < 1 || args[0] != "list-panes" {
 			return "", errors.New("unexpected command")
 		}
 		if socket == "" {
 			return "", errors.New("no server running on /tmp/tmux-1000/default")
 		}
 		if socket == "/tmp/lisa-b.sock" {
-			return "alpha", nil
+			return paneListOutput(paneListRow("alpha", "%1", true)), nil
 		}
 		return "", errors.New("unknown socket")
 	}
@@ -726,17 +729,12 @@ func TestListSessionsOnSocketAllPanes(t *testing.T) {
 			return "", errors.New("unexpected socket")
 		}
 		switch args[0] {
-		case "list-sessions":
-			return "alpha\nbeta", nil
 		case "list-panes":
-			switch args[2] {
-			case "alpha":
-				return "%1\n%3", nil
-			case "beta":
-				return "%7", nil
-			default:
-				return "", errors.New("unexpected session")
-			}
+			return paneListOutput(
+				paneListRow("alpha", "%1", true),
+				paneListRow("alpha", "%3", false),
+				paneListRow("beta", "%7", true),
+			), nil
 		default:
 			return "", errors.New("unexpected command")
 		}
@@ -771,3 +769,302 @@ func TestListSessionsOnSocketAllPanes(t *testing.T) {
 		t.Fatalf("unexpected pane ids: %#v", panes)
 	}
 }
+
+func paneListRow(session, paneID string, active bool) string {
+	return formatPaneRow(paneInfo{
+		sessionName:  session,
+		paneID:       paneID,
+		windowActive: true,
+		paneActive:   active,
+		height:       24,
+		historyLimit: 2000,
+	})
+}
+
+// formatPaneRow renders info the way tmux prints paneListFormat().
+func formatPaneRow(info paneInfo) string {
+	flag := func(on bool) string {
+		if on {
+			return "1"
+		}
+		return "0"
+	}
+	// Zero activity stands for a tmux without pane_activity.
+	activity := ""
+	if info.activity != 0 {
+		activity = strconv.FormatInt(info.activity, 10)
+	}
+	return strings.Join([]string{
+		info.paneID,
+		strconv.Itoa(info.windowIndex),
+		flag(info.windowActive),
+		flag(info.paneActive),
+		strconv.Itoa(info.cursor.x),
+		strconv.Itoa(info.cursor.y),
+		flag(info.cursor.visible),
+		strconv.Itoa(info.height),
+		strconv.Itoa(info.historySize),
+		strconv.Itoa(info.historyLimit),
+		activity + ",",
+		strconv.Itoa(info.width),
+		flag(info.alternate),
+		flag(info.mouse.on) + flag(info.mouse.motion) + "0" + flag(info.mouse.sgr),
+		info.windowLayout,
+		strconv.Itoa(info.paneIndex),
+		info.windowName,
+		info.sessionName,
+	}, "\t")
+}
+
+func paneListOutput(rows ...string) string {
+	return strings.Join(rows, "\n")
+}
+
+func TestParsePaneLineKeepsSeparatorInSessionName(t *testing.T) {
+	want := paneInfo{
+		sessionName:  "odd\tname",
+		paneID:       "%4",
+		windowIndex:  2,
+		windowActive: true,
+		paneActive:   true,
+		cursor:       paneCursor{x: 3, y: 5, visible: true},
+		height:       40,
+		windowLayout: "b25d,80x40,0,0,4",
+		paneIndex:    1,
+		windowName:   "editor",
+		historySize:  120,
+		historyLimit: 2000,
+		activity:     1700000000,
+	}
+	info, ok := parsePaneLine(formatPaneRow(want))
+	if !ok {
+		t.Fatalf("parsePaneLine rejected row")
+	}
+	want.cursor.valid = true
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("info = %#v", info)
+	}
+	if _, ok := parsePaneLine("%1\tbroken"); ok {
+		t.Fatalf("short row accepted")
+	}
+}
+
+func TestRefreshSpawnsOneDiscoveryAndOneCapturePerSocket(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	socketA := "/tmp/batch-a.sock"
+	socketB := "/tmp/batch-b.sock"
+	var mu sync.Mutex
+	calls := map[string]int{}
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, socket string, args ...string) (string, error) {
+		mu.Lock()
+		calls[socket]++
+		mu.Unlock()
+		switch args[0] {
+		case "list-panes":
+			rows := make([]string, 0, 20)
+			for i := 0; i < 20; i++ {
+				rows = append(rows, paneListRow("s"+strconv.Itoa(i%4), "%"+strconv.Itoa(i), i%5 == 0))
+			}
+			return paneListOutput(rows...), nil
+		case "display-message":
+			return fakeTmuxChain(args, func(paneID string) *fakeTmuxPane {
+				return &fakeTmuxPane{screen: []string{"content of " + paneID, ""}}
+			})
+		}
+		return "", errors.New("unexpected command")
+	}
+
+	state := appState{sessions: map[string]sessionView{}, scroll: map[string]int{}, follow: map[string]bool{}}
+	cfg := config{
+		lines:           50,
+		maxWorkers:      4,
+		allPanes:        true,
+		explicitSockets: []string{socketA, socketB},
+	}
+	updateState(context.Background(), &state, cfg)
+
+	if state.lastErr != "" {
+		t.Fatalf("lastErr = %q", state.lastErr)
+	}
+	if len(state.sessions) != 40 {
+		t.Fatalf("sessions len = %d", len(state.sessions))
+	}
+	if calls[socketA] != 2 || calls[socketB] != 2 {
+		t.Fatalf("process count per socket = %v", calls)
+	}
+	sess := state.sessions[paneQualifiedKey(socketB, "s3", "%7")]
+	if !reflect.DeepEqual(sess.lines, []string{"content of %7"}) {
+		t.Fatalf("lines = %q", sess.lines)
+	}
+}
+
+func TestCapturePanesFallsBackToSingleCapturesWhenChainFails(t *testing.T) {
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, _ string, args ...string) (string, error) {
+		switch args[0] {
+		case "display-message":
+			return "", errors.New("can't find pane: %2")
+		case "capture-pane":
+			if args[2] == "%2" {
+				return "", errors.New("can't find pane: %2")
+			}
+			return "only " + args[2], nil
+		}
+		return "", errors.New("unexpected command")
+	}
+
+	plans := []capturePlan{{paneID: "%1", history: 10, full: true}, {paneID: "%2", history: 10, full: true}}
+	results := capturePanes(context.Background(), config{lines: 10}, "/tmp/a.sock", plans)
+	if !reflect.DeepEqual(results["%1"].history, []string{"only %1"}) || results["%1"].err != nil {
+		t.Fatalf("%%1 = %#v", results["%1"])
+	}
+	if results["%1"].historySize != -1 {
+		t.Fatalf("fallback capture must force a full capture next time")
+	}
+	if results["%2"].err == nil {
+		t.Fatalf("expected error for vanished pane")
+	}
+}
+
+type fakeTmuxPane struct {
+	history []string
+	screen  []string
+}
+
+// fakeTmuxChain answers a chained capture the way tmux would for the panes
+// returned by lookup, including its clamping of -S/-E to the history.
+func fakeTmuxChain(args []string, lookup func(string) *fakeTmuxPane) (string, error) {
+	out := make([]string, 0)
+	cmd := make([]string, 0)
+	run := func() error {
+		if len(cmd) == 0 {
+			return nil
+		}
+		target := chainFlag(cmd, "-t")
+		pane := lookup(target)
+		switch cmd[0] {
+		case "display-message":
+			historySize := 0
+			if pane != nil {
+				historySize = len(pane.history)
+			}
+			out = append(out, strings.ReplaceAll(cmd[len(cmd)-1], "#{history_size}", strconv.Itoa(historySize)))
+		case "capture-pane":
+			if pane == nil {
+				return errors.New("can't find pane: " + target)
+			}
+			all := append(append([]string(nil), pane.history...), pane.screen...)
+			base := len(pane.history)
+			clampRow := func(v string, fallback int) int {
+				row := fallback
+				if v != "" && v != "-" {
+					row = base + atoiDefault(v, 0)
+				}
+				return min(max(row, 0), len(all)-1)
+			}
+			start := clampRow(chainFlag(cmd, "-S"), 0)
+			end := clampRow(chainFlag(cmd, "-E"), len(all)-1)
+			if start <= end {
+				out = append(out, all[start:end+1]...)
+			}
+		}
+		cmd = cmd[:0]
+		return nil
+	}
+	for _, arg := range args {
+		if arg == ";" {
+			if err := run(); err != nil {
+				return "", err
+			}
+			continue
+		}
+		cmd = append(cmd, arg)
+	}
+	if err := run(); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n"), nil
+}
+
+func chainFlag(cmd []string, name string) string {
+	for i := 0; i < len(cmd)-1; i++ {
+		if cmd[i] == name {
+			return cmd[i+1]
+		}
+	}
+	return ""
+}
+
+func TestUpdateStateCapturesIncrementally(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	socketPath := "/tmp/incremental.sock"
+	pane := &fakeTmuxPane{screen: []string{"$ build", "step", "", ""}}
+	for i := 0; i < 100; i++ {
+		pane.history = append(pane.history, "old "+strconv.Itoa(i))
+	}
+	info := paneInfo{sessionName: "alpha", paneID: "%1", windowActive: true, paneActive: true, height: 4, historyLimit: 2000}
+
+	calls := make([]string, 0)
+	origRun := runTmuxOnSocketFn
+	t.Cleanup(func() {
+		runTmuxOnSocketFn = origRun
+	})
+	runTmuxOnSocketFn = func(_ context.Context, _ config, _ string, args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		if args[0] == "list-panes" {
+			info.historySize = len(pane.history)
+			return formatPaneRow(info), nil
+		}
+		return fakeTmuxChain(args, func(string) *fakeTmuxPane { return pane })
+	}
+
+	state := appState{sessions: map[string]sessionView{}, scroll: map[string]int{}, follow: map[string]bool{}}
+	cfg := config{lines: 50, maxWorkers: 1, explicitSockets: []string{socketPath}}
+	key := sessionQualifiedKey(socketPath, "alpha")
+	wantLines := func() []string {
+		history := pane.history[len(pane.history)-50:]
+		return append(append([]string(nil), history...), pane.screen[:2]...)
+	}
+
+	updateState(context.Background(), &state, cfg)
+	if !reflect.DeepEqual(state.sessions[key].lines, wantLines()) {
+		t.Fatalf("full capture lines = %q", state.sessions[key].lines)
+	}
+	if !strings.Contains(calls[1], "-S -50 -E -1") {
+		t.Fatalf("full capture args = %q", calls[1])
+	}
+
+	// Nothing happened since the capture: only discovery runs.
+	info.activity = state.sessions[key].capturedAt.Unix() - 1
+	calls = calls[:0]
+	updateState(context.Background(), &state, cfg)
+	if len(calls) != 1 {
+		t.Fatalf("unchanged pane was captured: %q", calls)
+	}
+
+	// Three lines scroll into history: only the delta is fetched.
+	pane.history = append(pane.history, "$ build", "step", "done")
+	pane.screen = []string{"$ ", "", "", ""}
+	info.activity = state.sessions[key].capturedAt.Unix()
+	info.cursor.x = 2
+	calls = calls[:0]
+	updateState(context.Background(), &state, cfg)
+	if len(calls) != 2 || !strings.Contains(calls[1], fmt.Sprintf("-S -%d -E -1", 3+captureHistorySlack)) {
+		t.Fatalf("delta capture calls = %q", calls)
+	}
+	if got := state.sessions[key].lines; !reflect.DeepEqual(got, wantLines()[:51]) {
+		t.Fatalf("merged lines = %q", got)
+	}
+	if state.sessions[key].historySize != 103 {
+		t.Fatalf("historySize = %d", state.sessions[key].historySize)
+	}
+}
@@ -4,119 +4,148 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// updateState refreshes synchronously and applies the result to state. The
+// app itself refreshes through a refresher goroutine; this is the same
+// pipeline run inline.
 func updateState(ctx context.Context, state *appState, cfg config) {
-	refs, socketCount, err := listSessions(ctx, cfg)
-	state.lastRefresh = time.Now()
-	state.socketCount = socketCount
-	if err != nil {
-		state.lastErr = err.Error()
-		if refs == nil && isSocketUnavailableError(err) {
-			state.serverDown = true
-			state.sessions = map[string]sessionView{}
-			state.scroll = map[string]int{}
-			state.follow = map[string]bool{}
-			state.focusIndex = 0
-			state.focusName = ""
-			return
+	sources := refreshSources{control: state.control, schedule: state.schedule, health: state.health}
+	applySnapshot(state, collectSnapshot(ctx, cfg, sources, state.sessions, state.focusName))
+}
+
+// refreshSources are the long-lived, internally synchronised helpers a
+// refresh consults. The UI only reads them for display.
+type refreshSources struct {
+	control  *controlManager
+	schedule *refreshScheduler
+	health   *healthTracker
+}
+
+// snapshot is the immutable result of one refresh. Neither the map nor the
+// views in it are modified after it is published.
+type snapshot struct {
+	sessions    map[string]sessionView
+	socketCount int
+	err         string
+	serverDown  bool
+	refreshedAt time.Time
+}
+
+// collectSnapshot runs one refresh against the previous snapshot's sessions.
+// It never touches UI state; focus is only used to schedule the focused pane.
+func collectSnapshot(ctx context.Context, cfg config, sources refreshSources, prev map[string]sessionView, focus string) snapshot {
+	now := time.Now()
+	schedule := sources.schedule
+	refs, skipped, socketCount, err := listDueSessions(ctx, cfg, sources.health, func(target socketTarget) bool {
+		if !schedule.socketDue(target, now, cfg) {
+			return false
 		}
-		if refs == nil {
-			state.serverDown = false
-			return
+		schedule.markSocket(target, now)
+		return true
+	})
+	carried := carrySkippedSessions(prev, skipped)
+	snap := snapshot{sessions: carried, socketCount: socketCount, refreshedAt: now}
+	if err != nil {
+		snap.err = err.Error()
+		if refs == nil && len(carried) == 0 {
+			if isSocketUnavailableError(err) {
+				snap.serverDown = true
+				snap.sessions = map[string]sessionView{}
+			} else {
+				snap.sessions = prev
+			}
+			return snap
 		}
-	} else {
-		state.lastErr = ""
 	}
-	state.serverDown = false
-
-	newSessions := make(map[string]sessionView, len(refs))
-	keepScroll := make(map[string]int, len(refs))
-	keepFollow := make(map[string]bool, len(refs))
 	if len(refs) == 0 {
-		state.sessions = newSessions
-		state.scroll = keepScroll
-		state.follow = keepFollow
-		state.focusIndex = 0
-		state.focusName = ""
-		return
+		schedule.prune(snap.sessions)
+		return snap
 	}
 
+	control := sources.control
+	control.sync(append(refSessions(refs), carriedSessions(carried, skipped)...))
+
+	groups := groupRefsBySocket(refs)
 	workers := cfg.maxWorkers
-	if workers > len(refs) {
-		workers = len(refs)
+	if workers > len(groups) {
+		workers = len(groups)
 	}
 	sem := make(chan struct{}, workers)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
-	for _, ref := range refs {
-		ref := ref
+	for _, group := range groups {
+		group := group
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			paneID := ref.paneID
-			if paneID == "" {
-				var err error
-				paneID, err = activePaneID(ctx, cfg, ref.socket.path, ref.name)
-				if err != nil {
-					mu.Lock()
-					newSessions[ref.key] = sessionView{
-						key:        ref.key,
-						name:       ref.name,
-						socketPath: ref.socket.path,
-						socketHint: ref.socket.hint,
-						paneID:     "",
-						lines:      []string{err.Error()},
-						updated:    time.Now(),
-					}
-					mu.Unlock()
-					return
-				}
-			}
-
-			lines, err := capturePane(ctx, cfg, ref.socket.path, paneID, cfg.lines)
-			if err != nil {
-				lines = []string{err.Error()}
-			}
-
+			views := refreshSocket(ctx, cfg, control, schedule, prev, group, now)
 			mu.Lock()
-			newSessions[ref.key] = sessionView{
-				key:        ref.key,
-				name:       ref.name,
-				socketPath: ref.socket.path,
-				socketHint: ref.socket.hint,
-				paneID:     paneID,
-				lines:      lines,
-				updated:    time.Now(),
+			for _, view := range views {
+				snap.sessions[view.key] = view
 			}
 			mu.Unlock()
 		}()
 	}
 
 	wg.Wait()
-	state.sessions = newSessions
-	for _, ref := range refs {
-		key := ref.key
+	if ctx.Err() != nil {
+		return snap
+	}
+	for key, view := range snap.sessions {
+		if !view.polledAt.Equal(now) {
+			continue
+		}
+		old, hasOld := prev[key]
+		changed := !hasOld || !linesEqual(old.lines, view.lines)
+		schedule.observe(key, makeSocketTarget(view.socketPath), key == focus, changed, now, cfg)
+	}
+	schedule.prune(snap.sessions)
+	return snap
+}
+
+// applySnapshot installs a snapshot as the UI's sessions, keeping scroll,
+// follow and mark state for entries that still exist and re-resolving focus
+// by key.
+func applySnapshot(state *appState, snap snapshot) {
+	state.lastRefresh = snap.refreshedAt
+	state.socketCount = snap.socketCount
+	state.lastErr = snap.err
+	state.serverDown = snap.serverDown
+	state.sessions = snap.sessions
+
+	keepScroll := make(map[string]int, len(snap.sessions))
+	keepFollow := make(map[string]bool, len(snap.sessions))
+	for key := range snap.sessions {
 		keepScroll[key] = state.scroll[key]
-		if _, ok := state.follow[key]; ok {
-			keepFollow[key] = state.follow[key]
+		if follow, ok := state.follow[key]; ok {
+			keepFollow[key] = follow
 		} else {
 			keepFollow[key] = true
 		}
 	}
 	state.scroll = keepScroll
 	state.follow = keepFollow
-	keys := make([]string, 0, len(refs))
-	for _, ref := range refs {
-		keys = append(keys, ref.key)
+	for key := range state.marked {
+		if _, ok := snap.sessions[key]; !ok {
+			delete(state.marked, key)
+		}
+	}
+
+	keys := orderedSessionNames(*state)
+	if len(keys) == 0 {
+		state.focusIndex = 0
+		state.focusName = ""
+		return
 	}
 	state.focusIndex = focusIndexForName(keys, state.focusName)
 	if state.focusIndex < 0 || state.focusIndex >= len(keys) {
@@ -127,16 +156,254 @@ func updateState(ctx context.Context, state *appState, cfg config) {
 	}
 }
 
+// carrySkippedSessions keeps the views of sockets the scheduler did not query
+// this tick.
+func carrySkippedSessions(sessions map[string]sessionView, skipped []socketTarget) map[string]sessionView {
+	carried := make(map[string]sessionView)
+	if len(skipped) == 0 {
+		return carried
+	}
+	keys := make(map[string]struct{}, len(skipped))
+	for _, target := range skipped {
+		keys[target.key] = struct{}{}
+	}
+	for key, view := range sessions {
+		if _, ok := keys[socketKey(view.socketPath)]; ok {
+			carried[key] = view
+		}
+	}
+	return carried
+}
+
+// carriedSessions returns the sessions that still have views on skipped
+// sockets, so their control clients are kept running.
+func carriedSessions(carried map[string]sessionView, skipped []socketTarget) []controlTarget {
+	seen := make(map[string]struct{}, len(carried))
+	targets := make([]controlTarget, 0)
+	for _, target := range skipped {
+		for _, view := range carried {
+			if socketKey(view.socketPath) != target.key {
+				continue
+			}
+			ct := controlTarget{socket: target, session: view.name}
+			if _, ok := seen[ct.key()]; !ok {
+				seen[ct.key()] = struct{}{}
+				targets = append(targets, ct)
+			}
+		}
+	}
+	return targets
+}
+
+func linesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshSocket builds the views for all refs on one socket. Streamed panes
+// come from the control client, panes that are not due yet or did not change
+// since the previous view are reused, and everything else is captured
+// incrementally with a single chained tmux invocation.
+func refreshSocket(ctx context.Context, cfg config, control *controlManager, schedule *refreshScheduler, prev map[string]sessionView, refs []sessionRef, now time.Time) []sessionView {
+	views := make([]sessionView, 0, len(refs))
+	pending := make([]sessionRef, 0, len(refs))
+	gens := make(map[string]uint64, len(refs))
+	plans := make([]capturePlan, 0, len(refs))
+	planIndex := make(map[string]int, len(refs))
+	for _, ref := range refs {
+		if ref.paneID == "" {
+			views = append(views, newSessionView(ref, []string{"no pane found"}))
+			continue
+		}
+		lines, grid, gen, streamed := control.paneLines(ref.socket, ref.name, ref.paneID, cfg.lines)
+		if streamed {
+			view := newSessionView(ref, lines)
+			view.grid = grid
+			view.screenRows = len(grid.rows)
+			view.polledAt = now
+			views = append(views, view)
+			continue
+		}
+		old, hasOld := prev[ref.key]
+		if hasOld && !schedule.paneDue(ref.key, now) && ref.pane.activity < old.capturedAt.Unix() {
+			views = append(views, reuseSessionView(old, ref))
+			continue
+		}
+		plan, skip := planCapture(old, hasOld, ref.pane, cfg.lines)
+		if skip && !control.covers(ref.socket, ref.name) {
+			view := reuseSessionView(old, ref)
+			view.polledAt = now
+			views = append(views, view)
+			continue
+		}
+		gens[ref.key] = gen
+		pending = append(pending, ref)
+		if i, ok := planIndex[ref.paneID]; ok {
+			// A pane linked into several sessions has one history per view;
+			// only a full capture is valid for all of them.
+			plans[i] = capturePlan{paneID: ref.paneID, history: cfg.lines, full: true}
+			continue
+		}
+		planIndex[ref.paneID] = len(plans)
+		plans = append(plans, plan)
+	}
+	if len(pending) == 0 {
+		return views
+	}
+
+	socketPath := pending[0].socket.path
+	captured := capturePanes(ctx, cfg, socketPath, plans)
+	for _, ref := range pending {
+		result := captured[ref.paneID]
+		view := newSessionView(ref, nil)
+		view.polledAt = now
+		if result.err != nil {
+			view.lines = []string{result.err.Error()}
+			views = append(views, view)
+			continue
+		}
+		mergeCapture(&view, prev[ref.key], plans[planIndex[ref.paneID]], result, cfg.lines)
+		if !hasVisibleCapture(view.lines) {
+			view.lines = withAlternateFallback(ctx, cfg, socketPath, ref.paneID, cfg.lines, view.lines)
+			view.historySize = -1
+			view.screenRows = 0
+		}
+		if ref.pane.alternate && view.screenRows > 0 {
+			screen := view.lines[len(view.lines)-view.screenRows:]
+			view.grid = gridFromScreen(screen, ref.pane.width, ref.pane.height, ref.pane.cursor, true)
+		}
+		if control.covers(ref.socket, ref.name) {
+			control.seedPane(ref.socket, ref.name, ref.pane, view.lines, view.screenRows, cfg.lines, gens[ref.key])
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+func newSessionView(ref sessionRef, lines []string) sessionView {
+	view := sessionView{
+		key:         ref.key,
+		name:        ref.name,
+		socketPath:  ref.socket.path,
+		socketHint:  ref.socket.hint,
+		paneID:      ref.paneID,
+		lines:       lines,
+		updated:     time.Now(),
+		cursor:      ref.pane.cursor,
+		width:       ref.pane.width,
+		height:      ref.pane.height,
+		mouse:       ref.pane.mouse,
+		historySize: -1,
+	}
+	setViewPosition(&view, ref.pane)
+	return view
+}
+
+// reuseSessionView keeps the captured content of an unchanged pane and only
+// refreshes the discovery fields.
+func reuseSessionView(old sessionView, ref sessionRef) sessionView {
+	view := old
+	view.name = ref.name
+	view.socketHint = ref.socket.hint
+	view.cursor = ref.pane.cursor
+	view.width = ref.pane.width
+	view.height = ref.pane.height
+	view.mouse = ref.pane.mouse
+	setViewPosition(&view, ref.pane)
+	return view
+}
+
+func setViewPosition(view *sessionView, pane paneInfo) {
+	view.windowIndex = pane.windowIndex
+	view.windowName = pane.windowName
+	view.windowLayout = pane.windowLayout
+	view.windowActive = pane.windowActive
+	view.paneIndex = pane.paneIndex
+	view.paneActive = pane.paneActive
+}
+
+func groupRefsBySocket(refs []sessionRef) [][]sessionRef {
+	index := make(map[string]int, len(refs))
+	groups := make([][]sessionRef, 0)
+	for _, ref := range refs {
+		i, ok := index[ref.socket.key]
+		if !ok {
+			i = len(groups)
+			index[ref.socket.key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], ref)
+	}
+	return groups
+}
+
+// refSessions returns the sessions of refs, one control target each.
+func refSessions(refs []sessionRef) []controlTarget {
+	seen := make(map[string]struct{}, len(refs))
+	targets := make([]controlTarget, 0)
+	for _, ref := range refs {
+		target := controlTarget{socket: ref.socket, session: ref.name}
+		if _, ok := seen[target.key()]; ok {
+			continue
+		}
+		seen[target.key()] = struct{}{}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
 func listSessions(ctx context.Context, cfg config) ([]sessionRef, int, error) {
+	refs, _, socketCount, err := listDueSessions(ctx, cfg, nil, nil)
+	return refs, socketCount, err
+}
+
+// listDueSessions lists sessions on every discovered socket that health
+// allows and for which due returns true (all sockets when due is nil).
+// Sockets that are not due are returned separately so their previous views
+// can be kept; sockets that are backing off are left out.
+func listDueSessions(ctx context.Context, cfg config, health *healthTracker, due func(socketTarget) bool) ([]sessionRef, []socketTarget, int, error) {
 	targets, discoveryErrors := discoverSocketTargets(cfg)
+	health.prune(targets)
 	if len(targets) == 0 {
 		if len(discoveryErrors) > 0 {
 			sort.Strings(discoveryErrors)
-			return nil, 0, errors.New(strings.Join(discoveryErrors, " | "))
+			return nil, nil, 0, errors.New(strings.Join(discoveryErrors, " | "))
+		}
+		return nil, nil, 0, errors.New("no tmux sockets configured")
+	}
+	now := time.Now()
+	skipped := make([]socketTarget, 0)
+	blocked := make([]string, 0)
+	dueTargets := make([]socketTarget, 0, len(targets))
+	for _, target := range targets {
+		switch {
+		case !health.allow(target, now):
+			blocked = append(blocked, target.hint)
+		case due != nil && !due(target):
+			skipped = append(skipped, target)
+		default:
+			dueTargets = append(dueTargets, target)
+		}
+	}
+	if len(dueTargets) == 0 {
+		if len(skipped) == 0 && len(blocked) > 0 {
+			sort.Strings(blocked)
+			return nil, skipped, len(targets), errors.New("backing off failing sockets: " + strings.Join(blocked, ", "))
 		}
-		return nil, 0, errors.New("no tmux sockets configured")
+		return []sessionRef{}, skipped, len(targets), nil
 	}
+	refs, _, err := listSessionsOnTargets(ctx, cfg, health, dueTargets, discoveryErrors)
+	return refs, skipped, len(targets), err
+}
 
+func listSessionsOnTargets(ctx context.Context, cfg config, health *healthTracker, targets []socketTarget, discoveryErrors []string) ([]sessionRef, int, error) {
 	merged := make([]sessionRef, 0)
 	fatalErrors := append([]string{}, discoveryErrors...)
 	unavailableTargets := make([]string, 0)
@@ -145,6 +412,9 @@ func listSessions(ctx context.Context, cfg config) ([]sessionRef, int, error) {
 	for _, target := range targets {
 		refs, err := listSessionsOnSocket(ctx, cfg, target)
 		if err != nil {
+			if ctx.Err() == nil {
+				health.failure(target, err, time.Now())
+			}
 			if isSocketUnavailableError(err) {
 				unavailableTargets = append(unavailableTargets, target.hint)
 				continue
@@ -152,22 +422,14 @@ func listSessions(ctx context.Context, cfg config) ([]sessionRef, int, error) {
 			fatalErrors = append(fatalErrors, fmt.Sprintf("%s: %v", target.hint, err))
 			continue
 		}
+		health.success(target, len(refs), time.Now())
 		successCount++
 		merged = append(merged, refs...)
 	}
 
 	if successCount > 0 {
 		sort.Slice(merged, func(i, j int) bool {
-			if merged[i].name == merged[j].name {
-				if merged[i].socket.key == merged[j].socket.key {
-					if merged[i].paneID == merged[j].paneID {
-						return merged[i].key < merged[j].key
-					}
-					return merged[i].paneID < merged[j].paneID
-				}
-				return merged[i].socket.key < merged[j].socket.key
-			}
-			return merged[i].name < merged[j].name
+			return refPath(merged[i]).less(refPath(merged[j]))
 		})
 		if len(fatalErrors) > 0 {
 			sort.Strings(fatalErrors)
@@ -188,84 +450,133 @@ func listSessions(ctx context.Context, cfg config) ([]sessionRef, int, error) {
 	return []sessionRef{}, len(targets), nil
 }
 
-func listSessionsOnSocket(ctx context.Context, cfg config, target socketTarget) ([]sessionRef, error) {
-	out, err := runTmuxOnSocketFn(ctx, cfg, target.path, "list-sessions", "-F", "#S")
+// paneActivityFormat fetches the pane's last activity and its window's as
+// one list-panes field. tmux versions without pane_activity leave it empty.
+const paneActivityFormat = "#{pane_activity},#{window_activity}"
+
+// parsePaneActivity returns the pane's activity time, or the window's when
+// tmux does not report it per pane.
+func parsePaneActivity(v string) int64 {
+	pane, window, _ := strings.Cut(v, ",")
+	if pane != "" {
+		return int64(atoiDefault(pane, 0))
+	}
+	return int64(atoiDefault(window, 0))
+}
+
+// paneFields lists the format fields fetched by the single list-panes call
+// per socket. session_name stays last so it may contain the separator.
+var paneFields = []struct {
+	format string
+	set    func(*paneInfo, string)
+}{
+	{"#{pane_id}", func(p *paneInfo, v string) { p.paneID = v }},
+	{"#{window_index}", func(p *paneInfo, v string) { p.windowIndex = atoiDefault(v, 0) }},
+	{"#{window_active}", func(p *paneInfo, v string) { p.windowActive = v == "1" }},
+	{"#{pane_active}", func(p *paneInfo, v string) { p.paneActive = v == "1" }},
+	{"#{cursor_x}", func(p *paneInfo, v string) { p.cursor.x = atoiDefault(v, 0) }},
+	{"#{cursor_y}", func(p *paneInfo, v string) { p.cursor.y = atoiDefault(v, 0) }},
+	{"#{cursor_flag}", func(p *paneInfo, v string) { p.cursor.visible = v == "1" }},
+	{"#{pane_height}", func(p *paneInfo, v string) { p.height = atoiDefault(v, 0) }},
+	{"#{history_size}", func(p *paneInfo, v string) { p.historySize = atoiDefault(v, 0) }},
+	{"#{history_limit}", func(p *paneInfo, v string) { p.historyLimit = atoiDefault(v, 0) }},
+	{paneActivityFormat, func(p *paneInfo, v string) { p.activity = parsePaneActivity(v) }},
+	{"#{pane_width}", func(p *paneInfo, v string) { p.width = atoiDefault(v, 0) }},
+	{"#{alternate_on}", func(p *paneInfo, v string) { p.alternate = v == "1" }},
+	{paneMouseFormat, func(p *paneInfo, v string) { p.mouse = parsePaneMouse(v) }},
+	{"#{window_layout}", func(p *paneInfo, v string) { p.windowLayout = v }},
+	{"#{pane_index}", func(p *paneInfo, v string) { p.paneIndex = atoiDefault(v, 0) }},
+	{"#{window_name}", func(p *paneInfo, v string) { p.windowName = v }},
+	{"#{session_name}", func(p *paneInfo, v string) { p.sessionName = v }},
+}
+
+func paneListFormat() string {
+	formats := make([]string, 0, len(paneFields))
+	for _, field := range paneFields {
+		formats = append(formats, field.format)
+	}
+	return strings.Join(formats, "\t")
+}
+
+func parsePaneLine(line string) (paneInfo, bool) {
+	values := strings.SplitN(line, "\t", len(paneFields))
+	if len(values) != len(paneFields) {
+		return paneInfo{}, false
+	}
+	var info paneInfo
+	for i, field := range paneFields {
+		field.set(&info, values[i])
+	}
+	if strings.TrimSpace(info.paneID) == "" || info.sessionName == "" {
+		return paneInfo{}, false
+	}
+	info.cursor.valid = true
+	return info, true
+}
+
+func listPanesOnSocket(ctx context.Context, cfg config, socketPath string) ([]paneInfo, error) {
+	out, err := runTmuxOnSocketFn(ctx, cfg, socketPath, "list-panes", "-a", "-F", paneListFormat())
 	if err != nil {
 		return nil, err
 	}
-	if strings.TrimSpace(out) == "" {
-		return []sessionRef{}, nil
-	}
-	lines := strings.Split(strings.TrimSpace(out), "\n")
-	refs := make([]sessionRef, 0, len(lines))
-	for _, line := range lines {
-		sessionName := strings.TrimSpace(line)
-		if sessionName == "" {
-			continue
+	panes := make([]paneInfo, 0)
+	for _, line := range strings.Split(out, "\n") {
+		if info, ok := parsePaneLine(line); ok {
+			panes = append(panes, info)
 		}
-		if cfg.allPanes {
-			paneIDs, paneErr := listPaneIDs(ctx, cfg, target.path, sessionName)
-			if paneErr != nil {
-				refs = append(refs, sessionRef{
-					key:    sessionQualifiedKey(target.path, sessionName),
-					name:   sessionName,
-					paneID: "",
-					socket: target,
-				})
-				continue
-			}
-			if len(paneIDs) == 0 {
-				refs = append(refs, sessionRef{
-					key:    sessionQualifiedKey(target.path, sessionName),
-					name:   sessionName,
-					paneID: "",
-					socket: target,
-				})
-				continue
-			}
-			for _, paneID := range paneIDs {
-				refs = append(refs, sessionRef{
-					key:    paneQualifiedKey(target.path, sessionName, paneID),
-					name:   sessionName,
-					paneID: paneID,
-					socket: target,
-				})
-			}
-			continue
-		}
-		refs = append(refs, sessionRef{
-			key:    sessionQualifiedKey(target.path, sessionName),
-			name:   sessionName,
-			paneID: "",
-			socket: target,
-		})
 	}
-	return refs, nil
+	return panes, nil
 }
 
-func listPaneIDs(ctx context.Context, cfg config, socketPath string, session string) ([]string, error) {
-	out, err := runTmuxOnSocketFn(ctx, cfg, socketPath, "list-panes", "-t", session, "-F", "#{pane_id}")
+func listSessionsOnSocket(ctx context.Context, cfg config, target socketTarget) ([]sessionRef, error) {
+	panes, err := listPanesOnSocket(ctx, cfg, target.path)
 	if err != nil {
 		return nil, err
 	}
-	if strings.TrimSpace(out) == "" {
-		return []string{}, nil
+	refs := make([]sessionRef, 0, len(panes))
+	if cfg.allPanes {
+		seen := make(map[string]struct{}, len(panes))
+		for _, pane := range panes {
+			key := paneQualifiedKey(target.path, pane.sessionName, pane.paneID)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			refs = append(refs, newSessionRef(target, key, pane))
+		}
+		return refs, nil
 	}
-	lines := strings.Split(strings.TrimSpace(out), "\n")
-	paneIDs := make([]string, 0, len(lines))
-	seen := make(map[string]struct{}, len(lines))
-	for _, line := range lines {
-		paneID := strings.TrimSpace(line)
-		if paneID == "" {
+
+	// One entry per session: the active pane of its active window, or its
+	// first pane when tmux reports none as active.
+	chosen := make(map[string]int, len(panes))
+	order := make([]string, 0)
+	for i, pane := range panes {
+		prev, ok := chosen[pane.sessionName]
+		if !ok {
+			chosen[pane.sessionName] = i
+			order = append(order, pane.sessionName)
 			continue
 		}
-		if _, ok := seen[paneID]; ok {
-			continue
+		if pane.windowActive && pane.paneActive && !(panes[prev].windowActive && panes[prev].paneActive) {
+			chosen[pane.sessionName] = i
 		}
-		seen[paneID] = struct{}{}
-		paneIDs = append(paneIDs, paneID)
 	}
-	return paneIDs, nil
+	for _, name := range order {
+		pane := panes[chosen[name]]
+		refs = append(refs, newSessionRef(target, sessionQualifiedKey(target.path, name), pane))
+	}
+	return refs, nil
+}
+
+func newSessionRef(target socketTarget, key string, pane paneInfo) sessionRef {
+	return sessionRef{
+		key:    key,
+		name:   pane.sessionName,
+		paneID: pane.paneID,
+		pane:   pane,
+		socket: target,
+	}
 }
 
 func activePaneID(ctx context.Context, cfg config, socketPath string, session string) (string, error) {
@@ -292,33 +603,249 @@ func activePaneID(ctx context.Context, cfg config, socketPath string, session st
 	return fallback, nil
 }
 
+// captureHistorySlack extra history lines are fetched on top of the growth
+// seen at discovery, so lines that scroll before the capture runs are kept.
+const captureHistorySlack = 16
+
+type capturePlan struct {
+	paneID  string
+	history int
+	full    bool
+	atLimit bool
+}
+
+type paneCapture struct {
+	historySize int
+	history     []string
+	screen      []string
+	started     time.Time
+	err         error
+}
+
+// planCapture decides what to fetch for a pane. skip is true when the pane
+// cannot have changed since the previous view: same size, history size and
+// cursor, and no pane activity since the second that capture started in.
+func planCapture(prev sessionView, hasPrev bool, pane paneInfo, limit int) (capturePlan, bool) {
+	plan := capturePlan{paneID: pane.paneID, history: limit, full: true}
+	if !hasPrev || prev.historySize < 0 || prev.captureLimit != limit || prev.capturedAt.IsZero() {
+		return plan, false
+	}
+	if pane.historySize < prev.historySize {
+		return plan, false
+	}
+	unchanged := pane.width == prev.width &&
+		pane.height == prev.height &&
+		pane.historySize == prev.historySize &&
+		pane.cursor.x == prev.cursor.x &&
+		pane.cursor.y == prev.cursor.y &&
+		pane.activity < prev.capturedAt.Unix()
+	if unchanged {
+		return plan, true
+	}
+
+	plan.full = false
+	plan.atLimit = pane.historyLimit > 0 && pane.historySize >= pane.historyLimit
+	plan.history = 0
+	if pane.historySize > 0 {
+		plan.history = pane.historySize - prev.historySize + captureHistorySlack
+		if plan.atLimit {
+			plan.history = 0
+		}
+		if plan.history > limit {
+			plan.history = limit
+		}
+	}
+	return plan, false
+}
+
+// capturePanes runs the planned captures for one socket in a single tmux
+// invocation. Each pane contributes a marker line carrying its history size
+// at capture time, an optional history range and the visible screen. If the
+// chain fails (for example because a pane vanished) each pane falls back to a
+// full capture of its own.
+func capturePanes(ctx context.Context, cfg config, socketPath string, plans []capturePlan) map[string]paneCapture {
+	results := make(map[string]paneCapture, len(plans))
+	started := time.Now()
+	captureEach := func(each []capturePlan) {
+		for _, plan := range each {
+			lines, err := capturePane(ctx, cfg, socketPath, plan.paneID, maxInt(plan.history, cfg.lines))
+			results[plan.paneID] = paneCapture{historySize: -1, history: lines, started: started, err: err}
+		}
+	}
+
+	marker := fmt.Sprintf("__tmux-visualiser-%x__", started.UnixNano())
+	args := make([]string, 0, len(plans)*24)
+	for i, plan := range plans {
+		if i > 0 {
+			args = append(args, ";")
+		}
+		args = append(args, "display-message", "-p", "-t", plan.paneID, marker+" "+plan.paneID+" #{history_size}")
+		if plan.history > 0 {
+			args = append(args, ";", "capture-pane", "-t", plan.paneID, "-p", "-e", "-S", fmt.Sprintf("-%d", plan.history), "-E", "-1")
+		}
+		args = append(args, ";", "display-message", "-p", marker+"-screen "+plan.paneID)
+		args = append(args, ";", "capture-pane", "-t", plan.paneID, "-p", "-e", "-S", "0", "-E", "-")
+	}
+	out, err := runTmuxOnSocketFn(ctx, cfg, socketPath, args...)
+	if err != nil {
+		captureEach(plans)
+		return results
+	}
+
+	parsed := splitCaptureBatch(out, marker)
+	missing := make([]capturePlan, 0)
+	for _, plan := range plans {
+		capture, ok := parsed[plan.paneID]
+		if !ok {
+			missing = append(missing, plan)
+			continue
+		}
+		if plan.history == 0 || capture.historySize == 0 {
+			// With an empty history tmux clamps -E -1 onto the screen.
+			capture.history = nil
+		}
+		capture.started = started
+		results[plan.paneID] = capture
+	}
+	captureEach(missing)
+	return results
+}
+
+func splitCaptureBatch(out string, marker string) map[string]paneCapture {
+	captures := make(map[string]paneCapture)
+	current := ""
+	inScreen := false
+	for _, line := range strings.Split(out, "\n") {
+		if rest, ok := strings.CutPrefix(line, marker+" "); ok {
+			fields := strings.Fields(rest)
+			if len(fields) != 2 {
+				current = ""
+				continue
+			}
+			current = fields[0]
+			inScreen = false
+			captures[current] = paneCapture{historySize: atoiDefault(fields[1], -1), history: []string{}, screen: []string{}}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, marker+"-screen "); ok {
+			current = rest
+			inScreen = true
+			continue
+		}
+		capture, ok := captures[current]
+		if !ok {
+			continue
+		}
+		if inScreen {
+			capture.screen = append(capture.screen, line)
+		} else {
+			capture.history = append(capture.history, line)
+		}
+		captures[current] = capture
+	}
+	for paneID, capture := range captures {
+		end := len(capture.screen)
+		for end > 0 && capture.screen[end-1] == "" {
+			end--
+		}
+		capture.screen = capture.screen[:end]
+		captures[paneID] = capture
+	}
+	return captures
+}
+
+// mergeCapture folds a capture into the view's line store. Full captures
+// replace it; incremental ones append the new history lines to the previous
+// history and swap in the fresh screen. When the capture cannot be lined up
+// with the previous store, historySize is reset so the next refresh fetches
+// everything again.
+func mergeCapture(view *sessionView, prev sessionView, plan capturePlan, capture paneCapture, limit int) {
+	view.captureLimit = limit
+	view.capturedAt = capture.started
+	view.historySize = capture.historySize
+	view.screenRows = len(capture.screen)
+	view.contentHash = hashLines(capture.screen)
+
+	history := capture.history
+	if !plan.full && capture.historySize >= 0 {
+		prevHistory := prev.lines[:maxInt(0, len(prev.lines)-prev.screenRows)]
+		need := capture.historySize - prev.historySize
+		switch {
+		case plan.atLimit:
+			history = prevHistory
+			if view.contentHash != prev.contentHash {
+				// Lines scrolled through a full history; we cannot tell how
+				// many, so fetch everything next time.
+				view.historySize = -1
+			}
+		case need == 0 && view.contentHash == prev.contentHash:
+			view.lines = prev.lines
+			return
+		case need == 0:
+			history = prevHistory
+		case need > 0 && need <= len(capture.history):
+			history = append(append([]string(nil), prevHistory...), capture.history[len(capture.history)-need:]...)
+		default:
+			history = append(append([]string(nil), prevHistory...), capture.history...)
+			view.historySize = -1
+		}
+	}
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	lines := make([]string, 0, len(history)+len(capture.screen))
+	lines = append(lines, history...)
+	lines = append(lines, capture.screen...)
+	view.lines = lines
+}
+
+func hashLines(lines []string) uint64 {
+	h := fnv.New64a()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+func captureArgs(paneID string, lines int, alternate bool) []string {
+	args := []string{"capture-pane"}
+	if alternate {
+		args = append(args, "-a")
+	}
+	return append(args, "-t", paneID, "-p", "-e", "-S", fmt.Sprintf("-%d", lines))
+}
+
 func capturePane(ctx context.Context, cfg config, socketPath string, paneID string, lines int) ([]string, error) {
 	if lines < 1 {
 		lines = 1
 	}
-	rangeArg := fmt.Sprintf("-%d", lines)
-	out, err := runTmuxOnSocketFn(ctx, cfg, socketPath, "capture-pane", "-t", paneID, "-p", "-e", "-S", rangeArg)
+	out, err := runTmuxOnSocketFn(ctx, cfg, socketPath, captureArgs(paneID, lines, false)...)
 	if err != nil {
 		return nil, err
 	}
+	return withAlternateFallback(ctx, cfg, socketPath, paneID, lines, normalizeCaptureOutput(out)), nil
+}
 
-	primary := normalizeCaptureOutput(out)
+// withAlternateFallback retries an empty capture against the alternate
+// screen, which is where full-screen apps leave their content.
+func withAlternateFallback(ctx context.Context, cfg config, socketPath string, paneID string, lines int, primary []string) []string {
 	if hasVisibleCapture(primary) {
-		return primary, nil
+		return primary
 	}
 
-	altOut, altErr := runTmuxOnSocketFn(ctx, cfg, socketPath, "capture-pane", "-a", "-t", paneID, "-p", "-e", "-S", rangeArg)
+	altOut, altErr := runTmuxOnSocketFn(ctx, cfg, socketPath, captureArgs(paneID, lines, true)...)
 	if altErr == nil {
 		alt := normalizeCaptureOutput(altOut)
 		if len(alt) > 0 {
-			return alt, nil
+			return alt
 		}
 	}
 
 	if len(primary) == 0 {
-		return []string{"(empty)"}, nil
+		return []string{"(empty)"}
 	}
-	return primary, nil
+	return primary
 }
 
 func normalizeCaptureOutput(out string) []string {
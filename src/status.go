@@ -0,0 +1,476 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Default status bar segments for -status-left, -status-center and
+// -status-right.
+const (
+	defaultStatusLeft   = "mode,sockets,entries,marks,stream,zoom,page"
+	defaultStatusCenter = "toast,help"
+	defaultStatusRight  = "error,health,interval,lines,clock"
+)
+
+const (
+	// toastDuration is how long a toast stays in the status bar.
+	toastDuration = 5 * time.Second
+	// maxToasts caps the queue; the oldest toasts are dropped first.
+	maxToasts = 8
+	// statusMinShrink is the narrowest a shrinkable segment is cut to
+	// before it is dropped instead.
+	statusMinShrink = 10
+	statusSeparator = " | "
+)
+
+// statusClock is the time source for the clock segment and toast expiry.
+var statusClock = time.Now
+
+// toast is a timed message in the status bar.
+type toast struct {
+	text     string
+	severity string
+	until    time.Time
+}
+
+// showToast queues a message for toastDuration. severity is "error",
+// "warn" or "" for plain information.
+func showToast(state *appState, severity, text string) {
+	state.toasts = append(state.toasts, toast{text: text, severity: severity, until: statusClock().Add(toastDuration)})
+	if len(state.toasts) > maxToasts {
+		state.toasts = state.toasts[len(state.toasts)-maxToasts:]
+	}
+}
+
+// expireToasts drops toasts that have timed out at now and reports whether
+// any were dropped.
+func expireToasts(state *appState, now time.Time) bool {
+	kept := state.toasts[:0]
+	for _, t := range state.toasts {
+		if now.Before(t.until) {
+			kept = append(kept, t)
+		}
+	}
+	expired := len(kept) != len(state.toasts)
+	state.toasts = kept
+	return expired
+}
+
+// statusPart is a run of status bar text in one style.
+type statusPart struct {
+	text  string
+	style tcell.Style
+}
+
+// statusSegment is one item of the status bar. When the bar is too narrow
+// segments are dropped lowest priority first; a shrinkable one is cut
+// short instead while it can keep statusMinShrink cells.
+type statusSegment struct {
+	priority int
+	shrink   bool
+	parts    []statusPart
+}
+
+func (s statusSegment) width() int {
+	w := 0
+	for _, p := range s.parts {
+		w += textWidth(p.text)
+	}
+	return w
+}
+
+// truncate cuts the segment to width cells, ending it with an ellipsis in
+// the style of the last part kept.
+func (s *statusSegment) truncate(width int) {
+	var parts []statusPart
+	left := width - 1
+	for _, p := range s.parts {
+		text := truncateWidth(p.text, left)
+		if text == "" {
+			break
+		}
+		left -= textWidth(text)
+		parts = append(parts, statusPart{text, p.style})
+	}
+	style := s.parts[0].style
+	if len(parts) > 0 {
+		style = parts[len(parts)-1].style
+	}
+	s.parts = append(parts, statusPart{"…", style})
+}
+
+// statusInput is what segment providers draw from.
+type statusInput struct {
+	state        appState
+	cfg          config
+	theme        theme
+	style        tcell.Style
+	width, y     int
+	sessionCount int
+	now          time.Time
+}
+
+// statusProvider renders a named segment; ok is false when it has nothing
+// to show.
+type statusProvider struct {
+	name   string
+	render func(in statusInput) (seg statusSegment, ok bool)
+}
+
+var statusProviders = []statusProvider{
+	{"mode", statusMode},
+	{"sockets", statusSockets},
+	{"entries", statusEntries},
+	{"marks", statusMarks},
+	{"stream", statusStream},
+	{"zoom", statusZoom},
+	{"page", statusPage},
+	{"toast", statusToast},
+	{"help", statusHelp},
+	{"error", statusError},
+	{"health", statusHealth},
+	{"interval", statusInterval},
+	{"lines", statusLines},
+	{"all-panes", statusAllPanes},
+	{"level", statusLevel},
+	{"clock", statusClockSegment},
+}
+
+func statusSegmentNames() []string {
+	names := make([]string, len(statusProviders))
+	for i, p := range statusProviders {
+		names[i] = p.name
+	}
+	return names
+}
+
+func statusProviderByName(name string) (statusProvider, bool) {
+	for _, p := range statusProviders {
+		if p.name == name {
+			return p, true
+		}
+	}
+	return statusProvider{}, false
+}
+
+// parseStatusSegments splits a comma-separated segment list, as given to
+// -status-left, -status-center or -status-right.
+func parseStatusSegments(spec string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := statusProviderByName(name); !ok {
+			return nil, fmt.Errorf("unknown status segment %q (want one of %s)", name, strings.Join(statusSegmentNames(), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// statusLayout returns the left, centre and right segment lists. A config
+// with none set uses the defaults.
+func statusLayout(cfg config) [3][]string {
+	specs := [3]string{cfg.statusLeft, cfg.statusCenter, cfg.statusRight}
+	if specs == [3]string{} {
+		specs = [3]string{defaultStatusLeft, defaultStatusCenter, defaultStatusRight}
+	}
+	var out [3][]string
+	for i, spec := range specs {
+		out[i], _ = parseStatusSegments(spec)
+	}
+	return out
+}
+
+// statusUsesClock reports whether the status bar shows the clock, which
+// needs a redraw every second.
+func statusUsesClock(cfg config) bool {
+	for _, side := range statusLayout(cfg) {
+		for _, name := range side {
+			if name == "clock" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func drawStatus(screen tcell.Screen, width, y int, style tcell.Style, state appState, cfg config, sessionCount int) {
+	if y < 0 || width <= 0 {
+		return
+	}
+	in := statusInput{state: state, cfg: cfg, theme: activeTheme(state), style: style, width: width, y: y, sessionCount: sessionCount, now: statusClock()}
+	var sides [3][]statusSegment
+	for i, names := range statusLayout(cfg) {
+		for _, name := range names {
+			provider, _ := statusProviderByName(name)
+			if seg, ok := provider.render(in); ok && seg.width() > 0 {
+				sides[i] = append(sides[i], seg)
+			}
+		}
+	}
+	fitStatus(&sides, width)
+
+	drawText(screen, 0, y, width, "", style)
+	left, center, right := sideWidth(sides[0]), sideWidth(sides[1]), sideWidth(sides[2])
+	drawStatusSide(screen, 0, y, sides[0], style)
+	drawStatusSide(screen, width-right, y, sides[2], style)
+	if center > 0 {
+		lo := 0
+		if left > 0 {
+			lo = left + 1
+		}
+		hi := width - center
+		if right > 0 {
+			hi -= right + 1
+		}
+		x := clampInt((width-center)/2, lo, maxInt(lo, hi))
+		drawStatusSide(screen, x, y, sides[1], style)
+	}
+}
+
+func sideWidth(segs []statusSegment) int {
+	if len(segs) == 0 {
+		return 0
+	}
+	w := textWidth(statusSeparator) * (len(segs) - 1)
+	for _, seg := range segs {
+		w += seg.width()
+	}
+	return w
+}
+
+func statusWidth(sides *[3][]statusSegment) int {
+	total, used := 0, 0
+	for _, side := range sides {
+		if w := sideWidth(side); w > 0 {
+			total += w
+			used++
+		}
+	}
+	if used > 1 {
+		total += used - 1
+	}
+	return total
+}
+
+// fitStatus drops or shrinks the lowest-priority segments, rightmost first
+// on ties, until the bar fits width.
+func fitStatus(sides *[3][]statusSegment, width int) {
+	for {
+		over := statusWidth(sides) - width
+		if over <= 0 {
+			return
+		}
+		side, idx := -1, -1
+		for i := range sides {
+			for j, seg := range sides[i] {
+				if side < 0 || seg.priority <= sides[side][idx].priority {
+					side, idx = i, j
+				}
+			}
+		}
+		if side < 0 {
+			return
+		}
+		seg := &sides[side][idx]
+		if keep := seg.width() - over; seg.shrink && keep >= statusMinShrink {
+			seg.truncate(keep)
+			return
+		}
+		sides[side] = append(sides[side][:idx:idx], sides[side][idx+1:]...)
+	}
+}
+
+func drawStatusSide(screen tcell.Screen, x, y int, segs []statusSegment, style tcell.Style) {
+	for i, seg := range segs {
+		if i > 0 {
+			x = drawStatusText(screen, x, y, statusSeparator, style)
+		}
+		for _, p := range seg.parts {
+			x = drawStatusText(screen, x, y, p.text, p.style)
+		}
+	}
+}
+
+func drawStatusText(screen tcell.Screen, x, y int, text string, style tcell.Style) int {
+	width := textWidth(text)
+	col, _ := drawGraphemes(screen, x, y, 0, width, text, style)
+	return x + col
+}
+
+func plainSegment(in statusInput, priority int, text string) (statusSegment, bool) {
+	return statusSegment{priority: priority, parts: []statusPart{{text, in.style}}}, true
+}
+
+var modeNames = [focusModeCount]string{"NORMAL", "UPDATE", "COMPOSE", "SELECT", "SEND KEY", "COMMAND"}
+
+func statusMode(in statusInput) (statusSegment, bool) {
+	mode := stateMode(in.state)
+	seg := statusSegment{priority: 10, parts: []statusPart{{" " + modeNames[mode] + " ", in.theme.bannerStyle(mode)}}}
+	// A chord prefix waiting for its next key shows beside the mode.
+	if len(in.state.keyPending) > 0 {
+		seg.parts = append(seg.parts, statusPart{" " + in.state.keyPending.String() + " …", in.style.Bold(true)})
+	}
+	return seg, true
+}
+
+// statusMarks counts the panes marked for synchronized typing.
+func statusMarks(in statusInput) (statusSegment, bool) {
+	n := len(markedKeys(in.state))
+	if n == 0 {
+		return statusSegment{}, false
+	}
+	return statusSegment{priority: 6, parts: []statusPart{{fmt.Sprintf("marked:%d", n), in.theme.severityStyle(in.style, "warn")}}}, true
+}
+
+func statusSockets(in statusInput) (statusSegment, bool) {
+	seg := statusSegment{priority: 7, parts: []statusPart{{fmt.Sprintf("sockets:%d", in.state.socketCount), in.style}}}
+	if unhealthy := in.state.health.unhealthy(); unhealthy > 0 {
+		seg.parts = append(seg.parts, statusPart{fmt.Sprintf(" (%d failing)", unhealthy), in.theme.severityStyle(in.style, "warn")})
+	}
+	return seg, true
+}
+
+func statusEntries(in statusInput) (statusSegment, bool) {
+	label := "sessions"
+	if in.cfg.allPanes {
+		label = "panes"
+	}
+	return plainSegment(in, 6, fmt.Sprintf("%s:%d", label, in.sessionCount))
+}
+
+func statusStream(in statusInput) (statusSegment, bool) {
+	if !in.cfg.controlMode {
+		return statusSegment{}, false
+	}
+	return plainSegment(in, 4, fmt.Sprintf("stream:%d", in.state.control.liveCount()))
+}
+
+func statusZoom(in statusInput) (statusSegment, bool) {
+	if !in.state.zoomed {
+		return statusSegment{}, false
+	}
+	return plainSegment(in, 6, "ZOOM")
+}
+
+func statusPage(in statusInput) (statusSegment, bool) {
+	layout := layoutScreen(in.state, in.width, in.y+1)
+	if layout.pages <= 1 {
+		return statusSegment{}, false
+	}
+	return plainSegment(in, 6, fmt.Sprintf("page:%d/%d", layout.page+1, layout.pages))
+}
+
+// statusToast shows the newest toast, with a count of the others queued.
+func statusToast(in statusInput) (statusSegment, bool) {
+	var live []toast
+	for _, t := range in.state.toasts {
+		if in.now.Before(t.until) {
+			live = append(live, t)
+		}
+	}
+	if len(live) == 0 {
+		return statusSegment{}, false
+	}
+	last := live[len(live)-1]
+	text := last.text
+	if last.severity == "error" {
+		text = "error: " + text
+	}
+	if len(live) > 1 {
+		text += fmt.Sprintf(" (+%d)", len(live)-1)
+	}
+	return statusSegment{priority: 9, shrink: true, parts: []statusPart{{text, in.theme.severityStyle(in.style, last.severity)}}}, true
+}
+
+// statusHelp shows the view settings and where to find the key help, or
+// the prompt of the active mode.
+func statusHelp(in statusInput) (statusSegment, bool) {
+	state := in.state
+	mouse := "off"
+	if state.mouseEnabled {
+		mouse = "on"
+		if state.passthrough {
+			mouse = "pass"
+		}
+	}
+	text := fmt.Sprintf("level:%s layout:%s theme:%s thumb:%s mouse:%s | ?:help q:quit", state.navLevel, currentLayout(state).name(), in.theme.name, state.thumbnail, mouse)
+	priority := 1
+	switch stateMode(state) {
+	case modeUpdate:
+		text, priority = fmt.Sprintf("update available %s | U update | I ignore 7 days | Ctrl+S dismiss", state.updateVersion), 8
+	case modeCompose:
+		text, priority = "compose (live): type to send | Enter newline | Ctrl+S exit", 8
+		if state.composeMarked {
+			text = fmt.Sprintf("compose to %d marked panes (live): type to send | Ctrl+S exit", len(markedKeys(state)))
+		}
+	case modeSelect:
+		text, priority = "select target: click or Tab/Shift+Tab | Enter send | Ctrl+S cancel", 8
+	case modeSendKey:
+		text, priority = "send key: press key to send | Ctrl+S cancel", 8
+	case modeCommand:
+		text, priority = "command: Enter run | Tab complete | Up/Down history | PgUp/PgDn scroll | Esc close", 8
+	}
+	return statusSegment{priority: priority, shrink: true, parts: []statusPart{{text, in.style}}}, true
+}
+
+// statusError shows the last refresh error for as long as it persists.
+func statusError(in statusInput) (statusSegment, bool) {
+	if in.state.lastErr == "" {
+		return statusSegment{}, false
+	}
+	return statusSegment{priority: 8, shrink: true, parts: []statusPart{{"error: " + in.state.lastErr, in.theme.severityStyle(in.style, "error")}}}, true
+}
+
+var healthMarks = map[string]string{"ok": "●", "backoff": "◐", "open": "✕", "half-open": "◑", "down": "○"}
+
+var healthSeverity = map[string]string{"backoff": "warn", "open": "error", "half-open": "warn", "down": "muted"}
+
+// statusHealth shows one mark per socket: ● ok, ◐ backing off, ✕ circuit
+// open, ◑ probing a half-open circuit, ○ no server.
+func statusHealth(in statusInput) (statusSegment, bool) {
+	records := in.state.health.snapshot()
+	if len(records) == 0 {
+		return statusSegment{}, false
+	}
+	seg := statusSegment{priority: 4}
+	for i, rec := range records {
+		text := rec.target.hint + healthMarks[rec.status()]
+		if i > 0 {
+			text = " " + text
+		}
+		seg.parts = append(seg.parts, statusPart{text, in.theme.severityStyle(in.style, healthSeverity[rec.status()])})
+	}
+	return seg, true
+}
+
+func statusInterval(in statusInput) (statusSegment, bool) {
+	interval := in.cfg.interval.String()
+	if in.state.schedule != nil {
+		interval = fmt.Sprintf("%s (%s..%s) rate:%.1f/s", in.cfg.interval, in.cfg.minInterval, in.cfg.maxInterval, in.state.schedule.rate())
+	}
+	return plainSegment(in, 3, "interval:"+interval)
+}
+
+func statusLines(in statusInput) (statusSegment, bool) {
+	return plainSegment(in, 2, fmt.Sprintf("lines:%d", in.cfg.lines))
+}
+
+func statusAllPanes(in statusInput) (statusSegment, bool) {
+	return plainSegment(in, 2, fmt.Sprintf("all-panes:%t", in.cfg.allPanes))
+}
+
+func statusLevel(in statusInput) (statusSegment, bool) {
+	return plainSegment(in, 5, fmt.Sprintf("level:%s", in.state.navLevel))
+}
+
+func statusClockSegment(in statusInput) (statusSegment, bool) {
+	return plainSegment(in, 2, in.now.Format("15:04:05"))
+}
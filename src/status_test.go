@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func stubStatusClock(t *testing.T, now time.Time) time.Time {
+	t.Helper()
+	orig := statusClock
+	t.Cleanup(func() { statusClock = orig })
+	statusClock = func() time.Time { return now }
+	return now
+}
+
+func TestStatusSegmentsShrinkAndDropByPriority(t *testing.T) {
+	stubStatusClock(t, time.Date(2026, 10, 16, 9, 5, 7, 0, time.Local))
+	cfg := config{lines: 500, statusLeft: "mode,entries", statusCenter: "help", statusRight: "lines,clock"}
+	state := appState{}
+
+	screen := newTextScreen(t, 90, 1)
+	drawStatus(screen, 90, 0, tcell.StyleDefault, state, cfg, 3)
+	row := readScreenRow(screen, 0, 90)
+	if !strings.HasPrefix(row, " NORMAL  | sessions:3 ") || !strings.HasSuffix(row, " lines:500 | 09:05:07") {
+		t.Fatalf("status = %q", row)
+	}
+	if !strings.Contains(row, "level:pane layout:grid") || !strings.HasSuffix(strings.TrimRight(row[:strings.Index(row, " lines:")], " "), "…") {
+		t.Fatalf("help not cut to fit between the sides: %q", row)
+	}
+
+	// Without room for the help at its minimum it goes, then the clock
+	// and lines (rightmost first on equal priority), while the mode stays.
+	screen = newTextScreen(t, 42, 1)
+	drawStatus(screen, 42, 0, tcell.StyleDefault, state, cfg, 3)
+	if row := readScreenRow(screen, 0, 42); row != " NORMAL  | sessions:3 lines:500 | 09:05:07" {
+		t.Fatalf("status = %q", row)
+	}
+	screen = newTextScreen(t, 30, 1)
+	drawStatus(screen, 30, 0, tcell.StyleDefault, state, cfg, 3)
+	if row := readScreenRow(screen, 0, 30); row != " NORMAL  | sessions:3         " {
+		t.Fatalf("narrow status = %q", row)
+	}
+}
+
+func TestToastsKeepModeVisibleAndExpire(t *testing.T) {
+	now := stubStatusClock(t, time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local))
+	state := appState{composeActive: true}
+	showToast(&state, "warn", "first")
+	showToast(&state, "error", "send failed")
+
+	screen := newTextScreen(t, 80, 1)
+	drawStatus(screen, 80, 0, tcell.StyleDefault, state, config{}, 1)
+	row := readScreenRow(screen, 0, 80)
+	if !strings.HasPrefix(row, " COMPOSE ") || !strings.Contains(row, "error: send failed (+1)") {
+		t.Fatalf("status = %q", row)
+	}
+
+	if expireToasts(&state, now.Add(toastDuration-time.Second)) {
+		t.Fatalf("toasts expired early")
+	}
+	if !expireToasts(&state, now.Add(toastDuration)) || len(state.toasts) != 0 {
+		t.Fatalf("toasts = %+v, want all expired", state.toasts)
+	}
+	drawStatus(screen, 80, 0, tcell.StyleDefault, state, config{}, 1)
+	if row := readScreenRow(screen, 0, 80); strings.Contains(row, "send failed") || !strings.Contains(row, "compose (live)") {
+		t.Fatalf("status after expiry = %q", row)
+	}
+
+	for i := 0; i < maxToasts+3; i++ {
+		showToast(&state, "", "note")
+	}
+	if len(state.toasts) != maxToasts {
+		t.Fatalf("queued %d toasts, want %d", len(state.toasts), maxToasts)
+	}
+}
+
+func TestStatusHealthAndPersistentError(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local)
+	stubStatusClock(t, now)
+	health := newHealthTracker()
+	health.success(socketTarget{key: "a", hint: "default"}, 2, now)
+	health.failure(socketTarget{key: "b", hint: "work"}, errors.New("context deadline exceeded"), now)
+	health.failure(socketTarget{key: "c", hint: "old"}, errors.New("no server running on /tmp/old.sock"), now)
+	state := appState{health: health, lastErr: "partial socket failures", socketCount: 3}
+	showToast(&state, "", "theme: midnight")
+
+	screen := newTextScreen(t, 120, 1)
+	drawStatus(screen, 120, 0, tcell.StyleDefault, state, config{statusLeft: "mode,sockets", statusCenter: "toast", statusRight: "error,health"}, 3)
+	row := readScreenRow(screen, 0, 120)
+	for _, want := range []string{"sockets:3 (1 failing)", "theme: midnight", "error: partial socket failures | default● old○ work◐"} {
+		if !strings.Contains(row, want) {
+			t.Fatalf("status = %q, missing %q", row, want)
+		}
+	}
+	if !strings.HasSuffix(row, "work◐") {
+		t.Fatalf("right segments not right-aligned: %q", row)
+	}
+}
+
+func TestParseStatusSegments(t *testing.T) {
+	names, err := parseStatusSegments(" mode, clock ,,help")
+	if err != nil || strings.Join(names, " ") != "mode clock help" {
+		t.Fatalf("parseStatusSegments = %q, %v", names, err)
+	}
+	if _, err := parseStatusSegments("mode,weather"); err == nil || !strings.Contains(err.Error(), `unknown status segment "weather"`) {
+		t.Fatalf("unknown segment error = %v", err)
+	}
+	if !statusUsesClock(config{}) || statusUsesClock(config{statusLeft: "mode"}) {
+		t.Fatalf("statusUsesClock did not follow the layout")
+	}
+}
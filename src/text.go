@@ -0,0 +1,65 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/uniseg"
+)
+
+// textWidth is the number of terminal cells s occupies.
+func textWidth(s string) int {
+	return uniseg.StringWidth(s)
+}
+
+// runeWidth is the number of cells a single rune occupies: 0 for combining
+// marks, 2 for wide East Asian characters and emoji.
+func runeWidth(r rune) int {
+	if r >= 0x20 && r < 0x300 {
+		return 1
+	}
+	return uniseg.StringWidth(string(r))
+}
+
+// truncateWidth cuts s to at most width cells without splitting a
+// grapheme cluster.
+func truncateWidth(s string, width int) string {
+	state := -1
+	used := 0
+	rest := s
+	for rest != "" {
+		var cluster string
+		var w int
+		cluster, rest, w, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		if used+w > width {
+			return s[:len(s)-len(rest)-len(cluster)]
+		}
+		used += w
+	}
+	return s
+}
+
+// drawGraphemes draws text into columns [col, width) of the row starting at
+// x, one grapheme cluster per cell or two for wide ones. It returns the
+// column after the last cluster drawn and the text left over when the
+// field filled up; a wide cluster that would cross the edge is left over.
+// Zero-width clusters and invalid bytes are dropped.
+func drawGraphemes(screen tcell.Screen, x, y, col, width int, text string, style tcell.Style) (int, string) {
+	state := -1
+	for text != "" && col < width {
+		cluster, rest, w, newState := uniseg.FirstGraphemeClusterInString(text, state)
+		if col+w > width {
+			break
+		}
+		text, state = rest, newState
+		if w == 0 {
+			continue
+		}
+		if r, size := utf8.DecodeRuneInString(cluster); r == utf8.RuneError && size == 1 {
+			continue
+		}
+		screen.Put(x+col, y, cluster, style)
+		col += w
+	}
+	return col, text
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func newTextScreen(t *testing.T, width, height int) tcell.SimulationScreen {
+	t.Helper()
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	t.Cleanup(screen.Fini)
+	screen.SetSize(width, height)
+	return screen
+}
+
+// screenCells returns the cluster drawn at each column of row y; the right
+// half of a wide cluster reads as "".
+func screenCells(screen tcell.SimulationScreen, y, width int) []string {
+	cells := make([]string, 0, width)
+	for x := 0; x < width; x++ {
+		str, _, w := screen.Get(x, y)
+		cells = append(cells, str)
+		if w == 2 && x+1 < width {
+			cells = append(cells, "")
+			x++
+		}
+	}
+	return cells
+}
+
+func TestDrawTextSegmentsGraphemesByWidth(t *testing.T) {
+	screen := newTextScreen(t, 8, 3)
+	drawText(screen, 0, 0, 6, "日本語x", tcell.StyleDefault)
+	if got, want := screenCells(screen, 0, 8), []string{"日", "", "本", "", "語", "", " ", " "}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wide text = %q, want %q", got, want)
+	}
+
+	// A wide character that would cross the edge is replaced by padding.
+	drawText(screen, 0, 1, 5, "ab日本", tcell.StyleDefault)
+	if got, want := screenCells(screen, 1, 6), []string{"a", "b", "日", "", " ", " "}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("truncated text = %q, want %q", got, want)
+	}
+
+	drawText(screen, 0, 2, 4, "é👍🏽!", tcell.StyleDefault)
+	if got, want := screenCells(screen, 2, 4), []string{"é", "👍🏽", "", "!"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("clusters = %q, want %q", got, want)
+	}
+}
+
+func TestDrawAnsiTextKeepsColumnsWithWideText(t *testing.T) {
+	screen := newTextScreen(t, 10, 1)
+	drawAnsiText(screen, 0, 0, 7, "\x1b[31m中\x1b[0mé\tz", tcell.StyleDefault)
+	if got, want := screenCells(screen, 0, 8), []string{"中", "", "é", " ", "z", " ", " ", " "}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("cells = %q, want %q", got, want)
+	}
+	if _, style, _ := screen.Get(0, 0); style != tcell.StyleDefault.Foreground(tcell.ColorMaroon) {
+		t.Fatalf("SGR colour lost on wide cell: %v", style)
+	}
+	if w := ansiVisibleWidth("\x1b[1m中文\x1b[0mab"); w != 6 {
+		t.Fatalf("ansiVisibleWidth = %d", w)
+	}
+	if s := truncateWidth("ab中文", 4); s != "ab中" {
+		t.Fatalf("truncateWidth = %q", s)
+	}
+}
+
+func TestDrawCellBorderSurvivesWideContent(t *testing.T) {
+	screen := newTextScreen(t, 11, 5)
+	sess := sessionView{name: "日本", lines: []string{"漢字漢字漢字漢字"}}
+	drawCell(screen, 0, 0, 11, 5, sess, borderSets[0], tcell.StyleDefault, tcell.StyleDefault, tcell.StyleDefault, 0, true, thumbOff)
+	for y := 1; y < 4; y++ {
+		if str, _, _ := screen.Get(10, y); str != "|" {
+			t.Fatalf("right border on row %d = %q", y, str)
+		}
+	}
+	if got := screenCells(screen, 2, 11); got[8] != "" || got[9] != " " {
+		t.Fatalf("content row = %q", got)
+	}
+}
+
+func TestDrawStatusHandlesMultibyteLabels(t *testing.T) {
+	screen := newTextScreen(t, 24, 1)
+	drawStatus(screen, 24, 0, tcell.StyleDefault, appState{lastErr: "pane «日本» gone"}, config{}, 1)
+	// The error is cut to fit beside the mode; 日 would cross the cut and
+	// is dropped whole.
+	if got := screenCells(screen, 0, 24); got[1] != "N" || got[22] != "«" || got[23] != "…" {
+		t.Fatalf("status cells = %q", got)
+	}
+}
+
+func TestVTermWideAndCombiningCharacters(t *testing.T) {
+	term := newVTerm(5, 2, 0)
+	term.write("a中e\u0301b")
+	grid := term.snapshot()
+	if got := vtText(grid); !reflect.DeepEqual(got, []string{"a中e\u0301b"}) {
+		t.Fatalf("grid = %q", got)
+	}
+	if term.cx != 4 || !term.wrapNext {
+		t.Fatalf("cursor = %d (wrap %t)", term.cx, term.wrapNext)
+	}
+
+	// A wide character at the last column wraps before printing.
+	term = newVTerm(3, 2, 0)
+	term.write("ab中")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"ab", "中"}) {
+		t.Fatalf("wrapped grid = %q", got)
+	}
+	if got := vtRowString(term.snapshot().rows[1]); got != "中" {
+		t.Fatalf("row string = %q", got)
+	}
+
+	// Overwriting the right half of a wide character blanks its left half.
+	term.write("\x1b[2;2Hx")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"ab", " x"}) {
+		t.Fatalf("after overwrite = %q", got)
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// borderGlyphs is the set of runes boxes and window separators are drawn
+// with. Tees are named after the side the stem points away from: teeLeft is
+// ├, joining a vertical line to one running right.
+type borderGlyphs struct {
+	name                                 string
+	h, v                                 rune
+	tl, tr, bl, br                       rune
+	teeLeft, teeRight, teeTop, teeBottom rune
+	cross                                rune
+}
+
+var borderSets = []borderGlyphs{
+	{name: "ascii", h: '-', v: '|', tl: '+', tr: '+', bl: '+', br: '+', teeLeft: '+', teeRight: '+', teeTop: '+', teeBottom: '+', cross: '+'},
+	{name: "single", h: '─', v: '│', tl: '┌', tr: '┐', bl: '└', br: '┘', teeLeft: '├', teeRight: '┤', teeTop: '┬', teeBottom: '┴', cross: '┼'},
+	{name: "rounded", h: '─', v: '│', tl: '╭', tr: '╮', bl: '╰', br: '╯', teeLeft: '├', teeRight: '┤', teeTop: '┬', teeBottom: '┴', cross: '┼'},
+	{name: "double", h: '═', v: '║', tl: '╔', tr: '╗', bl: '╚', br: '╝', teeLeft: '╠', teeRight: '╣', teeTop: '╦', teeBottom: '╩', cross: '╬'},
+	{name: "heavy", h: '━', v: '┃', tl: '┏', tr: '┓', bl: '┗', br: '┛', teeLeft: '┣', teeRight: '┫', teeTop: '┳', teeBottom: '┻', cross: '╋'},
+}
+
+func bordersByName(name string) (borderGlyphs, error) {
+	names := make([]string, 0, len(borderSets))
+	for _, set := range borderSets {
+		if set.name == name {
+			return set, nil
+		}
+		names = append(names, set.name)
+	}
+	return borderGlyphs{}, fmt.Errorf("unknown border set %q (want one of %s)", name, strings.Join(names, ", "))
+}
+
+// joint picks the separator rune for a cell from which of its four
+// neighbours are separators too.
+func (b borderGlyphs) joint(left, right, up, down bool) rune {
+	switch {
+	case left && right && up && down:
+		return b.cross
+	case right && up && down:
+		return b.teeLeft
+	case left && up && down:
+		return b.teeRight
+	case left && right && down:
+		return b.teeTop
+	case left && right && up:
+		return b.teeBottom
+	case right && down:
+		return b.tl
+	case left && down:
+		return b.tr
+	case right && up:
+		return b.bl
+	case left && up:
+		return b.br
+	case left || right:
+		return b.h
+	default:
+		return b.v
+	}
+}
+
+// focusMode is the input mode the focus colour reflects.
+type focusMode int
+
+const (
+	modeNormal focusMode = iota
+	modeUpdate
+	modeCompose
+	modeSelect
+	modeSendKey
+	modeCommand
+	focusModeCount
+)
+
+func stateMode(state appState) focusMode {
+	switch {
+	case state.updatePrompt:
+		return modeUpdate
+	case state.commandActive:
+		return modeCommand
+	case state.composeActive:
+		return modeCompose
+	case state.selectTarget:
+		return modeSelect
+	case state.sendKeyActive:
+		return modeSendKey
+	}
+	return modeNormal
+}
+
+// theme holds the border glyphs and colours everything on screen is drawn
+// with. A monochrome theme ignores its colours and marks focus, headers and
+// the status bar with attributes only.
+type theme struct {
+	name    string
+	borders borderGlyphs
+	mono    bool
+
+	fg, bg             tcell.Color
+	head               tcell.Color
+	statusFg, statusBg tcell.Color
+	// focus is the focus border and header colour per mode; focusText is
+	// the header text drawn on it.
+	focus     [focusModeCount]tcell.Color
+	focusText tcell.Color
+
+	overlayFg, overlayBg         tcell.Color
+	overlayHeadFg, overlayHeadBg tcell.Color
+	warn, alert, muted           tcell.Color
+}
+
+func (t theme) bodyStyle() tcell.Style {
+	if t.mono {
+		return tcell.StyleDefault
+	}
+	return tcell.StyleDefault.Foreground(t.fg).Background(t.bg)
+}
+
+func (t theme) headStyle() tcell.Style {
+	if t.mono {
+		return tcell.StyleDefault.Bold(true)
+	}
+	return tcell.StyleDefault.Foreground(t.head).Background(t.bg).Bold(true)
+}
+
+func (t theme) statusStyle() tcell.Style {
+	if t.mono {
+		return tcell.StyleDefault.Reverse(true)
+	}
+	return tcell.StyleDefault.Foreground(t.statusFg).Background(t.statusBg)
+}
+
+// focusStyles returns the header and border styles of the focused cell in
+// mode.
+func (t theme) focusStyles(mode focusMode) (tcell.Style, tcell.Style) {
+	if t.mono {
+		return tcell.StyleDefault.Reverse(true).Bold(true), tcell.StyleDefault.Bold(true)
+	}
+	head := tcell.StyleDefault.Foreground(t.focusText).Background(t.focus[mode]).Bold(true)
+	border := tcell.StyleDefault.Foreground(t.focus[mode]).Background(t.bg)
+	return head, border
+}
+
+// bannerStyle is the one-line overlay shown while in mode, drawn in the
+// mode's focus colour.
+func (t theme) bannerStyle(mode focusMode) tcell.Style {
+	if t.mono {
+		return tcell.StyleDefault.Reverse(true)
+	}
+	return tcell.StyleDefault.Foreground(t.focusText).Background(t.focus[mode])
+}
+
+func (t theme) overlayStyle() tcell.Style {
+	if t.mono {
+		return tcell.StyleDefault
+	}
+	return tcell.StyleDefault.Foreground(t.overlayFg).Background(t.overlayBg)
+}
+
+func (t theme) overlayHeadStyle() tcell.Style {
+	if t.mono {
+		return tcell.StyleDefault.Reverse(true).Bold(true)
+	}
+	return tcell.StyleDefault.Foreground(t.overlayHeadFg).Background(t.overlayHeadBg).Bold(true)
+}
+
+// severityStyle recolours base for a warning, an error or muted text.
+func (t theme) severityStyle(base tcell.Style, severity string) tcell.Style {
+	if t.mono {
+		switch severity {
+		case "warn":
+			return base.Bold(true)
+		case "error":
+			return base.Bold(true).Underline(true)
+		case "muted":
+			return base.Dim(true)
+		}
+		return base
+	}
+	switch severity {
+	case "warn":
+		return base.Foreground(t.warn)
+	case "error":
+		return base.Foreground(t.alert)
+	case "muted":
+		return base.Foreground(t.muted)
+	}
+	return base
+}
+
+// builtinThemes ships with the binary; the first is the default and keeps
+// the original ASCII look.
+var builtinThemes = []theme{
+	{
+		name:          "classic",
+		borders:       borderSets[0],
+		fg:            tcell.ColorWhite,
+		bg:            tcell.ColorBlack,
+		head:          tcell.ColorYellow,
+		statusFg:      tcell.ColorBlack,
+		statusBg:      tcell.ColorLightGray,
+		focus:         [focusModeCount]tcell.Color{tcell.ColorYellow, tcell.ColorLightCyan, tcell.ColorLightGreen, tcell.ColorRed, tcell.ColorFuchsia, tcell.ColorOrange},
+		focusText:     tcell.ColorBlack,
+		overlayFg:     tcell.ColorWhite,
+		overlayBg:     tcell.ColorDarkSlateGray,
+		overlayHeadFg: tcell.ColorBlack,
+		overlayHeadBg: tcell.ColorLightGray,
+		warn:          tcell.ColorYellow,
+		alert:         tcell.ColorRed,
+		muted:         tcell.ColorGray,
+	},
+	{
+		name:          "modern",
+		borders:       borderSets[2],
+		fg:            tcell.ColorReset,
+		bg:            tcell.ColorReset,
+		head:          tcell.ColorSkyblue,
+		statusFg:      tcell.ColorWhite,
+		statusBg:      tcell.ColorSteelBlue,
+		focus:         [focusModeCount]tcell.Color{tcell.ColorDeepSkyBlue, tcell.ColorAquaMarine, tcell.ColorLimeGreen, tcell.ColorTomato, tcell.ColorOrchid, tcell.ColorSandyBrown},
+		focusText:     tcell.ColorBlack,
+		overlayFg:     tcell.ColorWhite,
+		overlayBg:     tcell.ColorDarkSlateBlue,
+		overlayHeadFg: tcell.ColorBlack,
+		overlayHeadBg: tcell.ColorSkyblue,
+		warn:          tcell.ColorGold,
+		alert:         tcell.ColorTomato,
+		muted:         tcell.ColorSlateGray,
+	},
+	{
+		name:          "midnight",
+		borders:       borderSets[3],
+		fg:            tcell.ColorLightSteelBlue,
+		bg:            tcell.ColorMidnightBlue,
+		head:          tcell.ColorGold,
+		statusFg:      tcell.ColorMidnightBlue,
+		statusBg:      tcell.ColorLightSteelBlue,
+		focus:         [focusModeCount]tcell.Color{tcell.ColorGold, tcell.ColorTurquoise, tcell.ColorPaleGreen, tcell.ColorOrangeRed, tcell.ColorViolet, tcell.ColorLightSalmon},
+		focusText:     tcell.ColorMidnightBlue,
+		overlayFg:     tcell.ColorWhite,
+		overlayBg:     tcell.ColorNavy,
+		overlayHeadFg: tcell.ColorNavy,
+		overlayHeadBg: tcell.ColorGold,
+		warn:          tcell.ColorGold,
+		alert:         tcell.ColorOrangeRed,
+		muted:         tcell.ColorSlateGray,
+	},
+	{
+		name:          "contrast",
+		borders:       borderSets[4],
+		fg:            tcell.ColorWhite,
+		bg:            tcell.ColorBlack,
+		head:          tcell.ColorWhite,
+		statusFg:      tcell.ColorBlack,
+		statusBg:      tcell.ColorWhite,
+		focus:         [focusModeCount]tcell.Color{tcell.ColorYellow, tcell.ColorAqua, tcell.ColorLime, tcell.ColorRed, tcell.ColorFuchsia, tcell.ColorOrange},
+		focusText:     tcell.ColorBlack,
+		overlayFg:     tcell.ColorWhite,
+		overlayBg:     tcell.ColorBlack,
+		overlayHeadFg: tcell.ColorBlack,
+		overlayHeadBg: tcell.ColorWhite,
+		warn:          tcell.ColorYellow,
+		alert:         tcell.ColorRed,
+		muted:         tcell.ColorSilver,
+	},
+	{
+		name:    "mono",
+		borders: borderSets[1],
+		mono:    true,
+	},
+}
+
+// themeSpec is one entry of the user theme file. Colours are tcell colour
+// names or #rrggbb; anything unset is taken from the base theme.
+type themeSpec struct {
+	Name    string            `json:"name"`
+	Base    string            `json:"base"`
+	Borders string            `json:"borders"`
+	Mono    bool              `json:"mono"`
+	Colors  map[string]string `json:"colors"`
+}
+
+type themeFile struct {
+	Themes []themeSpec `json:"themes"`
+}
+
+// themeColors maps theme file colour keys to the field they set.
+var themeColors = map[string]func(*theme) *tcell.Color{
+	"fg":              func(t *theme) *tcell.Color { return &t.fg },
+	"bg":              func(t *theme) *tcell.Color { return &t.bg },
+	"head":            func(t *theme) *tcell.Color { return &t.head },
+	"status_fg":       func(t *theme) *tcell.Color { return &t.statusFg },
+	"status_bg":       func(t *theme) *tcell.Color { return &t.statusBg },
+	"focus":           func(t *theme) *tcell.Color { return &t.focus[modeNormal] },
+	"focus_update":    func(t *theme) *tcell.Color { return &t.focus[modeUpdate] },
+	"focus_compose":   func(t *theme) *tcell.Color { return &t.focus[modeCompose] },
+	"focus_select":    func(t *theme) *tcell.Color { return &t.focus[modeSelect] },
+	"focus_send_key":  func(t *theme) *tcell.Color { return &t.focus[modeSendKey] },
+	"focus_command":   func(t *theme) *tcell.Color { return &t.focus[modeCommand] },
+	"focus_text":      func(t *theme) *tcell.Color { return &t.focusText },
+	"overlay_fg":      func(t *theme) *tcell.Color { return &t.overlayFg },
+	"overlay_bg":      func(t *theme) *tcell.Color { return &t.overlayBg },
+	"overlay_head_fg": func(t *theme) *tcell.Color { return &t.overlayHeadFg },
+	"overlay_head_bg": func(t *theme) *tcell.Color { return &t.overlayHeadBg },
+	"warn":            func(t *theme) *tcell.Color { return &t.warn },
+	"error":           func(t *theme) *tcell.Color { return &t.alert },
+	"muted":           func(t *theme) *tcell.Color { return &t.muted },
+}
+
+func parseColor(s string) (tcell.Color, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "default" {
+		return tcell.ColorReset, nil
+	}
+	c := tcell.GetColor(name)
+	if c == tcell.ColorDefault {
+		return c, fmt.Errorf("unknown colour %q", s)
+	}
+	return c, nil
+}
+
+// build turns a spec into a theme on top of its base, one of known.
+func (s themeSpec) build(known []theme) (theme, error) {
+	if s.Name == "" {
+		return theme{}, errors.New("theme without a name")
+	}
+	base := known[0]
+	if s.Base != "" {
+		var err error
+		if base, err = themeByName(known, s.Base); err != nil {
+			return theme{}, fmt.Errorf("theme %q: %w", s.Name, err)
+		}
+	}
+	t := base
+	t.name = s.Name
+	t.mono = base.mono || s.Mono
+	if s.Borders != "" {
+		borders, err := bordersByName(s.Borders)
+		if err != nil {
+			return theme{}, fmt.Errorf("theme %q: %w", s.Name, err)
+		}
+		t.borders = borders
+	}
+	keys := make([]string, 0, len(s.Colors))
+	for key := range s.Colors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := themeColors[key]
+		if !ok {
+			return theme{}, fmt.Errorf("theme %q: unknown colour key %q", s.Name, key)
+		}
+		c, err := parseColor(s.Colors[key])
+		if err != nil {
+			return theme{}, fmt.Errorf("theme %q: %s: %w", s.Name, key, err)
+		}
+		*field(&t) = c
+	}
+	return t, nil
+}
+
+func themeByName(themes []theme, name string) (theme, error) {
+	names := make([]string, 0, len(themes))
+	for _, t := range themes {
+		if t.name == name {
+			return t, nil
+		}
+		names = append(names, t.name)
+	}
+	return theme{}, fmt.Errorf("unknown theme %q (want one of %s)", name, strings.Join(names, ", "))
+}
+
+// configFilePath is the path of name in the visualiser's user config
+// directory.
+func configFilePath(name string) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		home, hErr := os.UserHomeDir()
+		if hErr != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "tmux-visualiser", name), nil
+}
+
+// loadThemes returns the built-in themes followed by those in path. An empty
+// path reads the default theme file, which may be missing; a user theme
+// with a built-in's name replaces it. With noColor every theme is made
+// monochrome.
+func loadThemes(path string, noColor bool) ([]theme, error) {
+	themes := append([]theme(nil), builtinThemes...)
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = configFilePath("themes.json"); err != nil {
+			path = ""
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			var file themeFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("theme file %s: %w", path, err)
+			}
+			for _, spec := range file.Themes {
+				t, err := spec.build(themes)
+				if err != nil {
+					return nil, fmt.Errorf("theme file %s: %w", path, err)
+				}
+				themes = addTheme(themes, t)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("theme file: %w", err)
+		}
+	}
+	if noColor {
+		for i := range themes {
+			themes[i].mono = true
+		}
+	}
+	return themes, nil
+}
+
+func addTheme(themes []theme, t theme) []theme {
+	for i := range themes {
+		if themes[i].name == t.name {
+			themes[i] = t
+			return themes
+		}
+	}
+	return append(themes, t)
+}
+
+// noColorRequested reports whether NO_COLOR (https://no-color.org) is set
+// to a non-empty value.
+func noColorRequested() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// activeTheme is the theme state draws with, falling back to the default
+// built-in when none was loaded.
+func activeTheme(state appState) theme {
+	themes := state.themes
+	if len(themes) == 0 {
+		themes = builtinThemes
+	}
+	if t, err := themeByName(themes, state.theme); err == nil {
+		return t
+	}
+	return themes[0]
+}
+
+// nextTheme returns the name of the theme after the current one.
+func nextTheme(state appState) string {
+	themes := state.themes
+	if len(themes) == 0 {
+		themes = builtinThemes
+	}
+	current := activeTheme(state).name
+	for i, t := range themes {
+		if t.name == current {
+			return themes[(i+1)%len(themes)].name
+		}
+	}
+	return themes[0].name
+}
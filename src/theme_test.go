@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func writeThemeFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "themes.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatalf("write theme file: %v", err)
+	}
+	return path
+}
+
+func TestLoadThemesFromFile(t *testing.T) {
+	path := writeThemeFile(t, `{"themes": [
+		{"name": "solar", "base": "midnight", "borders": "rounded", "colors": {"bg": "#002b36", "focus": "orange", "status_bg": "default"}},
+		{"name": "classic", "borders": "single"}
+	]}`)
+	themes, err := loadThemes(path, false)
+	if err != nil {
+		t.Fatalf("loadThemes: %v", err)
+	}
+	if len(themes) != len(builtinThemes)+1 {
+		t.Fatalf("loaded %d themes", len(themes))
+	}
+	solar, err := themeByName(themes, "solar")
+	if err != nil {
+		t.Fatalf("solar: %v", err)
+	}
+	if solar.borders.name != "rounded" || solar.bg != tcell.NewHexColor(0x002b36) || solar.focus[modeNormal] != tcell.ColorOrange || solar.statusBg != tcell.ColorReset {
+		t.Fatalf("solar = %+v", solar)
+	}
+	if solar.head != tcell.ColorGold {
+		t.Fatalf("unset colour not taken from the base: %v", solar.head)
+	}
+	if classic, _ := themeByName(themes, "classic"); classic.borders.name != "single" || classic.fg != tcell.ColorWhite {
+		t.Fatalf("overridden classic = %+v", classic)
+	}
+
+	for body, want := range map[string]string{
+		`{"themes": [{"name": "x", "colors": {"glow": "red"}}]}`: `unknown colour key "glow"`,
+		`{"themes": [{"name": "x", "colors": {"fg": "nope"}}]}`:  `unknown colour "nope"`,
+		`{"themes": [{"name": "x", "borders": "dotted"}]}`:       `unknown border set "dotted"`,
+		`{"themes": [{"name": "x", "base": "solarized"}]}`:       `unknown theme "solarized"`,
+		`{"themes": [{"colors": {}}]}`:                           "theme without a name",
+	} {
+		if _, err := loadThemes(writeThemeFile(t, body), false); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("loadThemes(%s) error = %v, want %q", body, err, want)
+		}
+	}
+	if _, err := loadThemes(filepath.Join(t.TempDir(), "missing.json"), false); err == nil {
+		t.Fatalf("missing explicit theme file loaded")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if themes, err := loadThemes("", false); err != nil || len(themes) != len(builtinThemes) {
+		t.Fatalf("missing default theme file: %d themes, %v", len(themes), err)
+	}
+}
+
+func TestNoColorThemesAreMonochrome(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	themes, err := loadThemes("", true)
+	if err != nil {
+		t.Fatalf("loadThemes: %v", err)
+	}
+	for _, th := range themes {
+		if !th.mono {
+			t.Fatalf("theme %s kept its colours", th.name)
+		}
+	}
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(30, 8)
+	state := appState{
+		sessions: map[string]sessionView{"a": {key: "a", name: "alpha", lines: []string{"out"}}},
+		scroll:   map[string]int{},
+		follow:   map[string]bool{"a": true},
+		themes:   themes,
+		theme:    "midnight",
+	}
+	draw(screen, state, config{})
+
+	_, style, _ := screen.Get(1, 1)
+	fg, bg, attrs := style.Decompose()
+	if fg != tcell.ColorDefault || bg != tcell.ColorDefault || attrs&tcell.AttrReverse == 0 {
+		t.Fatalf("focused header style = %v %v %v", fg, bg, attrs)
+	}
+	if str, _, _ := screen.Get(0, 0); str != "╔" {
+		t.Fatalf("monochrome theme lost its borders: %q", str)
+	}
+}
+
+func TestThemeBordersDrawBoxesAndSeparators(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(22, 13)
+
+	pane := func(id, text string) sessionView {
+		return sessionView{key: "alpha|" + id, name: "alpha", paneID: id, windowIndex: 1, windowLayout: threePaneLayout, lines: []string{text}}
+	}
+	state := appState{
+		sessions: map[string]sessionView{
+			"alpha|%1": pane("%1", "left"),
+			"alpha|%2": pane("%2", "top"),
+			"alpha|%3": pane("%3", "bottom"),
+		},
+		scroll:       map[string]int{},
+		follow:       map[string]bool{},
+		windowLayout: true,
+		theme:        "midnight",
+	}
+	draw(screen, state, config{})
+
+	rows := []string{readScreenRow(screen, 0, 22), readScreenRow(screen, 5, 22), readScreenRow(screen, 11, 22)}
+	want := []string{"╔════════════════════╗", "║         ╠══════════║", "╚════════════════════╝"}
+	for i := range rows {
+		if rows[i] != want[i] {
+			t.Fatalf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+
+	name := ""
+	for range builtinThemes {
+		state.theme = nextTheme(state)
+		name += state.theme + " "
+	}
+	if name != "contrast mono classic modern midnight " {
+		t.Fatalf("theme cycle = %q", name)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// thumbnailMode selects how a pane larger than its cell is drawn: cropped,
+// or downsampled into half blocks or braille dots.
+type thumbnailMode int
+
+const (
+	thumbOff thumbnailMode = iota
+	thumbHalf
+	thumbBraille
+)
+
+var thumbnailNames = []string{"off", "half", "braille"}
+
+func (m thumbnailMode) String() string {
+	if int(m) < len(thumbnailNames) {
+		return thumbnailNames[m]
+	}
+	return thumbnailNames[0]
+}
+
+func thumbnailByName(name string) (thumbnailMode, error) {
+	for i, n := range thumbnailNames {
+		if n == name {
+			return thumbnailMode(i), nil
+		}
+	}
+	return thumbOff, fmt.Errorf("unknown thumbnail mode %q (want one of %s)", name, strings.Join(thumbnailNames, ", "))
+}
+
+func (m thumbnailMode) next() thumbnailMode {
+	return thumbnailMode((int(m) + 1) % len(thumbnailNames))
+}
+
+// thumbInkThreshold is the share of inked source cells at which a dot or
+// half block counts as set when drawing without colour.
+const thumbInkThreshold = 0.25
+
+// thumbRGB is a colour as 0-255 components.
+type thumbRGB struct{ r, g, b int32 }
+
+func (c thumbRGB) color() tcell.Color {
+	return tcell.NewRGBColor(c.r, c.g, c.b)
+}
+
+// thumbSource is a pane screen reduced to what a thumbnail needs: whether
+// each cell has ink and the colours it is drawn in.
+type thumbSource struct {
+	width, height int
+	ink           [][]bool
+	fg, bg        [][]thumbRGB
+}
+
+// thumbSample summarises a block of source cells.
+type thumbSample struct {
+	// ink is the share of cells with a visible character.
+	ink float64
+	// fg is the mean ink colour, bg the mean background colour and mixed
+	// the mean of each cell's dominant colour (ink if set, else
+	// background).
+	fg, bg, mixed thumbRGB
+}
+
+func newThumbSource(rows [][]vtCell, width int, bodyStyle tcell.Style) thumbSource {
+	baseFg, baseBg, _ := bodyStyle.Decompose()
+	defFg := rgbOf(baseFg, thumbRGB{0xc0, 0xc0, 0xc0})
+	defBg := rgbOf(baseBg, thumbRGB{})
+	src := thumbSource{width: width, height: len(rows)}
+	for _, row := range rows {
+		ink := make([]bool, width)
+		fg := make([]thumbRGB, width)
+		bg := make([]thumbRGB, width)
+		for x := 0; x < width; x++ {
+			fg[x], bg[x] = defFg, defBg
+			if x >= len(row) {
+				continue
+			}
+			cell := row[x]
+			cfg, cbg, attrs := cell.style.Decompose()
+			fg[x] = rgbOf(cfg, defFg)
+			bg[x] = rgbOf(cbg, defBg)
+			if attrs&tcell.AttrReverse != 0 {
+				fg[x], bg[x] = bg[x], fg[x]
+			}
+			// The right half of a wide character is inked too.
+			ink[x] = cell.ch != 0 && cell.ch != ' ' || x > 0 && row[x-1].wide
+		}
+		src.ink = append(src.ink, ink)
+		src.fg = append(src.fg, fg)
+		src.bg = append(src.bg, bg)
+	}
+	return src
+}
+
+func rgbOf(c tcell.Color, fallback thumbRGB) thumbRGB {
+	r, g, b := c.RGB()
+	if r < 0 {
+		return fallback
+	}
+	return thumbRGB{r, g, b}
+}
+
+// sample averages the source cells under the block [x0,x1)×[y0,y1).
+func (s thumbSource) sample(x0, y0, x1, y1 int) thumbSample {
+	var out thumbSample
+	var inked, total int
+	var fg, bg, mixed [3]int64
+	add := func(sum *[3]int64, c thumbRGB) {
+		sum[0] += int64(c.r)
+		sum[1] += int64(c.g)
+		sum[2] += int64(c.b)
+	}
+	for y := y0; y < y1 && y < s.height; y++ {
+		for x := x0; x < x1 && x < s.width; x++ {
+			total++
+			add(&bg, s.bg[y][x])
+			if s.ink[y][x] {
+				inked++
+				add(&fg, s.fg[y][x])
+				add(&mixed, s.fg[y][x])
+			} else {
+				add(&mixed, s.bg[y][x])
+			}
+		}
+	}
+	if total == 0 {
+		return out
+	}
+	mean := func(sum [3]int64, n int) thumbRGB {
+		if n == 0 {
+			return thumbRGB{}
+		}
+		return thumbRGB{int32(sum[0] / int64(n)), int32(sum[1] / int64(n)), int32(sum[2] / int64(n))}
+	}
+	out.ink = float64(inked) / float64(total)
+	out.fg = mean(fg, inked)
+	out.bg = mean(bg, total)
+	out.mixed = mean(mixed, total)
+	if inked == 0 {
+		out.fg = out.bg
+	}
+	return out
+}
+
+// span maps output position i of n onto the source range it covers, at
+// least one source cell wide.
+func span(i, n, size int) (int, int) {
+	from := i * size / n
+	to := (i + 1) * size / n
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
+
+// brailleDots are the dot bits of a braille cell, indexed [row][column].
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// drawThumbnail downsamples src into the top left of area. Half-block mode
+// gives every cell two vertically stacked pixels; braille mode gives it 2×4
+// dots. A pixel never covers less than one source cell, so a pane that is
+// only too wide or too tall is not stretched along the other axis. Without
+// colour (a monochrome body style) pixels are set by ink density alone.
+func drawThumbnail(screen tcell.Screen, area rect, src thumbSource, mode thumbnailMode, bodyStyle tcell.Style) {
+	dotsX, dotsY := 1, 2
+	if mode == thumbBraille {
+		dotsX, dotsY = 2, 4
+	}
+	w := minInt(area.x1-area.x0, (src.width+dotsX-1)/dotsX)
+	h := minInt(area.y1-area.y0, (src.height+dotsY-1)/dotsY)
+	if w <= 0 || h <= 0 || src.width <= 0 || src.height <= 0 {
+		return
+	}
+	baseFg, baseBg, _ := bodyStyle.Decompose()
+	color := baseFg != tcell.ColorDefault || baseBg != tcell.ColorDefault
+	for cy := 0; cy < h; cy++ {
+		for cx := 0; cx < w; cx++ {
+			x, y := area.x0+cx, area.y0+cy
+			if mode == thumbBraille {
+				var dots rune
+				for dy := 0; dy < 4; dy++ {
+					sy0, sy1 := span(cy*4+dy, h*4, src.height)
+					for dx := 0; dx < 2; dx++ {
+						sx0, sx1 := span(cx*2+dx, w*2, src.width)
+						if src.sample(sx0, sy0, sx1, sy1).ink >= thumbInkThreshold {
+							dots |= brailleDots[dy][dx]
+						}
+					}
+				}
+				style := bodyStyle
+				if color {
+					sx0, sx1 := span(cx, w, src.width)
+					sy0, sy1 := span(cy, h, src.height)
+					block := src.sample(sx0, sy0, sx1, sy1)
+					style = style.Foreground(block.fg.color()).Background(block.bg.color())
+				}
+				screen.SetContent(x, y, 0x2800+dots, nil, style)
+				continue
+			}
+
+			sx0, sx1 := span(cx, w, src.width)
+			ty0, ty1 := span(cy*2, h*2, src.height)
+			by0, by1 := span(cy*2+1, h*2, src.height)
+			top := src.sample(sx0, ty0, sx1, ty1)
+			bottom := src.sample(sx0, by0, sx1, by1)
+			if color {
+				screen.SetContent(x, y, '▀', nil, bodyStyle.Foreground(top.mixed.color()).Background(bottom.mixed.color()))
+				continue
+			}
+			ch := ' '
+			switch t, b := top.ink >= thumbInkThreshold, bottom.ink >= thumbInkThreshold; {
+			case t && b:
+				ch = '█'
+			case t:
+				ch = '▀'
+			case b:
+				ch = '▄'
+			}
+			screen.SetContent(x, y, ch, nil, bodyStyle)
+		}
+	}
+}
+
+// thumbnailRows returns the grid rows a thumbnail of sess shows, starting
+// at line start, and the pane width they span.
+func thumbnailRows(sess sessionView, start, rows int) ([][]vtCell, int) {
+	end := minInt(start+rows, len(sess.lines))
+	if start >= end {
+		return nil, 0
+	}
+	gridStart := len(sess.lines)
+	if sess.grid != nil {
+		gridStart -= len(sess.grid.rows)
+	}
+	if sess.grid != nil && start >= gridStart && gridStart >= 0 {
+		return sess.grid.rows[start-gridStart : end-gridStart], sess.grid.width
+	}
+	grid := gridFromScreen(sess.lines[start:end], sess.width, end-start, paneCursor{}, false)
+	return grid.rows, grid.width
+}
+
+// drawPaneThumbnail draws the pane's screen downsampled into area when it
+// does not fit, starting where the text view would. It reports false when
+// the pane fits and should be drawn as text.
+func drawPaneThumbnail(screen tcell.Screen, area rect, sess sessionView, bodyStyle tcell.Style, scrollTop int, follow bool, mode thumbnailMode) bool {
+	width := area.x1 - area.x0
+	height := area.y1 - area.y0
+	rows := maxInt(sess.height, sess.screenRows)
+	if rows <= 0 {
+		rows = len(sess.lines)
+	}
+	if sess.width > 0 && sess.width <= width && rows <= height {
+		return false
+	}
+	followStart, maxStart := scrollRange(sess, rows)
+	start := followStart
+	if !follow {
+		start = clampInt(scrollTop, 0, maxStart)
+	}
+	src, srcWidth := thumbnailRows(sess, start, rows)
+	if len(src) == 0 || srcWidth <= width && rows <= height {
+		return false
+	}
+	// Pad a short capture with blank rows so the thumbnail keeps the pane's
+	// shape; the full slice expression keeps append off the grid's rows.
+	if len(src) < rows {
+		src = append(src[:len(src):len(src)], make([][]vtCell, rows-len(src))...)
+	}
+	drawThumbnail(screen, area, newThumbSource(src, srcWidth, bodyStyle), mode, bodyStyle)
+	return true
+}
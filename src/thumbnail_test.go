@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func thumbPane(width int, lines ...string) sessionView {
+	return sessionView{key: "a", name: "a", lines: lines, screenRows: len(lines), width: width, height: len(lines)}
+}
+
+func TestThumbnailHalfBlocksWithoutColour(t *testing.T) {
+	screen := newTextScreen(t, 4, 2)
+	sess := thumbPane(8, "####    ", "####    ", "        ", "    ####")
+
+	if !drawPaneThumbnail(screen, rect{0, 0, 4, 2}, sess, tcell.StyleDefault, 0, true, thumbHalf) {
+		t.Fatalf("pane larger than its cell was not thumbnailed")
+	}
+	want := []string{"██  ", "  ▄▄"}
+	for y, w := range want {
+		if row := readScreenRow(screen, y, 4); row != w {
+			t.Fatalf("row %d = %q, want %q", y, row, w)
+		}
+	}
+}
+
+func TestThumbnailBrailleDots(t *testing.T) {
+	screen := newTextScreen(t, 2, 1)
+	sess := thumbPane(4, "#  #", " ## ", "    ", "####")
+
+	if !drawPaneThumbnail(screen, rect{0, 0, 2, 1}, sess, tcell.StyleDefault, 0, true, thumbBraille) {
+		t.Fatalf("pane larger than its cell was not thumbnailed")
+	}
+	if row := readScreenRow(screen, 0, 2); row != "⣑⣊" {
+		t.Fatalf("braille row = %q, want %q", row, "⣑⣊")
+	}
+}
+
+func TestThumbnailHalfBlocksUseCellColours(t *testing.T) {
+	screen := newTextScreen(t, 2, 1)
+	body := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorBlack)
+	sess := thumbPane(4, "\x1b[41m  \x1b[0m  ", "")
+
+	drawPaneThumbnail(screen, rect{0, 0, 2, 1}, sess, body, 0, true, thumbHalf)
+
+	str, style, _ := screen.Get(0, 0)
+	fg, bg, _ := style.Decompose()
+	r, g, b := tcell.ColorMaroon.RGB()
+	if str != "▀" || fg != tcell.NewRGBColor(r, g, b) || bg != tcell.NewRGBColor(0, 0, 0) {
+		t.Fatalf("cell = %q fg %v bg %v, want a red top over a black bottom", str, fg, bg)
+	}
+	_, style, _ = screen.Get(1, 0)
+	if fg, _, _ := style.Decompose(); fg != tcell.NewRGBColor(0, 0, 0) {
+		t.Fatalf("uncoloured half = %v, want the body background", fg)
+	}
+}
+
+func TestThumbnailOnlyWhenPaneDoesNotFit(t *testing.T) {
+	screen := newTextScreen(t, 20, 8)
+	body := tcell.StyleDefault
+	sess := thumbPane(6, "$ ls", "a b c")
+
+	if drawPaneThumbnail(screen, rect{0, 0, 10, 4}, sess, body, 0, true, thumbHalf) {
+		t.Fatalf("pane that fits its cell was thumbnailed")
+	}
+
+	sess = thumbPane(30, strings.Repeat("x", 30), strings.Repeat("y", 30))
+	drawCell(screen, 0, 0, 20, 8, sess, borderSets[0], body, body, body, 0, true, thumbHalf)
+	if row := readScreenRow(screen, 2, 20); row != "|"+strings.Repeat("█", 18)+"|" {
+		t.Fatalf("thumbnail row = %q", row)
+	}
+	if row := readScreenRow(screen, 3, 20); row != "|                  |" {
+		t.Fatalf("row below the pane shape = %q, want blank rather than a stretched pane", row)
+	}
+}
+
+func TestThumbnailModeNames(t *testing.T) {
+	mode, err := thumbnailByName("braille")
+	if err != nil || mode != thumbBraille {
+		t.Fatalf("thumbnailByName(braille) = %v, %v", mode, err)
+	}
+	if _, err := thumbnailByName("sixel"); err == nil || !strings.Contains(err.Error(), "off, half, braille") {
+		t.Fatalf("unknown mode error = %v", err)
+	}
+	names := ""
+	for m := thumbOff; ; {
+		m = m.next()
+		names += m.String() + " "
+		if m == thumbOff {
+			break
+		}
+	}
+	if names != "half braille off " {
+		t.Fatalf("mode cycle = %q", names)
+	}
+}
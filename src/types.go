@@ -5,6 +5,8 @@ import "time"
 type config struct {
 	lines                int
 	interval             time.Duration
+	minInterval          time.Duration
+	maxInterval          time.Duration
 	cmdTimeout           time.Duration
 	maxWorkers           int
 	statusHeight         int
@@ -13,6 +15,19 @@ type config struct {
 	includeLisaSockets   bool
 	socketGlob           string
 	explicitSockets      []string
+	controlMode          bool
+	windowLayout         bool
+	mousePassthrough     bool
+	layout               string
+	minCellWidth         int
+	minCellHeight        int
+	theme                string
+	themeFile            string
+	keysFile             string
+	thumbnail            string
+	statusLeft           string
+	statusCenter         string
+	statusRight          string
 }
 
 type sessionView struct {
@@ -23,6 +38,38 @@ type sessionView struct {
 	paneID     string
 	lines      []string
 	updated    time.Time
+
+	// width and height are the real pane size; zero when unknown.
+	width  int
+	height int
+
+	// mouse is the mouse reporting the application in the pane turned on.
+	mouse paneMouse
+
+	// Position in the socket → session → window → pane hierarchy.
+	windowIndex  int
+	windowName   string
+	windowLayout string
+	windowActive bool
+	paneIndex    int
+	paneActive   bool
+
+	// Incremental capture bookkeeping: the last screenRows entries of lines
+	// are the visible screen, everything above is history.
+	cursor       paneCursor
+	historySize  int
+	screenRows   int
+	contentHash  uint64
+	captureLimit int
+	capturedAt   time.Time
+
+	// grid holds the last screenRows lines as terminal cells when the pane
+	// was rendered through a vterm (streamed or full-screen panes).
+	grid *vtGrid
+
+	// polledAt is the refresh that last looked at this pane; views carried
+	// over because the pane was not due keep their old value.
+	polledAt time.Time
 }
 
 type socketTarget struct {
@@ -31,10 +78,37 @@ type socketTarget struct {
 	hint string
 }
 
+type paneCursor struct {
+	x       int
+	y       int
+	visible bool
+	valid   bool
+}
+
+type paneInfo struct {
+	sessionName  string
+	paneID       string
+	windowIndex  int
+	windowActive bool
+	paneActive   bool
+	cursor       paneCursor
+	historySize  int
+	historyLimit int
+	activity     int64
+	width        int
+	height       int
+	alternate    bool
+	mouse        paneMouse
+	windowLayout string
+	paneIndex    int
+	windowName   string
+}
+
 type sessionRef struct {
 	key    string
 	name   string
 	paneID string
+	pane   paneInfo
 	socket socketTarget
 }
 
@@ -54,5 +128,30 @@ type appState struct {
 	updatePrompt  bool
 	updateVersion string
 	composeBuf    []rune
+	composeMarked bool
+	pasting       bool
+	pasteBuf      []rune
+	marked        map[string]bool
 	mouseEnabled  bool
+	passthrough   bool
+	mouseGrab     mouseGrab
+	control       *controlManager
+	schedule      *refreshScheduler
+	health        *healthTracker
+	showSockets   bool
+	showHelp      bool
+	commandActive bool
+	command       commandPalette
+	keymap        keyMap
+	keyPending    keySeq
+	windowLayout  bool
+	navLevel      navLevel
+	layout        string
+	zoomed        bool
+	minCellWidth  int
+	minCellHeight int
+	theme         string
+	themes        []theme
+	thumbnail     thumbnailMode
+	toasts        []toast
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -21,10 +22,11 @@ func draw(screen tcell.Screen, state appState, cfg config) {
 	}
 	gridHeight := height - statusHeight
 
-	statusStyle := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorLightGray)
-	contentStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorBlack)
-	headStyle := tcell.StyleDefault.Foreground(tcell.ColorYellow).Background(tcell.ColorBlack).Bold(true)
-	focusHeadStyle, focusBorder := focusStyles(state)
+	th := activeTheme(state)
+	statusStyle := th.statusStyle()
+	contentStyle := th.bodyStyle()
+	headStyle := th.headStyle()
+	focusHeadStyle, focusBorder := th.focusStyles(stateMode(state))
 
 	sessionNames := orderedSessionNames(state)
 	sessions := make([]sessionView, 0, len(sessionNames))
@@ -40,32 +42,67 @@ func draw(screen tcell.Screen, state appState, cfg config) {
 
 	if state.serverDown {
 		drawCentered(screen, 0, 0, width, gridHeight, contentStyle, "tmux server not running")
+	} else if len(sessions) == 0 && state.lastRefresh.IsZero() {
+		drawCentered(screen, 0, 0, width, gridHeight, contentStyle, "loading tmux sessions...")
 	} else if len(sessions) == 0 {
 		drawCentered(screen, 0, 0, width, gridHeight, contentStyle, "no tmux sessions")
 	} else {
-		cols, rows := gridDims(len(sessions))
-		for i, sess := range sessions {
-			col := i % cols
-			row := i / cols
-			x0 := (width * col) / cols
-			x1 := (width * (col + 1)) / cols
-			y0 := (gridHeight * row) / rows
-			y1 := (gridHeight * (row + 1)) / rows
-			focused := i == state.focusIndex
+		current := focusedKey(state)
+		// Above pane level the whole focused window, session or socket
+		// gets the focus border.
+		inGroup := map[string]bool{current: true}
+		if state.navLevel != navPane {
+			groups := levelGroups(state.sessions, state.navLevel)
+			if idx := focusGroup(groups, current); idx >= 0 {
+				for _, key := range groups[idx] {
+					inGroup[key] = true
+				}
+			}
+		}
+		layout := layoutScreen(state, width, height)
+		drawTabBar(screen, layout, state, headStyle, focusHeadStyle)
+		for _, frame := range layout.frames {
+			if frame.cell.empty() {
+				continue
+			}
+			focused, grouped := false, false
+			for _, key := range frame.keys {
+				focused = focused || key == current
+				grouped = grouped || inGroup[key]
+			}
 			cellHead := headStyle
 			cellBorder := contentStyle
 			if focused {
 				cellHead = focusHeadStyle
+			}
+			if grouped {
 				cellBorder = focusBorder
 			}
-			drawCell(screen, x0, y0, x1, y1, sess, cellHead, contentStyle, cellBorder, state.scroll[sess.key], state.follow[sess.key])
+			if state.windowCells() {
+				drawWindowCell(screen, frame, state, current, cellHead, contentStyle, cellBorder, focusBorder)
+				continue
+			}
+			sess := state.sessions[frame.keys[0]]
+			c := frame.cell
+			drawCell(screen, c.x0, c.y0, c.x1, c.y1, sess, th.borders, cellHead, contentStyle, cellBorder, state.scroll[sess.key], state.follow[sess.key], state.thumbnail)
+			if state.marked[sess.key] {
+				drawMark(screen, c, th.severityStyle(cellBorder, "warn"))
+			}
 		}
 	}
 
 	if state.updatePrompt {
 		drawUpdateOverlay(screen, width, height, state)
+	} else if state.showSockets {
+		drawSocketOverlay(screen, width, height, state)
 	} else if state.selectTarget {
-		drawSelectOverlay(screen, width, height)
+		drawSelectOverlay(screen, width, height, state)
+	}
+	if state.commandActive {
+		drawCommandPalette(screen, width, height, state)
+	}
+	if state.showHelp {
+		drawHelpOverlay(screen, width, height, state)
 	}
 
 	if statusHeight == 1 {
@@ -75,15 +112,18 @@ func draw(screen tcell.Screen, state appState, cfg config) {
 	screen.Show()
 }
 
-func drawCell(screen tcell.Screen, x0, y0, x1, y1 int, sess sessionView, headStyle, bodyStyle, borderStyle tcell.Style, scrollTop int, follow bool) {
+func drawCell(screen tcell.Screen, x0, y0, x1, y1 int, sess sessionView, borders borderGlyphs, headStyle, bodyStyle, borderStyle tcell.Style, scrollTop int, follow bool, thumb thumbnailMode) {
 	w := x1 - x0
 	h := y1 - y0
 	if w <= 1 || h <= 1 {
 		return
 	}
-	drawBox(screen, x0, y0, x1, y1, borderStyle)
+	drawBox(screen, borders, x0, y0, x1, y1, borderStyle)
 
 	title := sess.name
+	if sess.paneID != "" {
+		title = paneTitle(sess)
+	}
 	if sess.socketHint != "" {
 		title = fmt.Sprintf("%s [%s]", title, sess.socketHint)
 	}
@@ -94,91 +134,274 @@ func drawCell(screen tcell.Screen, x0, y0, x1, y1 int, sess sessionView, headSty
 		drawText(screen, x0+1, y0+1, w-2, title, headStyle)
 	}
 
-	contentTop := y0 + 2
-	if h <= 3 {
-		contentTop = y0 + 1
+	drawPaneContent(screen, cellContentRect(rect{x0, y0, x1, y1}), sess, bodyStyle, scrollTop, follow, thumb)
+}
+
+// drawMark flags a cell holding a pane marked for synchronized typing with
+// a ● on its top border.
+func drawMark(screen tcell.Screen, c rect, style tcell.Style) {
+	if c.x1-c.x0 >= 5 {
+		drawText(screen, c.x0+1, c.y0, 3, " ● ", style)
 	}
-	contentHeight := y1 - 1 - contentTop
-	if contentHeight <= 0 {
+}
+
+// drawTabBar draws the tab strip of layouts that have one, highlighting the
+// focused entry's tab and marking tabs scrolled off either end with < and >.
+func drawTabBar(screen tcell.Screen, layout screenLayout, state appState, style, focusStyle tcell.Style) {
+	if layout.tabBar.empty() {
 		return
 	}
+	bar := layout.tabBar
+	drawText(screen, bar.x0, bar.y0, bar.x1-bar.x0, "", style)
+	for i, tab := range layout.tabs {
+		if tab.empty() {
+			continue
+		}
+		tabStyle := style
+		if i == layout.focus {
+			tabStyle = focusStyle
+		}
+		drawText(screen, tab.x0, tab.y0, tab.x1-tab.x0, " "+frameLabel(state, layout.frames[i].keys)+" ", tabStyle)
+	}
+	if layout.tabsBefore {
+		screen.SetContent(bar.x0, bar.y0, '<', nil, style)
+	}
+	if layout.tabsAfter {
+		screen.SetContent(bar.x1-1, bar.y0, '>', nil, style)
+	}
+}
 
-	start := 0
-	maxStart := 0
-	if len(sess.lines) > contentHeight {
-		maxStart = len(sess.lines) - contentHeight
+// drawWindowCell draws all panes of one tmux window in a single cell, placed
+// as in the window's layout with tmux-style separators between them. The
+// separators around the current pane use focusStyle.
+func drawWindowCell(screen tcell.Screen, frame cellFrame, state appState, current string, headStyle, bodyStyle, borderStyle, focusStyle tcell.Style) {
+	c := frame.cell
+	w := c.x1 - c.x0
+	h := c.y1 - c.y0
+	if w <= 1 || h <= 1 {
+		return
+	}
+	borders := activeTheme(state).borders
+	drawBox(screen, borders, c.x0, c.y0, c.x1, c.y1, borderStyle)
+
+	first := state.sessions[frame.keys[0]]
+	title := fmt.Sprintf("%s:%d", first.name, first.windowIndex)
+	if first.windowName != "" {
+		title += " " + first.windowName
+	}
+	if first.socketHint != "" {
+		title = fmt.Sprintf("%s [%s]", title, first.socketHint)
+	}
+	marked := 0
+	for _, key := range frame.keys {
+		if state.marked[key] {
+			marked++
+		}
 	}
-	if follow {
-		start = maxStart
+	if len(frame.keys) == 1 {
+		title += " (1 pane"
 	} else {
-		if scrollTop < 0 {
-			scrollTop = 0
+		title = fmt.Sprintf("%s (%d panes", title, len(frame.keys))
+	}
+	if marked > 0 {
+		title = fmt.Sprintf("%s, %d marked", title, marked)
+		drawMark(screen, c, activeTheme(state).severityStyle(borderStyle, "warn"))
+	}
+	title += ")"
+	if h > 2 {
+		drawText(screen, c.x0+1, c.y0+1, w-2, title, headStyle)
+	}
+
+	area := cellContentRect(c)
+	if area.empty() {
+		return
+	}
+	layout, placed, byPane := windowPanes(state, frame)
+	covered := make([]bool, (area.x1-area.x0)*(area.y1-area.y0))
+	var focusRect rect
+	for _, pane := range layout.panes {
+		r := placed[pane.id]
+		if r.empty() {
+			continue
 		}
-		if scrollTop > maxStart {
-			scrollTop = maxStart
+		for y := r.y0; y < r.y1; y++ {
+			for x := r.x0; x < r.x1; x++ {
+				covered[(y-area.y0)*(area.x1-area.x0)+x-area.x0] = true
+			}
+		}
+		key, ok := byPane[pane.id]
+		if !ok {
+			// A pane of the window that was not captured.
+			drawCentered(screen, r.x0, r.y0, r.x1-r.x0, r.y1-r.y0, bodyStyle, pane.id)
+			continue
+		}
+		if key == current {
+			focusRect = r
+		}
+		drawPaneContent(screen, r, state.sessions[key], bodyStyle, state.scroll[key], state.follow[key], state.thumbnail)
+	}
+
+	separator := func(x, y int) bool {
+		if !area.contains(x, y) {
+			return false
+		}
+		return !covered[(y-area.y0)*(area.x1-area.x0)+x-area.x0]
+	}
+	nearFocus := rect{x0: focusRect.x0 - 1, y0: focusRect.y0 - 1, x1: focusRect.x1 + 1, y1: focusRect.y1 + 1}
+	for y := area.y0; y < area.y1; y++ {
+		for x := area.x0; x < area.x1; x++ {
+			if !separator(x, y) {
+				continue
+			}
+			ch := borders.joint(separator(x-1, y), separator(x+1, y), separator(x, y-1), separator(x, y+1))
+			style := bodyStyle
+			if !focusRect.empty() && nearFocus.contains(x, y) {
+				style = focusStyle
+			}
+			screen.SetContent(x, y, ch, nil, style)
 		}
-		start = scrollTop
+	}
+}
+
+// drawPaneContent draws a view's lines and cursor into area, following the
+// pane or starting at scrollTop. With a thumbnail mode, a pane that does not
+// fit is drawn downsampled instead.
+func drawPaneContent(screen tcell.Screen, area rect, sess sessionView, bodyStyle tcell.Style, scrollTop int, follow bool, thumb thumbnailMode) {
+	if area.empty() {
+		return
+	}
+	if thumb != thumbOff && drawPaneThumbnail(screen, area, sess, bodyStyle, scrollTop, follow, thumb) {
+		return
+	}
+	contentHeight := area.y1 - area.y0
+	followStart, maxStart := scrollRange(sess, contentHeight)
+	start := followStart
+	if !follow {
+		start = clampInt(scrollTop, 0, maxStart)
+	}
+	width := area.x1 - area.x0
+	if sess.width > 0 && sess.width < width {
+		width = sess.width
+	}
+	gridStart := len(sess.lines)
+	if sess.grid != nil {
+		gridStart -= len(sess.grid.rows)
 	}
 	for row := 0; row < contentHeight; row++ {
 		lineIndex := start + row
 		if lineIndex >= len(sess.lines) {
 			break
 		}
-		drawAnsiText(screen, x0+1, contentTop+row, w-2, sess.lines[lineIndex], bodyStyle)
+		if lineIndex >= gridStart && gridStart >= 0 {
+			drawVTRow(screen, area.x0, area.y0+row, width, sess.grid.rows[lineIndex-gridStart], bodyStyle)
+			continue
+		}
+		drawAnsiText(screen, area.x0, area.y0+row, width, sess.lines[lineIndex], bodyStyle)
 	}
+
+	if pane, ok := paneScreen(sess); ok && pane.cursorVisible {
+		row := pane.cursorRow - start
+		if row >= 0 && row < contentHeight && pane.cursorCol < width {
+			x, y := area.x0+pane.cursorCol, area.y0+row
+			str, style, _ := screen.Get(x, y)
+			if style == tcell.StyleDefault {
+				// Nothing was drawn here; the pane is blank past its text.
+				style = bodyStyle
+			}
+			screen.Put(x, y, str, style.Reverse(true))
+		}
+	}
+}
+
+// paneLayout places a pane's visible screen within the view's lines: top is
+// the line index of the screen's first row, rows the pane height, and
+// cursorRow/cursorCol the cursor as a line index and column.
+type paneLayout struct {
+	top           int
+	rows          int
+	cursorRow     int
+	cursorCol     int
+	cursorVisible bool
 }
 
-func focusStyles(state appState) (tcell.Style, tcell.Style) {
-	modeColor := tcell.ColorYellow
-	switch {
-	case state.updatePrompt:
-		modeColor = tcell.ColorLightCyan
-	case state.composeActive:
-		modeColor = tcell.ColorLightGreen
-	case state.selectTarget:
-		modeColor = tcell.ColorRed
-	case state.sendKeyActive:
-		modeColor = tcell.ColorFuchsia
-	}
-	head := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(modeColor).Bold(true)
-	border := tcell.StyleDefault.Foreground(modeColor).Background(tcell.ColorBlack)
-	return head, border
+// paneScreen reports where the pane's screen sits in sess.lines. It is false
+// when the view does not know which lines are the screen, e.g. after an
+// error or an alternate-screen fallback capture.
+func paneScreen(sess sessionView) (paneLayout, bool) {
+	if sess.screenRows <= 0 || sess.screenRows > len(sess.lines) {
+		return paneLayout{}, false
+	}
+	pane := paneLayout{
+		top:  len(sess.lines) - sess.screenRows,
+		rows: maxInt(sess.height, sess.screenRows),
+	}
+	cursor := sess.cursor
+	if sess.grid != nil {
+		cursor = paneCursor{x: sess.grid.cursorX, y: sess.grid.cursorY, visible: sess.grid.cursorVisible, valid: true}
+	}
+	if cursor.valid && cursor.y >= 0 && cursor.y < pane.rows && cursor.x >= 0 {
+		pane.cursorRow = pane.top + cursor.y
+		pane.cursorCol = cursor.x
+		pane.cursorVisible = cursor.visible
+	} else {
+		pane.cursorRow = -1
+	}
+	return pane, true
 }
 
-func drawBox(screen tcell.Screen, x0, y0, x1, y1 int, style tcell.Style) {
+// scrollRange returns the first line shown while following the pane and the
+// largest scroll offset for a cell showing contentHeight lines. A cell tall
+// enough for the whole pane shows its screen anchored to the bottom, blank
+// rows included, like the real pane; a shorter cell ends at the last line or
+// the cursor row and always keeps the cursor in view.
+func scrollRange(sess sessionView, contentHeight int) (followStart, maxStart int) {
+	end := len(sess.lines)
+	cursorRow := -1
+	if pane, ok := paneScreen(sess); ok {
+		cursorRow = pane.cursorRow
+		if pane.rows <= contentHeight {
+			end = pane.top + pane.rows
+		} else {
+			end = maxInt(end, cursorRow+1)
+		}
+	}
+	maxStart = maxInt(0, end-contentHeight)
+	followStart = maxStart
+	if cursorRow >= 0 && cursorRow < followStart {
+		followStart = cursorRow
+	}
+	return followStart, maxStart
+}
+
+func drawBox(screen tcell.Screen, borders borderGlyphs, x0, y0, x1, y1 int, style tcell.Style) {
 	w := x1 - x0
 	h := y1 - y0
 	if w <= 1 || h <= 1 {
 		return
 	}
 	for x := x0; x < x1; x++ {
-		screen.SetContent(x, y0, '-', nil, style)
-		screen.SetContent(x, y1-1, '-', nil, style)
+		screen.SetContent(x, y0, borders.h, nil, style)
+		screen.SetContent(x, y1-1, borders.h, nil, style)
 	}
 	for y := y0; y < y1; y++ {
-		screen.SetContent(x0, y, '|', nil, style)
-		screen.SetContent(x1-1, y, '|', nil, style)
+		screen.SetContent(x0, y, borders.v, nil, style)
+		screen.SetContent(x1-1, y, borders.v, nil, style)
 	}
-	screen.SetContent(x0, y0, '+', nil, style)
-	screen.SetContent(x1-1, y0, '+', nil, style)
-	screen.SetContent(x0, y1-1, '+', nil, style)
-	screen.SetContent(x1-1, y1-1, '+', nil, style)
+	screen.SetContent(x0, y0, borders.tl, nil, style)
+	screen.SetContent(x1-1, y0, borders.tr, nil, style)
+	screen.SetContent(x0, y1-1, borders.bl, nil, style)
+	screen.SetContent(x1-1, y1-1, borders.br, nil, style)
 }
 
+// drawText draws text in a field width cells wide, truncated and padded by
+// display width.
 func drawText(screen tcell.Screen, x, y, width int, text string, style tcell.Style) {
 	if width <= 0 {
 		return
 	}
-	runes := []rune(text)
-	if len(runes) > width {
-		runes = runes[:width]
-	}
-	for i := 0; i < width; i++ {
-		ch := ' '
-		if i < len(runes) {
-			ch = runes[i]
-		}
-		screen.SetContent(x+i, y, ch, nil, style)
+	col, _ := drawGraphemes(screen, x, y, 0, width, text, style)
+	for ; col < width; col++ {
+		screen.SetContent(x+col, y, ' ', nil, style)
 	}
 }
 
@@ -187,53 +410,13 @@ func drawCentered(screen tcell.Screen, x0, y0, width, height int, style tcell.St
 		return
 	}
 	y := y0 + height/2
-	x := x0 + (width-len(text))/2
+	x := x0 + (width-textWidth(text))/2
 	if x < x0 {
 		x = x0
 	}
 	drawText(screen, x, y, width-(x-x0), text, style)
 }
 
-func drawStatus(screen tcell.Screen, width, y int, style tcell.Style, state appState, cfg config, sessionCount int) {
-	if y < 0 || width <= 0 {
-		return
-	}
-	mouseState := "off"
-	if state.mouseEnabled {
-		mouseState = "on"
-	}
-	entryLabel := "sessions"
-	if cfg.allPanes {
-		entryLabel = "panes"
-	}
-	prefix := fmt.Sprintf("sockets:%d | %s:%d | ", state.socketCount, entryLabel, sessionCount)
-	label := fmt.Sprintf("%slines:%d | interval:%s | all-panes:%t | tab:focus j/k:scroll enter:attach i:compose s:send-key Ctrl+K:kill [ ]:interval m:mouse(%s) q:quit", prefix, cfg.lines, cfg.interval, cfg.allPanes, mouseState)
-	if state.composeActive {
-		label = prefix + "compose (live): type to send | Enter newline | Ctrl+S exit"
-	}
-	if state.selectTarget {
-		label = prefix + "select target: click or Tab/Shift+Tab | Enter send | Ctrl+S cancel"
-	}
-	if state.updatePrompt {
-		label = fmt.Sprintf("%supdate available %s | U update | I ignore 7 days | Ctrl+S dismiss", prefix, state.updateVersion)
-	}
-	if state.sendKeyActive {
-		label = prefix + "send key: press key to send | Ctrl+S cancel"
-	}
-	if state.lastErr != "" {
-		label = fmt.Sprintf("%serror: %s", prefix, state.lastErr)
-	}
-	if len(label) < width {
-		label = label + strings.Repeat(" ", width-len(label))
-	}
-	if len(label) > width {
-		label = label[:width]
-	}
-	for i := 0; i < width; i++ {
-		screen.SetContent(i, y, rune(label[i]), nil, style)
-	}
-}
-
 func drawComposeOverlay(screen tcell.Screen, width, height int, state appState) {
 	statusHeight := 1
 	if height < 2 {
@@ -250,11 +433,12 @@ func drawComposeOverlay(screen tcell.Screen, width, height int, state appState)
 	y0 := maxBottom - overlayHeight
 	y1 := maxBottom
 
-	boxStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDarkSlateGray)
-	headStyle := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorLightGray).Bold(true)
-	textStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorDarkSlateGray)
+	th := activeTheme(state)
+	boxStyle := th.overlayStyle()
+	headStyle := th.overlayHeadStyle()
+	textStyle := th.overlayStyle()
 
-	drawBox(screen, 0, y0, width, y1, boxStyle)
+	drawBox(screen, th.borders, 0, y0, width, y1, boxStyle)
 	drawText(screen, 1, y0+1, width-2, "Compose (live): type to send | Enter newline | Ctrl+S exit", headStyle)
 
 	contentTop := y0 + 2
@@ -276,12 +460,13 @@ func drawComposeOverlay(screen tcell.Screen, width, height int, state appState)
 	}
 }
 
-func drawSelectOverlay(screen tcell.Screen, width, height int) {
+func drawSelectOverlay(screen tcell.Screen, width, height int, state appState) {
 	if width < 10 || height < 3 {
 		return
 	}
-	boxStyle := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow)
-	drawBox(screen, 0, 0, width, 3, boxStyle)
+	th := activeTheme(state)
+	boxStyle := th.bannerStyle(modeNormal)
+	drawBox(screen, th.borders, 0, 0, width, 3, boxStyle)
 	drawText(screen, 1, 1, width-2, "Select target: click or Tab/Shift+Tab | Enter send | Ctrl+S cancel", boxStyle)
 }
 
@@ -289,10 +474,108 @@ func drawUpdateOverlay(screen tcell.Screen, width, height int, state appState) {
 	if width < 10 || height < 5 {
 		return
 	}
-	boxStyle := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorLightCyan)
-	headStyle := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorLightCyan).Bold(true)
-	drawBox(screen, 0, 0, width, 4, boxStyle)
+	th := activeTheme(state)
+	boxStyle := th.bannerStyle(modeUpdate)
+	headStyle := boxStyle.Bold(true)
+	drawBox(screen, th.borders, 0, 0, width, 4, boxStyle)
 	drawText(screen, 1, 1, width-2, "Update available", headStyle)
 	msg := fmt.Sprintf("Latest: %s | U update | I ignore 7 days | Ctrl+S dismiss", state.updateVersion)
 	drawText(screen, 1, 2, width-2, msg, boxStyle)
 }
+
+// drawHelpOverlay lists the key bindings of the current mode in a centred
+// box, in as many columns as the height needs.
+func drawHelpOverlay(screen tcell.Screen, width, height int, state appState) {
+	statusHeight := 1
+	if height < 2 {
+		statusHeight = 0
+	}
+	maxBottom := height - statusHeight
+	if width < 20 || maxBottom < 5 {
+		return
+	}
+	entries := helpEntries(state)
+	keyWidth, lineWidth := 0, 0
+	for _, e := range entries {
+		keyWidth = maxInt(keyWidth, textWidth(e.keys))
+	}
+	keyWidth = minInt(keyWidth, 24)
+	for _, e := range entries {
+		lineWidth = maxInt(lineWidth, keyWidth+2+textWidth(e.desc))
+	}
+
+	const gap = 3
+	rows := maxBottom - 3
+	cols := (len(entries) + rows - 1) / rows
+	rows = (len(entries) + cols - 1) / cols
+	colWidth := minInt(lineWidth, (width-2-(cols-1)*gap)/cols)
+	boxWidth := cols*colWidth + (cols-1)*gap + 2
+	boxHeight := rows + 3
+	x0 := (width - boxWidth) / 2
+	y0 := (maxBottom - boxHeight) / 2
+
+	th := activeTheme(state)
+	boxStyle := th.overlayStyle()
+	headStyle := th.overlayHeadStyle()
+	keyStyle := boxStyle.Bold(true)
+	for y := y0 + 1; y < y0+boxHeight-1; y++ {
+		drawText(screen, x0+1, y, boxWidth-2, "", boxStyle)
+	}
+	drawBox(screen, th.borders, x0, y0, x0+boxWidth, y0+boxHeight, boxStyle)
+	names := make([]string, 0, 2)
+	for _, mode := range keyModes(state) {
+		names = append(names, strings.ToLower(modeNames[mode]))
+	}
+	drawText(screen, x0+1, y0+1, boxWidth-2, fmt.Sprintf("Keys: %s", strings.Join(names, " + ")), headStyle)
+	for i, e := range entries {
+		x := x0 + 1 + (i/rows)*(colWidth+gap)
+		y := y0 + 2 + i%rows
+		drawText(screen, x, y, minInt(keyWidth, colWidth), e.keys, keyStyle)
+		if rest := colWidth - keyWidth - 2; rest > 0 {
+			drawText(screen, x+keyWidth+2, y, rest, e.desc, boxStyle)
+		}
+	}
+}
+
+func drawSocketOverlay(screen tcell.Screen, width, height int, state appState) {
+	statusHeight := 1
+	if height < 2 {
+		statusHeight = 0
+	}
+	maxBottom := height - statusHeight
+	if width < 10 || maxBottom < 4 {
+		return
+	}
+	records := state.health.snapshot()
+	overlayHeight := minInt(len(records)+3, maxBottom)
+	if len(records) == 0 {
+		overlayHeight = minInt(4, maxBottom)
+	}
+
+	th := activeTheme(state)
+	boxStyle := th.overlayStyle()
+	headStyle := th.overlayHeadStyle()
+	drawBox(screen, th.borders, 0, 0, width, overlayHeight, boxStyle)
+	drawText(screen, 1, 1, width-2, fmt.Sprintf("Sockets (%d) | o close", len(records)), headStyle)
+	if len(records) == 0 {
+		drawText(screen, 1, 2, width-2, "no sockets queried yet", boxStyle)
+		return
+	}
+	now := time.Now()
+	for i, rec := range records {
+		y := 2 + i
+		if y >= overlayHeight-1 {
+			break
+		}
+		style := boxStyle
+		switch rec.status() {
+		case "backoff", "half-open":
+			style = th.severityStyle(style, "warn")
+		case "open":
+			style = th.severityStyle(style, "error")
+		case "down":
+			style = th.severityStyle(style, "muted")
+		}
+		drawText(screen, 1, y, width-2, rec.summary(now), style)
+	}
+}
@@ -13,8 +13,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/gdamore/tcell/v2"
 )
 
 type updateResult struct {
@@ -27,39 +25,6 @@ type updatePrefs struct {
 	IgnoreUntil time.Time `json:"ignore_until"`
 }
 
-type updateAction int
-
-const (
-	updateNone updateAction = iota
-	updateNow
-)
-
-func handleUpdateKey(state *appState, ev *tcell.EventKey) (updateAction, bool) {
-	switch ev.Key() {
-	case tcell.KeyEnter:
-		state.updatePrompt = false
-		return updateNow, true
-	case tcell.KeyRune:
-		switch ev.Rune() {
-		case 'u', 'U':
-			state.updatePrompt = false
-			return updateNow, true
-		case 'i', 'I':
-			if err := ignoreUpdatesFor(7 * 24 * time.Hour); err != nil {
-				state.lastErr = err.Error()
-			}
-			state.updatePrompt = false
-			state.updateVersion = ""
-			return updateNone, true
-		case 'n', 'N':
-			state.updatePrompt = false
-			state.updateVersion = ""
-			return updateNone, true
-		}
-	}
-	return updateNone, false
-}
-
 func checkForUpdate(ctx context.Context, currentVersion string) updateResult {
 	current := normalizeVersion(currentVersion)
 	if current == "" || current == "dev" || current == "unknown" {
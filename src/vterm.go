@@ -0,0 +1,820 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// vtMaxPending bounds an unterminated escape sequence carried between
+// writes. A longer CSI or string sequence (a big OSC 52 or sixel payload)
+// is not buffered: what has arrived is dropped and the rest skipped up to
+// its terminator.
+const vtMaxPending = 4096
+
+// vtCell is one character cell. A zero ch is a blank cell. A wide ch also
+// covers the cell to its right, which is left blank.
+type vtCell struct {
+	ch rune
+	// comb holds combining marks drawn on top of ch.
+	comb  []rune
+	wide  bool
+	style tcell.Style
+	// link is the OSC 8 hyperlink the cell belongs to.
+	link string
+}
+
+// text is the cell's grapheme cluster.
+func (c vtCell) text() string {
+	if c.ch == 0 {
+		return " "
+	}
+	if len(c.comb) == 0 {
+		return string(c.ch)
+	}
+	return string(append([]rune{c.ch}, c.comb...))
+}
+
+// vtGrid is an immutable copy of a terminal's visible screen.
+type vtGrid struct {
+	rows          [][]vtCell
+	width         int
+	cursorX       int
+	cursorY       int
+	cursorVisible bool
+	alternate     bool
+}
+
+type vtCursor struct {
+	x, y int
+	pen  ansiState
+}
+
+// vterm is a small VT100/xterm state machine: it keeps a cell grid for the
+// main and alternate screens, a scroll region and the cursor, and moves rows
+// that scroll off the top of the main screen into history as SGR text.
+type vterm struct {
+	width, height int
+	main, alt     [][]vtCell
+	altActive     bool
+	history       []string
+	limit         int
+
+	cx, cy        int
+	wrapNext      bool
+	pen           ansiState
+	saved         vtCursor
+	altSaved      vtCursor
+	top, bottom   int
+	cursorHidden  bool
+	noAutowrap    bool
+	pending       string
+	lastPrintable rune
+	// skipping is set while the rest of an oversized sequence of kind
+	// skip is being discarded.
+	skipping bool
+	skip     escKind
+}
+
+func newVTerm(width, height, limit int) *vterm {
+	width = maxInt(width, 1)
+	height = maxInt(height, 1)
+	t := &vterm{width: width, height: height, limit: limit}
+	t.main = newVTRows(width, height)
+	t.alt = newVTRows(width, height)
+	t.reset()
+	return t
+}
+
+func newVTRows(width, height int) [][]vtCell {
+	rows := make([][]vtCell, height)
+	for i := range rows {
+		rows[i] = make([]vtCell, width)
+	}
+	return rows
+}
+
+func (t *vterm) reset() {
+	t.cx, t.cy = 0, 0
+	t.wrapNext = false
+	t.pen = ansiState{style: tcell.StyleDefault}
+	t.saved = vtCursor{pen: t.pen}
+	t.top, t.bottom = 0, t.height-1
+	t.cursorHidden = false
+	t.noAutowrap = false
+}
+
+func (t *vterm) rows() [][]vtCell {
+	if t.altActive {
+		return t.alt
+	}
+	return t.main
+}
+
+// loadScreen writes captured screen lines onto rows 0.. of the active screen
+// and places the cursor, without scrolling or wrapping.
+func (t *vterm) loadScreen(lines []string, cursorX, cursorY int) {
+	for i, line := range lines {
+		if i >= t.height {
+			break
+		}
+		t.cx, t.cy = 0, i
+		t.wrapNext = false
+		t.pen = ansiState{style: tcell.StyleDefault}
+		t.noAutowrap = true
+		t.pending, t.skipping = "", false
+		t.write(line)
+		t.pending = ""
+	}
+	t.noAutowrap = false
+	t.pen = ansiState{style: tcell.StyleDefault}
+	t.cx = clampInt(cursorX, 0, t.width-1)
+	t.cy = clampInt(cursorY, 0, t.height-1)
+	t.wrapNext = false
+}
+
+// write feeds raw terminal output. Sequences split across writes are
+// completed on the next call.
+func (t *vterm) write(data string) {
+	if t.pending != "" {
+		data = t.pending + data
+		t.pending = ""
+	}
+	i := 0
+	if t.skipping {
+		n, done := skipEscape(data, t.skip)
+		if !done {
+			t.pending = data[n:]
+			return
+		}
+		t.skipping = false
+		i = n
+	}
+	for i < len(data) {
+		b := data[i]
+		switch {
+		case b == 0x1b:
+			n, ok := t.escape(data[i:])
+			if !ok {
+				t.holdEscape(data[i:])
+				return
+			}
+			i += n
+		case b < 0x20 || b == 0x7f:
+			t.control(b)
+			i++
+		default:
+			if !utf8.FullRuneInString(data[i:]) {
+				t.pending = data[i:]
+				return
+			}
+			r, size := utf8.DecodeRuneInString(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				i++
+				continue
+			}
+			if r >= 0x80 && r < 0xa0 {
+				i += size
+				continue
+			}
+			t.print(r)
+			i += size
+		}
+	}
+}
+
+// holdEscape keeps an escape sequence cut off by the end of a write for the
+// next one, or starts skipping it when it has grown past vtMaxPending.
+func (t *vterm) holdEscape(seq string) {
+	if len(seq) <= vtMaxPending {
+		t.pending = seq
+		return
+	}
+	switch seq[1] {
+	case '[':
+		t.skip = escCSI
+	case ']':
+		t.skip = escOSC
+	case 'P', 'X', '^', '_':
+		t.skip = escString
+	default:
+		return
+	}
+	t.skipping = true
+	n, _ := skipEscape(seq[2:], t.skip)
+	t.pending = seq[2+n:]
+}
+
+func (t *vterm) control(b byte) {
+	switch b {
+	case '\r':
+		t.cx = 0
+		t.wrapNext = false
+	case '\n', '\v', '\f':
+		t.lineFeed()
+	case '\b':
+		if t.cx > 0 {
+			t.cx--
+		}
+		t.wrapNext = false
+	case '\t':
+		t.cx = minInt((t.cx/8+1)*8, t.width-1)
+		t.wrapNext = false
+	}
+}
+
+func (t *vterm) print(r rune) {
+	w := runeWidth(r)
+	if t.pen.hidden && r != ' ' {
+		// Concealed text only takes up its cells.
+		for i := 0; i < w; i++ {
+			t.print(' ')
+		}
+		return
+	}
+	if w == 0 {
+		t.combine(r)
+		return
+	}
+	if t.wrapNext {
+		if !t.noAutowrap {
+			t.cx = 0
+			t.lineFeed()
+		}
+		t.wrapNext = false
+	}
+	if w == 2 && t.cx == t.width-1 {
+		// No room for both halves: wrap early like xterm, or drop the
+		// character when it could never fit.
+		if t.noAutowrap || t.width < 2 {
+			return
+		}
+		t.eraseCells(t.rows()[t.cy], t.cx, t.cx+1)
+		t.cx = 0
+		t.lineFeed()
+	}
+	rows := t.rows()
+	if row := rows[t.cy]; t.cx > 0 && row[t.cx-1].wide {
+		// Overwriting the right half of a wide character blanks it.
+		row[t.cx-1] = vtCell{style: row[t.cx-1].style}
+	}
+	rows[t.cy][t.cx] = vtCell{ch: r, wide: w == 2, style: t.pen.style, link: t.pen.link}
+	if w == 2 {
+		t.cx++
+		rows[t.cy][t.cx] = vtCell{style: t.pen.style, link: t.pen.link}
+	}
+	t.lastPrintable = r
+	if t.cx == t.width-1 {
+		t.wrapNext = true
+		return
+	}
+	t.cx++
+}
+
+// combine attaches a zero-width rune to the last printed cell.
+func (t *vterm) combine(r rune) {
+	x := t.cx
+	if !t.wrapNext {
+		x--
+	}
+	row := t.rows()[t.cy]
+	if x > 0 && row[x].ch == 0 && row[x-1].wide {
+		x--
+	}
+	if x < 0 || row[x].ch == 0 {
+		return
+	}
+	// Copy on append: snapshots share the comb slices of their cells.
+	comb := row[x].comb
+	row[x].comb = append(comb[:len(comb):len(comb)], r)
+}
+
+func (t *vterm) lineFeed() {
+	t.wrapNext = false
+	if t.cy == t.bottom {
+		t.scrollUp(1, true)
+		return
+	}
+	if t.cy < t.height-1 {
+		t.cy++
+	}
+}
+
+func (t *vterm) reverseIndex() {
+	t.wrapNext = false
+	if t.cy == t.top {
+		t.scrollDown(1)
+		return
+	}
+	if t.cy > 0 {
+		t.cy--
+	}
+}
+
+// upperBound and lowerBound limit vertical cursor movement to the scroll
+// region, unless the cursor is already outside it.
+func (t *vterm) upperBound() int {
+	if t.cy < t.top {
+		return 0
+	}
+	return t.top
+}
+
+func (t *vterm) lowerBound() int {
+	if t.cy > t.bottom {
+		return t.height - 1
+	}
+	return t.bottom
+}
+
+func (t *vterm) blankRow() []vtCell {
+	row := make([]vtCell, t.width)
+	t.eraseCells(row, 0, t.width)
+	return row
+}
+
+// eraseCells blanks row[from:to] with the current background colour.
+func (t *vterm) eraseCells(row []vtCell, from, to int) {
+	_, bg, _ := t.pen.style.Decompose()
+	blank := vtCell{style: tcell.StyleDefault.Background(bg)}
+	for i := maxInt(from, 0); i < to && i < len(row); i++ {
+		row[i] = blank
+	}
+}
+
+// scrollUp scrolls the region up by n rows. With toHistory, rows leaving
+// the top of the main screen are kept as history.
+func (t *vterm) scrollUp(n int, toHistory bool) {
+	rows := t.rows()
+	n = minInt(n, t.bottom-t.top+1)
+	for i := 0; i < n; i++ {
+		if toHistory && !t.altActive && t.top == 0 {
+			t.pushHistory(rows[t.top])
+		}
+		copy(rows[t.top:t.bottom], rows[t.top+1:t.bottom+1])
+		rows[t.bottom] = t.blankRow()
+	}
+}
+
+func (t *vterm) scrollDown(n int) {
+	rows := t.rows()
+	n = minInt(n, t.bottom-t.top+1)
+	for i := 0; i < n; i++ {
+		copy(rows[t.top+1:t.bottom+1], rows[t.top:t.bottom])
+		rows[t.top] = t.blankRow()
+	}
+}
+
+func (t *vterm) pushHistory(row []vtCell) {
+	t.history = append(t.history, vtRowString(row))
+	if t.limit > 0 && len(t.history) > t.limit {
+		t.history = append([]string(nil), t.history[len(t.history)-t.limit:]...)
+	}
+}
+
+// escape handles the sequence at the start of s and returns its length; ok
+// is false when s ends before the sequence does.
+func (t *vterm) escape(s string) (int, bool) {
+	tok, n, ok := scanEscape(s)
+	if !ok {
+		return 0, false
+	}
+	switch tok.kind {
+	case escCSI:
+		// Sequences with intermediate bytes (DECSCUSR, DECSTR, ...) are
+		// not modelled.
+		if tok.inter == "" {
+			t.csi(tok.params, tok.final)
+		}
+	case escOSC:
+		if uri, ok := oscHyperlink(tok.params); ok {
+			t.pen.link = uri
+		}
+	case escEsc:
+		// Charset designations and other sequences with intermediates
+		// are ignored.
+		if tok.inter == "" {
+			t.escFinal(tok.final)
+		}
+	}
+	return n, true
+}
+
+func (t *vterm) escFinal(final byte) {
+	switch final {
+	case '7':
+		t.saved = vtCursor{x: t.cx, y: t.cy, pen: t.pen}
+	case '8':
+		t.cx, t.cy, t.pen = t.saved.x, t.saved.y, t.saved.pen
+		t.wrapNext = false
+	case 'D':
+		t.lineFeed()
+	case 'E':
+		t.cx = 0
+		t.lineFeed()
+	case 'M':
+		t.reverseIndex()
+	case 'c':
+		t.altActive = false
+		t.main = newVTRows(t.width, t.height)
+		t.alt = newVTRows(t.width, t.height)
+		t.reset()
+	}
+}
+
+func (t *vterm) csi(params string, final byte) {
+	private := ""
+	if params != "" && strings.ContainsRune("?<=>", rune(params[0])) {
+		private = params[:1]
+		params = params[1:]
+	}
+	if final == 'm' {
+		if private == "" {
+			t.pen = applySGR(t.pen, tcell.StyleDefault, parseSGRParams(params))
+		}
+		return
+	}
+	args := vtParams(params)
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+	if private != "" {
+		if private == "?" && (final == 'h' || final == 'l') {
+			for _, mode := range args {
+				t.privateMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+
+	rows := t.rows()
+	switch final {
+	case 'A':
+		t.cy = maxInt(t.cy-arg(0, 1), t.upperBound())
+	case 'B', 'e':
+		t.cy = minInt(t.cy+arg(0, 1), t.lowerBound())
+	case 'C', 'a':
+		t.cx = minInt(t.cx+arg(0, 1), t.width-1)
+	case 'D':
+		t.cx = maxInt(t.cx-arg(0, 1), 0)
+	case 'E':
+		t.cy = minInt(t.cy+arg(0, 1), t.lowerBound())
+		t.cx = 0
+	case 'F':
+		t.cy = maxInt(t.cy-arg(0, 1), t.upperBound())
+		t.cx = 0
+	case 'G', '`':
+		t.cx = clampInt(arg(0, 1)-1, 0, t.width-1)
+	case 'd':
+		t.cy = clampInt(arg(0, 1)-1, 0, t.height-1)
+	case 'H', 'f':
+		t.cy = clampInt(arg(0, 1)-1, 0, t.height-1)
+		t.cx = clampInt(arg(1, 1)-1, 0, t.width-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			t.eraseCells(rows[t.cy], t.cx, t.width)
+			for y := t.cy + 1; y < t.height; y++ {
+				t.eraseCells(rows[y], 0, t.width)
+			}
+		case 1:
+			for y := 0; y < t.cy; y++ {
+				t.eraseCells(rows[y], 0, t.width)
+			}
+			t.eraseCells(rows[t.cy], 0, t.cx+1)
+		case 2, 3:
+			for y := 0; y < t.height; y++ {
+				t.eraseCells(rows[y], 0, t.width)
+			}
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			t.eraseCells(rows[t.cy], t.cx, t.width)
+		case 1:
+			t.eraseCells(rows[t.cy], 0, t.cx+1)
+		case 2:
+			t.eraseCells(rows[t.cy], 0, t.width)
+		}
+	case 'X':
+		t.eraseCells(rows[t.cy], t.cx, t.cx+arg(0, 1))
+	case '@':
+		row := rows[t.cy]
+		n := minInt(arg(0, 1), t.width-t.cx)
+		copy(row[t.cx+n:], row[t.cx:t.width-n])
+		t.eraseCells(row, t.cx, t.cx+n)
+	case 'P':
+		row := rows[t.cy]
+		n := minInt(arg(0, 1), t.width-t.cx)
+		copy(row[t.cx:], row[t.cx+n:])
+		t.eraseCells(row, t.width-n, t.width)
+	case 'L', 'M':
+		if t.cy < t.top || t.cy > t.bottom {
+			break
+		}
+		top := t.top
+		t.top = t.cy
+		if final == 'L' {
+			t.scrollDown(arg(0, 1))
+		} else {
+			t.scrollUp(arg(0, 1), false)
+		}
+		t.top = top
+		t.cx = 0
+	case 'S':
+		t.scrollUp(arg(0, 1), false)
+	case 'T':
+		t.scrollDown(arg(0, 1))
+	case 'b':
+		// Repeating more than a screenful only scrolls the same rows by
+		// again, so cap the count the way tmux and xterm do.
+		for n := minInt(arg(0, 1), t.width*t.height); n > 0 && t.lastPrintable != 0; n-- {
+			t.print(t.lastPrintable)
+		}
+	case 'r':
+		top := arg(0, 1) - 1
+		bottom := arg(1, t.height) - 1
+		if top < bottom && bottom < t.height {
+			t.top, t.bottom = top, bottom
+			t.cx, t.cy = 0, 0
+		}
+	case 's':
+		t.saved = vtCursor{x: t.cx, y: t.cy, pen: t.pen}
+	case 'u':
+		t.cx, t.cy, t.pen = t.saved.x, t.saved.y, t.saved.pen
+	}
+	t.wrapNext = false
+}
+
+func (t *vterm) privateMode(mode int, on bool) {
+	switch mode {
+	case 7:
+		t.noAutowrap = !on
+	case 25:
+		t.cursorHidden = !on
+	case 47, 1047, 1049:
+		if on == t.altActive {
+			return
+		}
+		if mode == 1049 && on {
+			t.altSaved = vtCursor{x: t.cx, y: t.cy, pen: t.pen}
+		}
+		t.altActive = on
+		if on {
+			t.alt = newVTRows(t.width, t.height)
+		}
+		if mode == 1049 && !on {
+			t.cx, t.cy, t.pen = t.altSaved.x, t.altSaved.y, t.altSaved.pen
+		}
+		t.wrapNext = false
+	}
+}
+
+// vtParams reads the ;-separated parameters of a CSI sequence. An empty
+// parameter is 0, which the sequences treat as their default, so ;10H is
+// row 1, column 10.
+func vtParams(s string) []int {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ";")
+	out := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			n = 0
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// snapshot copies the visible screen. Blank rows below both the cursor and
+// the last written row are left out on the main screen, matching how
+// capture-pane output is trimmed.
+func (t *vterm) snapshot() *vtGrid {
+	rows := t.rows()
+	count := t.height
+	if !t.altActive {
+		count = t.cy + 1
+		for y := t.height - 1; y > t.cy; y-- {
+			if !vtRowBlank(rows[y]) {
+				count = y + 1
+				break
+			}
+		}
+	}
+	grid := &vtGrid{
+		rows:          make([][]vtCell, count),
+		width:         t.width,
+		cursorX:       t.cx,
+		cursorY:       t.cy,
+		cursorVisible: !t.cursorHidden,
+		alternate:     t.altActive,
+	}
+	for y := 0; y < count; y++ {
+		grid.rows[y] = append([]vtCell(nil), rows[y]...)
+	}
+	return grid
+}
+
+// lines returns history followed by the snapshot rows as SGR text, at most
+// limit lines in total.
+func (t *vterm) lines(grid *vtGrid, limit int) []string {
+	history := t.history
+	if limit > 0 && len(history)+len(grid.rows) > limit {
+		history = history[minInt(len(history), len(history)+len(grid.rows)-limit):]
+	}
+	lines := make([]string, 0, len(history)+len(grid.rows))
+	lines = append(lines, history...)
+	for _, row := range grid.rows {
+		lines = append(lines, vtRowString(row))
+	}
+	return lines
+}
+
+// gridFromScreen renders captured screen lines into a grid of the pane's
+// size. The grid has exactly one row per line so it lines up with the
+// view's lines.
+func gridFromScreen(lines []string, width, height int, cursor paneCursor, alternate bool) *vtGrid {
+	if width <= 0 {
+		for _, line := range lines {
+			width = maxInt(width, ansiVisibleWidth(line))
+		}
+	}
+	term := newVTerm(width, maxInt(height, len(lines)), 0)
+	term.altActive = alternate
+	term.cursorHidden = !cursor.visible
+	term.loadScreen(lines, cursor.x, cursor.y)
+	grid := term.snapshot()
+	rows := make([][]vtCell, len(lines))
+	for i := range rows {
+		if i < len(grid.rows) {
+			rows[i] = grid.rows[i]
+		} else {
+			rows[i] = make([]vtCell, term.width)
+		}
+	}
+	grid.rows = rows
+	return grid
+}
+
+func vtRowBlank(row []vtCell) bool {
+	for _, cell := range row {
+		if cell.ch != 0 && cell.ch != ' ' {
+			return false
+		}
+		if _, bg, _ := cell.style.Decompose(); bg != tcell.ColorDefault {
+			return false
+		}
+	}
+	return true
+}
+
+// vtRowString encodes a row as text with SGR sequences, dropping trailing
+// blank cells.
+func vtRowString(row []vtCell) string {
+	end := len(row)
+	for end > 0 && row[end-1].ch == 0 && row[end-1].style == tcell.StyleDefault {
+		end--
+	}
+	var b strings.Builder
+	current := tcell.StyleDefault
+	link := ""
+	for i := 0; i < end; i++ {
+		cell := row[i]
+		if cell.link != link {
+			b.WriteString(osc8(cell.link))
+			link = cell.link
+		}
+		if cell.style != current {
+			b.WriteString(styleSGR(cell.style))
+			current = cell.style
+		}
+		b.WriteString(cell.text())
+		if cell.wide {
+			// The right half of a wide cell is part of it.
+			i++
+		}
+	}
+	if current != tcell.StyleDefault {
+		b.WriteString("\x1b[0m")
+	}
+	if link != "" {
+		b.WriteString(osc8(""))
+	}
+	return b.String()
+}
+
+// osc8 returns the OSC 8 sequence that starts a hyperlink to uri, or ends
+// the current one when uri is empty.
+func osc8(uri string) string {
+	return "\x1b]8;;" + uri + "\x1b\\"
+}
+
+// styleSGR returns the SGR sequence that selects style from a reset state.
+func styleSGR(style tcell.Style) string {
+	fg, bg, attrs := style.Decompose()
+	params := []string{"0"}
+	for _, attr := range []struct {
+		mask tcell.AttrMask
+		code string
+	}{
+		{tcell.AttrBold, "1"},
+		{tcell.AttrDim, "2"},
+		{tcell.AttrItalic, "3"},
+		{tcell.AttrBlink, "5"},
+		{tcell.AttrReverse, "7"},
+		{tcell.AttrStrikeThrough, "9"},
+	} {
+		if attrs&attr.mask != 0 {
+			params = append(params, attr.code)
+		}
+	}
+	switch ul := style.GetUnderlineStyle(); ul {
+	case tcell.UnderlineStyleNone:
+	case tcell.UnderlineStyleSolid:
+		params = append(params, "4")
+	default:
+		params = append(params, "4:"+strconv.Itoa(int(ul)))
+	}
+	if c := style.GetUnderlineColor(); c != tcell.ColorDefault && c&tcell.ColorValid != 0 {
+		if c&tcell.ColorIsRGB != 0 {
+			r, g, b := c.RGB()
+			params = append(params, "58:2::"+strconv.Itoa(int(r))+":"+strconv.Itoa(int(g))+":"+strconv.Itoa(int(b)))
+		} else {
+			params = append(params, "58:5:"+strconv.Itoa(int(c-tcell.ColorValid)))
+		}
+	}
+	params = appendColorSGR(params, fg, 30)
+	params = appendColorSGR(params, bg, 40)
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+func appendColorSGR(params []string, c tcell.Color, base int) []string {
+	switch {
+	case c == tcell.ColorDefault || c&tcell.ColorValid == 0:
+		return params
+	case c&tcell.ColorIsRGB != 0:
+		r, g, b := c.RGB()
+		return append(params, strconv.Itoa(base+8), "2", strconv.Itoa(int(r)), strconv.Itoa(int(g)), strconv.Itoa(int(b)))
+	}
+	index := int(c - tcell.ColorValid)
+	switch {
+	case index < 8:
+		return append(params, strconv.Itoa(base+index))
+	case index < 16:
+		return append(params, strconv.Itoa(base+60+index-8))
+	}
+	return append(params, strconv.Itoa(base+8), "5", strconv.Itoa(index))
+}
+
+// drawVTRow draws one grid row, taking the cell's default colours from
+// baseStyle.
+func drawVTRow(screen tcell.Screen, x, y, width int, row []vtCell, baseStyle tcell.Style) {
+	baseFg, baseBg, _ := baseStyle.Decompose()
+	for col := 0; col < width; col++ {
+		if col >= len(row) {
+			screen.SetContent(x+col, y, ' ', nil, baseStyle)
+			continue
+		}
+		cell := row[col]
+		style := cell.style
+		fg, bg, _ := style.Decompose()
+		if fg == tcell.ColorDefault {
+			style = style.Foreground(baseFg)
+		}
+		if bg == tcell.ColorDefault {
+			style = style.Background(baseBg)
+		}
+		if cell.link != "" {
+			style = style.Url(cell.link)
+		}
+		if cell.wide {
+			if col+1 < width {
+				screen.Put(x+col, y, cell.text(), style)
+				col++
+				continue
+			}
+			// Only the left half fits.
+			screen.SetContent(x+col, y, ' ', nil, style)
+			continue
+		}
+		screen.Put(x+col, y, cell.text(), style)
+	}
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func vtText(grid *vtGrid) []string {
+	out := make([]string, 0, len(grid.rows))
+	for _, row := range grid.rows {
+		var b strings.Builder
+		for i := 0; i < len(row); i++ {
+			b.WriteString(row[i].text())
+			if row[i].wide {
+				i++
+			}
+		}
+		out = append(out, strings.TrimRight(b.String(), " "))
+	}
+	return out
+}
+
+func TestVTermCursorMovementAndErase(t *testing.T) {
+	term := newVTerm(10, 4, 0)
+	term.write("abcdefghij\x1b[2;3HXY\x1b[1;5H\x1b[K\x1b[3;1Hline3\x1b[2D\x1b[1P")
+	got := vtText(term.snapshot())
+	want := []string{"abcd", "  XY", "lin3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("grid = %q, want %q", got, want)
+	}
+	if term.cx != 3 || term.cy != 2 {
+		t.Fatalf("cursor = %d,%d", term.cx, term.cy)
+	}
+
+	term.write("\x1b[4;2Hz\x1b[1J")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"", "", "", ""}) {
+		t.Fatalf("after erase above = %q", got)
+	}
+}
+
+func TestVTermWrapsAndScrollsIntoHistory(t *testing.T) {
+	term := newVTerm(4, 2, 10)
+	term.write("abcdef\r\nghi")
+	grid := term.snapshot()
+	if got := vtText(grid); !reflect.DeepEqual(got, []string{"ef", "ghi"}) {
+		t.Fatalf("grid = %q", got)
+	}
+	if !reflect.DeepEqual(term.history, []string{"abcd"}) {
+		t.Fatalf("history = %q", term.history)
+	}
+	if got := term.lines(grid, 2); !reflect.DeepEqual(got, []string{"ef", "ghi"}) {
+		t.Fatalf("limited lines = %q", got)
+	}
+}
+
+func TestVTermEmptyParamsTakeDefaults(t *testing.T) {
+	term := newVTerm(12, 4, 0)
+	term.write("\x1b[;10HX\x1b[3;HY")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"         X", "", "Y"}) {
+		t.Fatalf("grid = %q", got)
+	}
+	if term.cx != 1 || term.cy != 2 {
+		t.Fatalf("cursor = %d,%d", term.cx, term.cy)
+	}
+}
+
+func TestVTermSkipsOversizedSequenceAcrossWrites(t *testing.T) {
+	term := newVTerm(12, 2, 0)
+	payload := strings.Repeat("QUJD", 1500)
+	// An OSC 52 ended by BEL in the next write, then one ended by an ST
+	// whose ESC and backslash arrive in separate writes.
+	term.write("ab\x1b]52;c;" + payload[:5000])
+	term.write(payload[5000:] + "\acd")
+	term.write("\x1b]52;c;" + payload)
+	term.write(payload + "\x1b")
+	term.write("\\ef")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"abcdef"}) {
+		t.Fatalf("grid = %q", got)
+	}
+	if term.skipping || term.pending != "" {
+		t.Fatalf("still skipping=%v pending=%q", term.skipping, term.pending)
+	}
+}
+
+func TestVTermCapsRepeatCount(t *testing.T) {
+	term := newVTerm(6, 3, 10)
+	start := time.Now()
+	term.write("ab\x1b[2000000000b")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("huge REP took %v", elapsed)
+	}
+	// "ab" plus a screenful of repeats: 20 cells, wrapped at 6.
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"bbbbbb", "bbbbbb", "bb"}) {
+		t.Fatalf("grid = %q", got)
+	}
+	if !reflect.DeepEqual(term.history, []string{"abbbbb"}) {
+		t.Fatalf("history = %q", term.history)
+	}
+}
+
+func TestVTermScrollRegionKeepsStatusLine(t *testing.T) {
+	term := newVTerm(6, 4, 10)
+	term.write("\x1b[4;1Hstatus\x1b[1;3r\x1b[1;1Ha\r\nb\r\nc\r\nd")
+	got := vtText(term.snapshot())
+	if !reflect.DeepEqual(got, []string{"b", "c", "d", "status"}) {
+		t.Fatalf("grid = %q", got)
+	}
+	if !reflect.DeepEqual(term.history, []string{"a"}) {
+		t.Fatalf("history = %q", term.history)
+	}
+
+	term.write("\x1b[2;1H\x1b[L")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"b", "", "c", "status"}) {
+		t.Fatalf("after insert line = %q", got)
+	}
+	term.write("\x1b[M\x1b[M")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"b", "", "", "status"}) {
+		t.Fatalf("after delete lines = %q", got)
+	}
+	if len(term.history) != 1 {
+		t.Fatalf("deleted lines leaked into history: %q", term.history)
+	}
+}
+
+func TestVTermAlternateScreenRestoresMainScreen(t *testing.T) {
+	term := newVTerm(8, 3, 10)
+	term.write("$ vim\r\n")
+	term.write("\x1b[?1049h\x1b[H\x1b[2Jeditor\x1b[?25l")
+	grid := term.snapshot()
+	if !grid.alternate || grid.cursorVisible || len(grid.rows) != 3 {
+		t.Fatalf("alternate grid = %+v", grid)
+	}
+	if got := vtText(grid); got[0] != "editor" {
+		t.Fatalf("alternate rows = %q", got)
+	}
+
+	term.write("\x1b[?1049l\x1b[?25h")
+	grid = term.snapshot()
+	if grid.alternate || grid.cursorY != 1 || grid.cursorX != 0 {
+		t.Fatalf("restored grid = %+v", grid)
+	}
+	if got := vtText(grid); !reflect.DeepEqual(got, []string{"$ vim", ""}) {
+		t.Fatalf("main rows = %q", got)
+	}
+}
+
+func TestVTermCompletesSequencesSplitAcrossWrites(t *testing.T) {
+	term := newVTerm(10, 2, 0)
+	for _, chunk := range []string{"a\x1b", "[3", "1mb\x1b]0;ti", "tle\a", "\xe2\x82", "\xac"} {
+		term.write(chunk)
+	}
+	row := term.snapshot().rows[0]
+	if row[0].ch != 'a' || row[1].ch != 'b' || row[2].ch != '€' {
+		t.Fatalf("row = %q", vtText(term.snapshot()))
+	}
+	if fg, _, _ := row[1].style.Decompose(); fg != tcell.ColorMaroon {
+		t.Fatalf("fg = %v", fg)
+	}
+}
+
+func TestVTRowStringRoundTripsThroughVTerm(t *testing.T) {
+	term := newVTerm(12, 1, 0)
+	term.write("\x1b[1;31mred\x1b[0m plain \x1b[44mbg\x1b[0m")
+	text := vtRowString(term.snapshot().rows[0])
+
+	other := newVTerm(12, 1, 0)
+	other.write(text)
+	if !reflect.DeepEqual(other.snapshot().rows[0], term.snapshot().rows[0]) {
+		t.Fatalf("round trip of %q differs", text)
+	}
+}
+
+func TestDrawCellRendersGridRowsWithBackground(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 6)
+
+	lines := []string{"history", "\x1b[44mtop\x1b[0m", "bottom"}
+	sess := sessionView{key: "a", name: "a", lines: lines}
+	sess.grid = gridFromScreen(lines[1:], 10, 2, paneCursor{}, true)
+	sess.grid.rows[0][5] = vtCell{ch: 'Z', style: tcell.StyleDefault.Background(tcell.ColorNavy)}
+	drawCell(screen, 0, 0, 20, 6, sess, borderSets[0], tcell.StyleDefault, tcell.StyleDefault, tcell.StyleDefault, 0, true, thumbOff)
+
+	if row := readScreenRow(screen, 2, 20); !strings.HasPrefix(row, "|history") {
+		t.Fatalf("history row = %q", row)
+	}
+	if row := readScreenRow(screen, 3, 20); !strings.HasPrefix(row, "|top  Z") {
+		t.Fatalf("grid row = %q", row)
+	}
+	_, style, _ := screen.Get(6, 3)
+	if _, bg, _ := style.Decompose(); bg != tcell.ColorNavy {
+		t.Fatalf("grid cell bg = %v", bg)
+	}
+}
+
+func TestVTermKeepsExtendedSGR(t *testing.T) {
+	style := tcell.StyleDefault.Italic(true).Dim(true).Underline(tcell.UnderlineStyleCurly, tcell.NewRGBColor(1, 2, 3)).Foreground(tcell.PaletteColor(120))
+	sgr := styleSGR(style)
+	if got := applySGR(ansiState{}, tcell.StyleDefault, parseSGRParams(sgr[2:len(sgr)-1])).style; got != style {
+		t.Fatalf("styleSGR %q round-trips to %+v", sgr, got)
+	}
+
+	term := newVTerm(6, 1, 0)
+	term.write("a\x1b[8mbc\x1b[28md")
+	if got := vtText(term.snapshot()); !reflect.DeepEqual(got, []string{"a  d"}) {
+		t.Fatalf("concealed text = %q", got)
+	}
+}
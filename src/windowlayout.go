@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// layoutPane is one leaf of a tmux window layout, in window cells.
+type layoutPane struct {
+	id     string
+	x      int
+	y      int
+	width  int
+	height int
+}
+
+// windowLayout is a parsed #{window_layout}: the window size and the
+// position of every pane. Separators are the cells no pane covers.
+type windowLayout struct {
+	width  int
+	height int
+	panes  []layoutPane
+}
+
+// parseWindowLayout parses tmux's layout string, e.g.
+// "bb62,159x48,0,0{79x48,0,0,1,79x48,80,0,2}". Pane ids come back with
+// their % prefix.
+func parseWindowLayout(s string) (windowLayout, error) {
+	if comma := strings.IndexByte(s, ','); comma == 4 {
+		s = s[comma+1:]
+	}
+	p := layoutParser{s: s}
+	var layout windowLayout
+	root, err := p.cell(&layout)
+	if err != nil {
+		return windowLayout{}, err
+	}
+	if p.pos != len(p.s) {
+		return windowLayout{}, fmt.Errorf("window layout: trailing data at %d", p.pos)
+	}
+	layout.width = root.width
+	layout.height = root.height
+	if len(layout.panes) == 0 {
+		return windowLayout{}, fmt.Errorf("window layout: no panes")
+	}
+	return layout, nil
+}
+
+type layoutParser struct {
+	s   string
+	pos int
+}
+
+func (p *layoutParser) cell(layout *windowLayout) (layoutPane, error) {
+	var cell layoutPane
+	var err error
+	if cell.width, err = p.number('x'); err != nil {
+		return cell, err
+	}
+	if cell.height, err = p.number(','); err != nil {
+		return cell, err
+	}
+	if cell.x, err = p.number(','); err != nil {
+		return cell, err
+	}
+	if cell.y, err = p.number(0); err != nil {
+		return cell, err
+	}
+	if p.pos >= len(p.s) {
+		return cell, fmt.Errorf("window layout: missing pane id at %d", p.pos)
+	}
+	switch p.s[p.pos] {
+	case ',':
+		p.pos++
+		id, err := p.number(0)
+		if err != nil {
+			return cell, err
+		}
+		cell.id = "%" + strconv.Itoa(id)
+		layout.panes = append(layout.panes, cell)
+		return cell, nil
+	case '{', '[':
+		closer := byte('}')
+		if p.s[p.pos] == '[' {
+			closer = ']'
+		}
+		p.pos++
+		for {
+			if _, err := p.cell(layout); err != nil {
+				return cell, err
+			}
+			if p.pos >= len(p.s) {
+				return cell, fmt.Errorf("window layout: unterminated split")
+			}
+			if p.s[p.pos] == ',' {
+				p.pos++
+				continue
+			}
+			if p.s[p.pos] != closer {
+				return cell, fmt.Errorf("window layout: unexpected %q at %d", p.s[p.pos], p.pos)
+			}
+			p.pos++
+			return cell, nil
+		}
+	}
+	return cell, fmt.Errorf("window layout: unexpected %q at %d", p.s[p.pos], p.pos)
+}
+
+// number reads decimal digits and, when sep is not zero, the separator
+// that must follow them.
+func (p *layoutParser) number(sep byte) (int, error) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, fmt.Errorf("window layout: expected number at %d", start)
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return 0, fmt.Errorf("window layout: %w", err)
+	}
+	if sep != 0 {
+		if p.pos >= len(p.s) || p.s[p.pos] != sep {
+			return 0, fmt.Errorf("window layout: expected %q at %d", sep, p.pos)
+		}
+		p.pos++
+	}
+	return n, nil
+}
+
+// stackedWindowLayout stands in for a layout that could not be parsed: the
+// panes stacked top to bottom in equal rows.
+func stackedWindowLayout(paneIDs []string) windowLayout {
+	height := len(paneIDs)*2 - 1
+	layout := windowLayout{width: 1, height: height}
+	for i, id := range paneIDs {
+		layout.panes = append(layout.panes, layoutPane{id: id, y: i * 2, width: 1, height: 1})
+	}
+	return layout
+}
+
+// place scales the layout into area. Pane edges are scaled independently so
+// every separator stays exactly one cell wide and neighbouring panes line
+// up; panes squeezed below one cell come back empty.
+func (l windowLayout) place(area rect) map[string]rect {
+	placed := make(map[string]rect, len(l.panes))
+	if l.width <= 0 || l.height <= 0 || area.empty() {
+		return placed
+	}
+	w := area.x1 - area.x0
+	h := area.y1 - area.y0
+	// far returns the exclusive end of a pane ending at end: the cell
+	// before the scaled start of whatever follows the separator.
+	far := func(end, size, span int) int {
+		if end >= size {
+			return span
+		}
+		return (end+1)*span/size - 1
+	}
+	for _, pane := range l.panes {
+		r := rect{
+			x0: pane.x * w / l.width,
+			y0: pane.y * h / l.height,
+			x1: far(pane.x+pane.width, l.width, w),
+			y1: far(pane.y+pane.height, l.height, h),
+		}
+		r.x0 += area.x0
+		r.x1 += area.x0
+		r.y0 += area.y0
+		r.y1 += area.y0
+		placed[pane.id] = r
+	}
+	return placed
+}
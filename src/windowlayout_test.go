@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const threePaneLayout = "5e5b,80x24,0,0{40x24,0,0,1,39x24,41,0[39x12,41,0,2,39x11,41,13,3]}"
+
+func TestParseWindowLayout(t *testing.T) {
+	layout, err := parseWindowLayout(threePaneLayout)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := windowLayout{width: 80, height: 24, panes: []layoutPane{
+		{id: "%1", x: 0, y: 0, width: 40, height: 24},
+		{id: "%2", x: 41, y: 0, width: 39, height: 12},
+		{id: "%3", x: 41, y: 13, width: 39, height: 11},
+	}}
+	if !reflect.DeepEqual(layout, want) {
+		t.Fatalf("layout = %+v", layout)
+	}
+
+	if layout, err := parseWindowLayout("b25d,80x24,0,0,0"); err != nil || len(layout.panes) != 1 || layout.panes[0].id != "%0" {
+		t.Fatalf("single pane = %+v, %v", layout, err)
+	}
+	for _, bad := range []string{"", "b25d,80x24,0,0", "b25d,80x24,0,0{40x24,0,0,1", "b25d,80x24,0,0,1junk"} {
+		if _, err := parseWindowLayout(bad); err == nil {
+			t.Fatalf("parseWindowLayout(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestWindowLayoutPlaceKeepsOneCellSeparators(t *testing.T) {
+	layout, _ := parseWindowLayout(threePaneLayout)
+	placed := layout.place(rect{x0: 5, y0: 2, x1: 25, y1: 12})
+	want := map[string]rect{
+		"%1": {x0: 5, y0: 2, x1: 14, y1: 12},
+		"%2": {x0: 15, y0: 2, x1: 25, y1: 6},
+		"%3": {x0: 15, y0: 7, x1: 25, y1: 12},
+	}
+	if !reflect.DeepEqual(placed, want) {
+		t.Fatalf("placed = %+v", placed)
+	}
+}
+
+func TestDrawWindowLayoutCell(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(22, 13)
+
+	pane := func(id, text string) sessionView {
+		return sessionView{key: "alpha|" + id, name: "alpha", paneID: id, windowIndex: 1, windowLayout: threePaneLayout, lines: []string{text}}
+	}
+	state := appState{
+		sessions: map[string]sessionView{
+			"alpha|%1": pane("%1", "left"),
+			"alpha|%2": pane("%2", "top"),
+			"alpha|%3": pane("%3", "bottom"),
+		},
+		scroll:       map[string]int{},
+		follow:       map[string]bool{},
+		windowLayout: true,
+	}
+	draw(screen, state, config{})
+
+	rows := []string{
+		readScreenRow(screen, 1, 22),
+		readScreenRow(screen, 2, 22),
+		readScreenRow(screen, 5, 22),
+		readScreenRow(screen, 6, 22),
+	}
+	want := []string{
+		"|alpha:1 (3 panes)   |",
+		"|left     |top       |",
+		"|         +----------|",
+		"|         |bottom    |",
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows =\n%s\nwant\n%s", strings.Join(rows, "\n"), strings.Join(want, "\n"))
+	}
+
+	names := orderedSessionNames(state)
+	if idx := viewIndexAt(state, screen, 17, 8); idx < 0 || names[idx] != "alpha|%3" {
+		t.Fatalf("hit test = %d", idx)
+	}
+	if idx := viewIndexAt(state, screen, 10, 8); idx != -1 {
+		t.Fatalf("separator hit test = %d", idx)
+	}
+	state.focusIndex = 2
+	if h := focusedContentHeight(state, screen, names); h != 5 {
+		t.Fatalf("focused content height = %d", h)
+	}
+}